@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/bulk"
+	"github.com/leophys/userz/store/pg"
+)
+
+var exportCommand = &cli.Command{
+	Name:  "export",
+	Usage: "export the users to a file, as NDJSON or CSV",
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:     "output",
+			Aliases:  []string{"o"},
+			Usage:    "The file to write the users to",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "The format of the file, ndjson or csv",
+			Value: string(bulk.FormatNDJSON),
+		},
+		&cli.StringFlag{
+			Name:  "columns",
+			Usage: fmt.Sprintf("The comma separated fields to export (default: %s)", strings.Join(bulk.Columns(), ",")),
+		},
+		&cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "A condition on a field, as <field><condition> (e.g. country=IT or created_at>=2022-01-01T00:00:00Z)",
+		},
+		&cli.BoolFlag{
+			Name:  "gzip",
+			Usage: "Compress the file with gzip",
+		},
+		&cli.UintFlag{
+			Name:  "page-size",
+			Usage: "The number of users fetched at a time",
+			Value: bulk.DefaultPageSize,
+		},
+	},
+	Action: runExport,
+}
+
+func runExport(c *cli.Context) error {
+	logger := setupLogger(c)
+	ctx := logger.WithContext(c.Context)
+
+	format, err := bulk.ParseFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	columns, err := bulk.ParseColumns(c.String("columns"))
+	if err != nil {
+		return err
+	}
+
+	filter, err := parseFilterFlags(c.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
+	pgURL, err := getPostgresURL(c)
+	if err != nil {
+		logger.Err(err).Msg("Failed to get postgres URL")
+		return err
+	}
+
+	store, err := pg.NewPGStore(ctx, pgURL)
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize store")
+		return err
+	}
+
+	output := c.Path("output")
+
+	// write aside, not to leave a truncated file behind
+	tmp, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	buffered := bufio.NewWriter(tmp)
+	var out io.Writer = buffered
+	var gz *gzip.Writer
+	if c.Bool("gzip") {
+		gz = gzip.NewWriter(buffered)
+		out = gz
+	}
+
+	count, err := bulk.Export(ctx, store, filter, out, bulk.ExportOptions{
+		Format:   format,
+		Columns:  columns,
+		PageSize: c.Uint("page-size"),
+	})
+	if err != nil {
+		logger.Err(err).Uint("exported", count).Msg("Failed to export the users")
+		return err
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), output); err != nil {
+		return err
+	}
+
+	logger.Info().Uint("exported", count).Str("output", output).Msg("Users exported")
+
+	return nil
+}
+
+// parseFilterFlags parses the conditions given as <field><condition>, e.g.
+// country=IT, into a filter.
+func parseFilterFlags(conditions []string) (*userz.Filter, error) {
+	params := make(map[string]string)
+
+	for _, condition := range conditions {
+		i := strings.IndexAny(condition, "=!<>^$ ")
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed filter %q", condition)
+		}
+
+		params[condition[:i]] = strings.TrimSpace(condition[i:])
+	}
+
+	return userz.ParseFilter(params)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/bulk"
+	"github.com/leophys/userz/pkg/notifier"
+	"github.com/leophys/userz/store/notifying"
+	"github.com/leophys/userz/store/pg"
+)
+
+var importCommand = &cli.Command{
+	Name:      "import",
+	Usage:     "import the users from a file, as NDJSON or CSV",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "The format of the file, ndjson or csv",
+			Value: string(bulk.FormatNDJSON),
+		},
+		&cli.StringFlag{
+			Name:  "mode",
+			Usage: fmt.Sprintf("Either %s, to import nothing if any row is not valid, or %s", bulk.ModeAllOrNothing, bulk.ModeSkipInvalid),
+			Value: string(bulk.ModeAllOrNothing),
+		},
+		&cli.BoolFlag{
+			Name:  "gzip",
+			Usage: "Decompress the file with gzip",
+		},
+	},
+	Action: runImport,
+}
+
+func runImport(c *cli.Context) error {
+	logger := setupLogger(c)
+	ctx := logger.WithContext(c.Context)
+
+	if c.NArg() != 1 {
+		return errors.New("exactly one file to import is expected")
+	}
+	input := c.Args().First()
+
+	format, err := bulk.ParseFormat(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	mode, err := bulk.ParseMode(c.String("mode"))
+	if err != nil {
+		return err
+	}
+
+	pgURL, err := getPostgresURL(c)
+	if err != nil {
+		logger.Err(err).Msg("Failed to get postgres URL")
+		return err
+	}
+
+	pool, err := pg.Connect(ctx, pgURL)
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize store")
+		return err
+	}
+	defer pool.Close()
+
+	store := pg.NewPGStoreFromPool(pool)
+
+	if c.Bool("disable-notifications") {
+		logger.Debug().Msg("Notifications disabled")
+	} else if c.Bool("pg-change-feed") || contains(c.StringSlice("notifier"), "pg") {
+		// the running instances get the notification from the channel
+		configs, err := parseNotifierOpts(c.StringSlice("notifier-opt"))
+		if err != nil {
+			return err
+		}
+
+		publisher, err := notifier.New("pg", configs["pg"])
+		if err != nil {
+			return err
+		}
+
+		if err := publisher.Init(pg.ContextWithPool(ctx, pool)); err != nil {
+			logger.Err(err).Msg("Failed to initialize notifications")
+			return err
+		}
+
+		store = notifying.NewNotifyingStore(store, publisher)
+	} else {
+		logger.Warn().Msg("No notification of the import is sent without the pg notifier or --pg-change-feed")
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var in io.Reader = bufio.NewReader(file)
+	if c.Bool("gzip") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	report, err := bulk.Import(ctx, store, in, bulk.ImportOptions{
+		Format: format,
+		Mode:   mode,
+	})
+	if report != nil {
+		for _, rowErr := range report.Errors {
+			logger.Warn().
+				Uint("line", rowErr.Line).
+				Str("field", rowErr.Field).
+				Str("detail", rowErr.Detail).
+				Msg("Invalid row")
+		}
+	}
+	if errors.Is(err, bulk.ErrInvalidRows) {
+		err = fmt.Errorf("%d of %d rows are not valid, none was imported", report.Invalid, report.Total)
+		logger.Err(err).Msg("Import refused")
+		return err
+	}
+	if errors.Is(err, userz.ErrConflict) {
+		logger.Err(err).Msg("Some of the users already exist, none was imported")
+		return err
+	}
+	if err != nil {
+		logger.Err(err).Msg("Failed to import the users")
+		return err
+	}
+
+	logger.Info().
+		Uint("total", report.Total).
+		Uint("imported", report.Imported).
+		Uint("invalid", report.Invalid).
+		Str("input", input).
+		Msg("Users imported")
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
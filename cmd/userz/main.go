@@ -9,38 +9,55 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"plugin"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/hellofresh/health-go/v5"
 	pghealth "github.com/hellofresh/health-go/v5/checks/postgres"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 
 	"github.com/leophys/userz"
 	"github.com/leophys/userz/http"
-	"github.com/leophys/userz/internal"
+	"github.com/leophys/userz/internal/auth"
+	"github.com/leophys/userz/internal/grpcutils"
+	_ "github.com/leophys/userz/internal/pluginnotifier"
+	_ "github.com/leophys/userz/internal/pollednotifier"
+	"github.com/leophys/userz/internal/ratelimit"
+	"github.com/leophys/userz/internal/tlsutils"
+	_ "github.com/leophys/userz/internal/webhooknotifier"
 	"github.com/leophys/userz/pkg/notifier"
 	"github.com/leophys/userz/pkg/proto"
+	protov2 "github.com/leophys/userz/pkg/proto/v2"
 	"github.com/leophys/userz/prometheus"
+	"github.com/leophys/userz/store/authz"
 	"github.com/leophys/userz/store/notifying"
 	"github.com/leophys/userz/store/pg"
 )
 
 const (
-	defaultPGHost          = "localhost"
-	defaultPGPort          = 5432
-	defaultHTTPPort        = 6000
-	defaultGRPCPort        = 7000
-	defaultMetricsPort     = 25000
-	defaultHTTPRoute       = "/api"
-	defaultPluginPath      = "/pollednotifier.so"
-	defaultPGHealthTimeout = 5 * time.Second
+	defaultPGHost             = "localhost"
+	defaultPGPort             = 5432
+	defaultHTTPPort           = 6000
+	defaultGRPCPort           = 7000
+	defaultMetricsPort        = 25000
+	defaultHTTPRoute          = "/api"
+	defaultPluginPath         = "/pollednotifier.so"
+	defaultNotifier           = "polled"
+	defaultWatchHistory       = 10000
+	defaultWatchBuffer        = 1000
+	defaultPGHealthTimeout    = 5 * time.Second
+	defaultGRPCTimeout        = 30 * time.Second
+	defaultGRPCHealthInterval = 10 * time.Second
+	defaultTLSReloadInterval  = 10 * time.Second
+	defaultShutdownTimeout    = 30 * time.Second
 )
 
 var (
@@ -63,6 +80,36 @@ var (
 			Value:   defaultHTTPPort,
 			Action:  validatePort,
 		},
+		&cli.PathFlag{
+			Name:    "http-cert",
+			Usage:   "The path to a TLS certificate to use with the HTTP endpoint (reloaded on change)",
+			EnvVars: []string{"HTTP_CERT"},
+		},
+		&cli.PathFlag{
+			Name:    "http-key",
+			Usage:   "The path to a TLS key to use with the HTTP endpoint (reloaded on change)",
+			EnvVars: []string{"HTTP_KEY"},
+		},
+		&cli.PathFlag{
+			Name:    "http-client-ca",
+			Usage:   "The path to a PEM bundle of the CAs of the HTTP clients, to require and verify client certificates (mTLS)",
+			EnvVars: []string{"HTTP_CLIENT_CA"},
+		},
+		&cli.BoolFlag{
+			Name:    "http-default-cert",
+			Usage:   "Serve the embedded self-signed certificate on the HTTP endpoint if it has none, which is otherwise served in plaintext (for development only)",
+			EnvVars: []string{"HTTP_DEFAULT_CERT"},
+		},
+		&cli.BoolFlag{
+			Name:    "openapi-validation",
+			Usage:   "Refuse the HTTP requests not matching the OpenAPI document, and log the responses not matching it",
+			EnvVars: []string{"OPENAPI_VALIDATION"},
+		},
+		&cli.BoolFlag{
+			Name:    "api-docs",
+			Usage:   "Serve a page documenting the HTTP API at /api/docs",
+			EnvVars: []string{"API_DOCS"},
+		},
 		&cli.IntFlag{
 			Name:    "grpc-port",
 			Usage:   "The port on which the gRPC API will be exposed",
@@ -72,14 +119,100 @@ var (
 		},
 		&cli.PathFlag{
 			Name:    "grpc-cert",
-			Usage:   "The path to a TLS certificate to use with the gRPC endpoint",
+			Usage:   "The path to a TLS certificate to use with the gRPC endpoint (reloaded on change)",
 			EnvVars: []string{"GRPC_CERT"},
 		},
 		&cli.PathFlag{
 			Name:    "grpc-key",
-			Usage:   "The path to a TLS key to use with the gRPC endpoint",
+			Usage:   "The path to a TLS key to use with the gRPC endpoint (reloaded on change)",
 			EnvVars: []string{"GRPC_KEY"},
 		},
+		&cli.PathFlag{
+			Name:    "grpc-client-ca",
+			Usage:   "The path to a PEM bundle of the CAs of the gRPC clients, to require and verify client certificates (mTLS)",
+			EnvVars: []string{"GRPC_CLIENT_CA"},
+		},
+		&cli.BoolFlag{
+			Name:    "grpc-default-cert",
+			Usage:   "Serve the embedded self-signed certificate on the gRPC endpoint if it has none, which is otherwise served in plaintext (for development only)",
+			EnvVars: []string{"GRPC_DEFAULT_CERT"},
+		},
+		&cli.PathFlag{
+			Name:    "grpc-acl",
+			Usage:   "The path to a JSON file mapping the identities of the gRPC clients to the allowed RPCs (needs --grpc-client-ca)",
+			EnvVars: []string{"GRPC_ACL"},
+		},
+		&cli.DurationFlag{
+			Name:    "grpc-timeout",
+			Usage:   "The timeout applied to the unary gRPC requests not specifying a deadline",
+			EnvVars: []string{"GRPC_TIMEOUT"},
+			Value:   defaultGRPCTimeout,
+		},
+		&cli.BoolFlag{
+			Name:    "grpc-reflection",
+			Usage:   "Register the gRPC server reflection service",
+			EnvVars: []string{"GRPC_REFLECTION"},
+		},
+		&cli.PathFlag{
+			Name:    "api-keys",
+			Usage:   "The path to a JSON file with the API keys accepted by the HTTP and gRPC APIs (enables authentication)",
+			EnvVars: []string{"API_KEYS"},
+		},
+		&cli.PathFlag{
+			Name:    "jwks",
+			Usage:   "The path to a JWKS file with the keys to verify the JWT bearer tokens accepted by the HTTP and gRPC APIs (enables authentication)",
+			EnvVars: []string{"JWKS"},
+		},
+		&cli.StringFlag{
+			Name:    "jwt-issuer",
+			Usage:   "The issuer expected in the JWT bearer tokens, if set",
+			EnvVars: []string{"JWT_ISSUER"},
+		},
+		&cli.StringFlag{
+			Name:    "jwt-audience",
+			Usage:   "The audience expected in the JWT bearer tokens, if set",
+			EnvVars: []string{"JWT_AUDIENCE"},
+		},
+		&cli.PathFlag{
+			Name:    "policy",
+			Usage:   "The path to a JSON file with the authorization policy of the roles (requires authentication)",
+			EnvVars: []string{"POLICY"},
+		},
+		&cli.BoolFlag{
+			Name:    "allow-password-hash",
+			Usage:   "Allow anybody to set the password_hash of the users when there is no authorization policy",
+			EnvVars: []string{"ALLOW_PASSWORD_HASH"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit-read",
+			Usage:   "The reads (list and page) per second allowed to every client, no limit if 0",
+			EnvVars: []string{"RATE_LIMIT_READ"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit-write",
+			Usage:   "The writes (add, update and remove) per second allowed to every client, no limit if 0",
+			EnvVars: []string{"RATE_LIMIT_WRITE"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit-auth-failures",
+			Usage:   "The failed authentications per second allowed to every address, beyond which its requests are refused; no limit if 0",
+			EnvVars: []string{"RATE_LIMIT_AUTH_FAILURES"},
+		},
+		&cli.IntFlag{
+			Name:    "rate-limit-burst",
+			Usage:   "The requests a client can burst above its rate (defaults to one second worth of requests)",
+			EnvVars: []string{"RATE_LIMIT_BURST"},
+		},
+		&cli.IntFlag{
+			Name:    "max-in-flight",
+			Usage:   "The maximum number of requests served at once, the others are shed; no limit if 0",
+			EnvVars: []string{"MAX_IN_FLIGHT"},
+		},
+		&cli.IntFlag{
+			Name:    "max-streams",
+			Usage:   "The maximum number of exports served at once, apart from the other requests in flight, the others are shed; no limit if 0",
+			EnvVars: []string{"MAX_STREAMS"},
+		},
 		&cli.IntFlag{
 			Name:    "metrics-port",
 			Usage:   "The port on which the metrics will be exposed (healthcheck and prometheus)",
@@ -87,6 +220,37 @@ var (
 			Value:   defaultMetricsPort,
 			Action:  validatePort,
 		},
+		&cli.PathFlag{
+			Name:    "metrics-cert",
+			Usage:   "The path to a TLS certificate to use with the metrics endpoint (reloaded on change)",
+			EnvVars: []string{"METRICS_CERT"},
+		},
+		&cli.PathFlag{
+			Name:    "metrics-key",
+			Usage:   "The path to a TLS key to use with the metrics endpoint (reloaded on change)",
+			EnvVars: []string{"METRICS_KEY"},
+		},
+		&cli.PathFlag{
+			Name:    "metrics-client-ca",
+			Usage:   "The path to a PEM bundle of the CAs of the metrics clients, to require and verify client certificates (mTLS)",
+			EnvVars: []string{"METRICS_CLIENT_CA"},
+		},
+		&cli.BoolFlag{
+			Name:    "metrics-default-cert",
+			Usage:   "Serve the embedded self-signed certificate on the metrics endpoint if it has none, which is otherwise served in plaintext (for development only)",
+			EnvVars: []string{"METRICS_DEFAULT_CERT"},
+		},
+		&cli.DurationFlag{
+			Name:    "shutdown-timeout",
+			Usage:   "How long to wait on shutdown for the requests in flight, gRPC streams included, to finish before cutting them",
+			EnvVars: []string{"SHUTDOWN_TIMEOUT"},
+			Value:   defaultShutdownTimeout,
+		},
+		&cli.DurationFlag{
+			Name:    "shutdown-delay",
+			Usage:   "How long to keep serving on shutdown after failing the healthchecks, for the load balancers to stop routing requests here",
+			EnvVars: []string{"SHUTDOWN_DELAY"},
+		},
 		&cli.StringFlag{
 			Name:    "pgurl",
 			Usage:   "The url to connect to the postgres database (if specified, supercedes all other postgres flags)",
@@ -130,9 +294,25 @@ var (
 			Usage:   "Whether to disable notifications",
 			EnvVars: []string{"DISABLE_NOTIFICATIONS"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "notifier",
+			Usage:   fmt.Sprintf("The notifiers to send notifications to (available: %s)", strings.Join(notifier.Registered(), ", ")),
+			EnvVars: []string{"NOTIFIER"},
+			Value:   cli.NewStringSlice(defaultNotifier),
+		},
+		&cli.StringSliceFlag{
+			Name:    "notifier-opt",
+			Usage:   "Configuration for the notifiers, in the form <notifier>.<key>=<value>",
+			EnvVars: []string{"NOTIFIER_OPTS"},
+		},
+		&cli.BoolFlag{
+			Name:    "pg-change-feed",
+			Usage:   "Publish the notifications on a postgres channel and feed the notifiers from it, to see the changes of every instance, fetching the rows of the notified users (configure with --notifier-opt pg.<key>=<value>, e.g. pg.fetch=false to forward the payloads as they are)",
+			EnvVars: []string{"PG_CHANGE_FEED"},
+		},
 		&cli.PathFlag{
 			Name:    "notification-plugin",
-			Usage:   "Specify path to the .so that provides the notification functionality",
+			Usage:   "Specify path to the .so that provides the notification functionality (shorthand for --notifier-opt plugin.path=<path>)",
 			EnvVars: []string{"NOTIFICATION_PLUGIN"},
 			Value:   defaultPluginPath,
 		},
@@ -156,6 +336,10 @@ func main() {
 		Usage:  "manage a list of users",
 		Flags:  flags,
 		Action: run,
+		Commands: []*cli.Command{
+			exportCommand,
+			importCommand,
+		},
 	}
 
 	if err := app.RunContext(ctx, os.Args); err != nil {
@@ -165,7 +349,14 @@ func main() {
 
 func run(c *cli.Context) error {
 	logger := setupLogger(c)
+	// done on SIGINT or SIGTERM, to stop serving
 	ctx := logger.WithContext(c.Context)
+	// done on shutdown, to fail the healthchecks
+	ready, markNotReady := context.WithCancel(ctx)
+	defer markNotReady()
+	// done once the servers are drained, to stop the work in the background
+	lifetime, stop := context.WithCancel(logger.WithContext(context.Background()))
+	defer stop()
 
 	pgURL, err := getPostgresURL(c)
 	if err != nil {
@@ -180,14 +371,22 @@ func run(c *cli.Context) error {
 
 	var store userz.Store
 
-	store, err = pg.NewPGStore(ctx, pgURL)
+	pool, err := pg.Connect(ctx, pgURL)
 	if err != nil {
 		logger.Err(err).Msg("Failed to initialize store")
 		return err
 	}
+	defer pool.Close()
+
+	store = pg.NewPGStoreFromPool(pool)
+
+	var events *notifier.Broadcaster
+	var provider notifier.Notifier
 
 	if !c.Bool("disable-notifications") {
-		store, err = wrapWithNotifyingStore(ctx, store, c.Path("notification-plugin"))
+		events = notifier.NewBroadcaster(defaultWatchHistory, defaultWatchBuffer)
+
+		store, provider, err = wrapWithNotifyingStore(pg.ContextWithPool(lifetime, pool), store, pool, events, c)
 		if err != nil {
 			logger.Err(err).Msg("Failed to initialize notifying store")
 			return err
@@ -196,25 +395,116 @@ func run(c *cli.Context) error {
 
 	store = prometheus.NewMetricsStore(store)
 
-	api := httpapi.New(defaultHTTPRoute, store, logger)
+	authenticator, err := newAuthenticator(c)
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize authentication")
+		return err
+	}
+
+	limiter := newLimiter(c)
+
+	// the failed authentications are counted by address, before knowing
+	// the principal
+	middlewares := []func(http.Handler) http.Handler{ratelimit.AuthFailuresMiddleware(limiter)}
+	if authenticator != nil {
+		middlewares = append(middlewares, auth.Middleware(authenticator))
+	} else {
+		logger.Warn().Msg("Authentication disabled, the APIs are open to anybody")
+	}
+
+	middlewares = append(middlewares, ratelimit.Middleware(limiter))
+
+	if path := c.Path("policy"); path != "" {
+		if authenticator == nil {
+			err := errors.New("the authorization policy requires authentication")
+			logger.Err(err).Msg("Failed to initialize authorization")
+			return err
+		}
+
+		policy, err := authz.LoadPolicy(path)
+		if err != nil {
+			logger.Err(err).Msg("Failed to initialize authorization")
+			return err
+		}
+
+		store = authz.NewAuthzStore(store, policy)
+	} else if !c.Bool("allow-password-hash") {
+		store = authz.NewHashlessStore(store)
+	}
+
+	if c.Bool("openapi-validation") {
+		validator, err := httpapi.NewValidator(defaultHTTPRoute)
+		if err != nil {
+			logger.Err(err).Msg("Failed to initialize the OpenAPI validation")
+			return err
+		}
+
+		middlewares = append(middlewares, validator.Middleware)
+	}
+
+	api := httpapi.New(defaultHTTPRoute, store, logger, middlewares...)
 
-	if err := startGRPCServer(c, store, logger); err != nil {
+	if c.Bool("api-docs") {
+		docs := &httpapi.DocsHandler{}
+		api.Get(defaultHTTPRoute+"/docs", docs.ServeHTTP)
+	}
+
+	checks, err := newHealth(ready, pgURL, provider)
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize healthchecks")
+		return err
+	}
+
+	grpcServer, grpcErr, err := startGRPCServer(ready, lifetime, c, store, events, checks, authenticator, limiter, logger)
+	if err != nil {
 		logger.Err(err).Msg("Failed to initialize gRPC server")
 		return err
 	}
 
-	metricsErr := serveMetrics(c, logger, pgURL)
+	httpTLS, err := newTLS(lifetime, c, "http")
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize the TLS of the HTTP API")
+		return err
+	}
+	if httpTLS == nil {
+		logger.Warn().Msg("The HTTP API is served in plaintext, set --http-cert and --http-key")
+	}
+
+	metricsTLS, err := newTLS(lifetime, c, "metrics")
+	if err != nil {
+		logger.Err(err).Msg("Failed to initialize the TLS of the metrics")
+		return err
+	}
+
+	metricsServer, metricsErr := serveMetrics(c, logger, checks, metricsTLS)
+	apiServer, apiErr := serveHTTPApi(ctx, api, c.Int("http-port"), httpTLS)
 
 	select {
-	case err := <-serveHTTPApi(ctx, api, c.Int("http-port")):
-		logger.Fatal().Err(err).Msg("Failed to serve HTTP API")
-	case err := <-metricsErr:
-		logger.Fatal().Err(err).Msg("Failed to serve metrics")
+	case err = <-apiErr:
+		logger.Err(err).Msg("Failed to serve HTTP API")
+	case err = <-grpcErr:
+		logger.Err(err).Msg("Failed to serve gRPC API")
+	case err = <-metricsErr:
+		logger.Err(err).Msg("Failed to serve metrics")
 	case <-ctx.Done():
-		logger.Info().Err(ctx.Err()).Msg("Exiting")
+		logger.Info().Err(ctx.Err()).Msg("Shutting down")
 	}
 
-	return nil
+	shutdown(lifetime, &instance{
+		markNotReady:   markNotReady,
+		preStopDelay:   c.Duration("shutdown-delay"),
+		drainTimeout:   c.Duration("shutdown-timeout"),
+		events:         events,
+		apis:           []drainer{apiServer, grpcDrainer{grpcServer}},
+		provider:       provider,
+		metrics:        metricsServer,
+		stopBackground: stop,
+		pool:           pool,
+	})
+
+	logger.Info().Msg("Exiting")
+
+	return err
 }
 
 func validatePort(c *cli.Context, p int) error {
@@ -278,136 +568,402 @@ func getPostgresURL(c *cli.Context) (string, error) {
 	), nil
 }
 
-func serveHTTPApi(ctx context.Context, router chi.Router, port int) <-chan error {
+// serveHTTPApi serves the router in the background, until the returned
+// server is shut down. The error of the server, if it fails, is sent on the
+// returned channel.
+func serveHTTPApi(ctx context.Context, router chi.Router, port int, reloader *tlsutils.Reloader) (*http.Server, <-chan error) {
 	logger := zerolog.Ctx(ctx)
-	out := make(chan error)
 
 	addr := fmt.Sprintf(":%d", port)
 
-	logger.Info().Msgf("Serving HTTP APIs on '%s'", addr)
+	logger.Info().Bool("tls", reloader != nil).Msgf("Serving HTTP APIs on '%s'", addr)
 
-	if err := http.ListenAndServe(addr, router); err != nil {
-		if errors.Is(err, context.Canceled) {
-			logger.Info().Msg("HTTP API shut down")
-			out <- nil
-		} else {
-			logger.Warn().Err(err).Msg("HTTP API failed to be served")
-			out <- err
-		}
-	}
+	server := &http.Server{Addr: addr, Handler: router}
 
-	return out
+	return server, serve(server, reloader)
 }
 
-func startGRPCServer(c *cli.Context, store userz.Store, logger *zerolog.Logger) (err error) {
+// startGRPCServer serves the gRPC APIs in the background, until the
+// returned server is stopped, reporting them not serving once ctx is done.
+// The TLS files are reloaded until lifetime is done. The error of the
+// server, if it fails, is sent on the returned channel.
+func startGRPCServer(ctx, lifetime context.Context, c *cli.Context, store userz.Store, events *notifier.Broadcaster, checks *health.Health, authenticator *auth.Authenticator, limiter *ratelimit.Limiter, logger *zerolog.Logger) (*grpc.Server, <-chan error, error) {
 	port := c.Int("grpc-port")
-	certPath := c.Path("grpc-cert")
-	keyPath := c.Path("grpc-key")
 
-	if (certPath != "" && keyPath == "") || (certPath == "" && keyPath != "") {
-		return fmt.Errorf("both the certificate and the ")
+	reloader, err := newTLS(lifetime, c, "grpc")
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var creds credentials.TransportCredentials
-	if certPath != "" {
-		creds, err = credentials.NewServerTLSFromFile(certPath, keyPath)
-		if err != nil {
-			return
-		}
+	var serverOpts []grpc.ServerOption
+	if reloader != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig("h2"))))
 	} else {
-		cert, err := internal.GetDefaultCertificate()
+		logger.Warn().Msg("The gRPC API is served in plaintext, set --grpc-cert and --grpc-key")
+	}
+
+	if c.Path("grpc-client-ca") != "" {
+		logger.Info().Msg("gRPC clients are authenticated via mTLS")
+	}
+
+	var acl grpcutils.ACL
+	if aclPath := c.Path("grpc-acl"); aclPath != "" {
+		if c.Path("grpc-client-ca") == "" {
+			return nil, nil, fmt.Errorf("the gRPC ACL needs mTLS, set the client CA")
+		}
+
+		acl, err = grpcutils.LoadACL(aclPath)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+	}
+
+	// the failed authentications are counted by address, before knowing
+	// the principal
+	unary := []grpc.UnaryServerInterceptor{
+		grpcutils.UnaryLogger(*logger),
+		grpcutils.UnaryIdentity(acl),
+		ratelimit.UnaryAuthFailures(limiter),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		grpcutils.StreamLogger(*logger),
+		grpcutils.StreamIdentity(acl),
+		ratelimit.StreamAuthFailures(limiter),
+	}
 
-		creds = credentials.NewServerTLSFromCert(&cert)
+	if authenticator != nil {
+		unary = append(unary, auth.UnaryInterceptor(authenticator))
+		stream = append(stream, auth.StreamInterceptor(authenticator))
 	}
 
-	s := grpc.NewServer(grpc.Creds(creds))
+	unary = append(unary,
+		prometheus.UnaryServerInterceptor(),
+		ratelimit.UnaryInterceptor(limiter),
+		grpcutils.UnaryDeadline(c.Duration("grpc-timeout")),
+	)
+	stream = append(stream,
+		prometheus.StreamServerInterceptor(),
+		ratelimit.StreamInterceptor(limiter),
+	)
+
+	serverOpts = append(serverOpts, recovered(*logger, unary, stream)...)
+
+	s := grpc.NewServer(serverOpts...)
 
 	addr := fmt.Sprintf(":%d", port)
 
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	var opts []proto.ServiceOption
+	if events != nil {
+		opts = append(opts, proto.WithEvents(events))
 	}
 
-	service := proto.NewUserzServiceServer(store)
+	service := proto.NewUserzServiceServer(store, opts...)
 
 	proto.RegisterUserzServer(s, service)
+	protov2.RegisterUserzServer(s, protov2.NewUserzServiceServer(store))
+
+	grpcutils.ServeHealth(ctx, s, func(ctx context.Context) error {
+		check := checks.Measure(ctx)
+		if check.Status == health.StatusUnavailable {
+			return fmt.Errorf("healthcheck failed: %v", check.Failures)
+		}
+		return nil
+	}, defaultGRPCHealthInterval)
+
+	if c.Bool("grpc-reflection") {
+		reflection.Register(s)
+	}
+
+	out := make(chan error, 1)
 
 	go func() {
 		logger.Info().Msgf("Serving gRPC server on '%s'", addr)
 
-		err := s.Serve(listener)
-		if err != grpc.ErrServerStopped {
-			logger.Err(err).Msg("gRPC server failed")
+		// nil once stopped
+		if err := s.Serve(listener); err != nil {
+			out <- err
 		}
 	}()
 
-	return nil
+	return s, out, nil
 }
 
-func serveMetrics(c *cli.Context, logger *zerolog.Logger, pgURL string) <-chan error {
-	out := make(chan error)
+// recovered chains the interceptors after the recovery ones, for the panics
+// of the interceptors to be recovered as well as those of the handlers.
+func recovered(logger zerolog.Logger, unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) []grpc.ServerOption {
+	unary = append([]grpc.UnaryServerInterceptor{grpcutils.UnaryRecovery(logger)}, unary...)
+	stream = append([]grpc.StreamServerInterceptor{grpcutils.StreamRecovery(logger)}, stream...)
 
-	port := c.Int("metrics-port")
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
 
-	addr := fmt.Sprintf(":%d", port)
+// newAuthenticator returns the authenticator for the APIs, or nil if
+// neither API keys nor JWKS are configured.
+func newAuthenticator(c *cli.Context) (*auth.Authenticator, error) {
+	var opts []auth.Option
 
-	healthHandler, err := health.New(
-		health.WithComponent(health.Component{
-			Name:    "userz",
-			Version: commit,
-		}),
-		health.WithChecks(health.Config{
+	if path := c.Path("api-keys"); path != "" {
+		opts = append(opts, auth.WithAPIKeys(path))
+	}
+
+	if path := c.Path("jwks"); path != "" {
+		opts = append(opts, auth.WithJWKS(path, c.String("jwt-issuer"), c.String("jwt-audience")))
+	}
+
+	if len(opts) == 0 {
+		return nil, nil
+	}
+
+	return auth.New(opts...)
+}
+
+// newLimiter returns the limiter shared by the HTTP and gRPC APIs.
+func newLimiter(c *cli.Context) *ratelimit.Limiter {
+	burst := c.Int("rate-limit-burst")
+
+	return ratelimit.New(ratelimit.Config{
+		Read:         ratelimit.Rate{PerSecond: c.Float64("rate-limit-read"), Burst: burst},
+		Write:        ratelimit.Rate{PerSecond: c.Float64("rate-limit-write"), Burst: burst},
+		AuthFailures: ratelimit.Rate{PerSecond: c.Float64("rate-limit-auth-failures"), Burst: burst},
+		MaxInFlight:  c.Int("max-in-flight"),
+		MaxStreams:   c.Int("max-streams"),
+	})
+}
+
+// newHealth returns the healthchecks shared by the /healthz endpoint and the
+// gRPC health service. The notifiers are checked only if present, and the
+// checks fail once the context is done.
+func newHealth(ctx context.Context, pgURL string, provider notifier.Notifier) (*health.Health, error) {
+	checks := []health.Config{
+		{
+			// not to be sent new requests while draining
+			Name:      "shutdown",
+			SkipOnErr: false,
+			Check: func(context.Context) error {
+				if ctx.Err() != nil {
+					return errors.New("shutting down")
+				}
+				return nil
+			},
+		},
+		{
 			Name:      "postgres",
 			Timeout:   defaultPGHealthTimeout,
 			SkipOnErr: false,
 			Check: pghealth.New(pghealth.Config{
 				DSN: pgURL,
 			}),
+		},
+	}
+
+	if provider != nil {
+		checks = append(checks, health.Config{
+			Name:      "notifications",
+			Timeout:   defaultPGHealthTimeout,
+			SkipOnErr: false,
+			Check: func(ctx context.Context) error {
+				return notifier.Check(ctx, provider)
+			},
+		})
+	}
+
+	h, err := health.New(
+		health.WithComponent(health.Component{
+			Name:    "userz",
+			Version: commit,
 		}),
+		health.WithChecks(checks...),
 	)
 	if err != nil {
-		out <- fmt.Errorf("cannot instantiate heathcheck endpoint: %w", err)
-		return out
+		return nil, fmt.Errorf("cannot instantiate healthchecks: %w", err)
 	}
 
+	return h, nil
+}
+
+// serveMetrics serves the healthchecks and the metrics in the background,
+// like serveHTTPApi.
+func serveMetrics(c *cli.Context, logger *zerolog.Logger, checks *health.Health, reloader *tlsutils.Reloader) (*http.Server, <-chan error) {
+	port := c.Int("metrics-port")
+
+	addr := fmt.Sprintf(":%d", port)
+
 	router := chi.NewRouter()
-	router.Method(http.MethodGet, "/healthz", healthHandler.Handler())
+	router.Method(http.MethodGet, "/healthz", checks.Handler())
 	router.Method(http.MethodGet, "/metrics", promhttp.Handler())
 
-	logger.Info().Msgf("Serving metrics on '%s'", addr)
+	logger.Info().Bool("tls", reloader != nil).Msgf("Serving metrics on '%s'", addr)
+
+	server := &http.Server{Addr: addr, Handler: router}
+
+	return server, serve(server, reloader)
+}
+
+// serve serves in the background, sending on the returned channel the error
+// of the server, unless it is shut down.
+func serve(server *http.Server, reloader *tlsutils.Reloader) <-chan error {
+	out := make(chan error, 1)
 
 	go func() {
-		out <- http.ListenAndServe(addr, router)
+		if err := listenAndServe(server, reloader); !errors.Is(err, http.ErrServerClosed) {
+			out <- err
+		}
 	}()
 
 	return out
 }
 
-func wrapWithNotifyingStore(ctx context.Context, wrapped userz.Store, pluginPath string) (userz.Store, error) {
-	plug, err := plugin.Open(pluginPath)
+// listenAndServe serves over TLS with the files of the reloader, if any, or
+// else in plaintext.
+func listenAndServe(server *http.Server, reloader *tlsutils.Reloader) error {
+	if reloader == nil {
+		return server.ListenAndServe()
+	}
+
+	server.TLSConfig = reloader.TLSConfig("h2", "http/1.1")
+
+	return server.ListenAndServeTLS("", "")
+}
+
+// newTLS returns the TLS of the endpoint, configured with the
+// --<endpoint>-cert, --<endpoint>-key and --<endpoint>-client-ca flags, and
+// reloaded as the files change until the context is done. It returns nil,
+// to serve in plaintext, if there is no certificate and
+// --<endpoint>-default-cert is not set.
+func newTLS(ctx context.Context, c *cli.Context, endpoint string) (*tlsutils.Reloader, error) {
+	config := tlsutils.Config{
+		CertFile:     c.Path(endpoint + "-cert"),
+		KeyFile:      c.Path(endpoint + "-key"),
+		ClientCAFile: c.Path(endpoint + "-client-ca"),
+		Default:      c.Bool(endpoint + "-default-cert"),
+	}
+
+	if config.CertFile == "" && config.KeyFile == "" && !config.Default {
+		if config.ClientCAFile != "" {
+			return nil, fmt.Errorf("the client CA of the %s endpoint needs its certificate", endpoint)
+		}
+		return nil, nil
+	}
+
+	reloader, err := tlsutils.NewReloader(config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("TLS of the %s endpoint: %w", endpoint, err)
 	}
 
-	sym, err := plug.Lookup("Provider")
+	go reloader.Watch(ctx, defaultTLSReloadInterval)
+
+	return reloader, nil
+}
+
+func wrapWithNotifyingStore(ctx context.Context, wrapped userz.Store, pool *pgxpool.Pool, events *notifier.Broadcaster, c *cli.Context) (userz.Store, notifier.Notifier, error) {
+	configs, err := parseNotifierOpts(c.StringSlice("notifier-opt"))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if _, ok := configs["plugin"]["path"]; !ok {
+		if configs["plugin"] == nil {
+			configs["plugin"] = make(map[string]string)
+		}
+		configs["plugin"]["path"] = c.Path("notification-plugin")
 	}
 
-	ref, ok := (sym).(*notifier.Notifier)
-	if !ok {
-		return nil, fmt.Errorf("Not a notifier: %T", ref)
+	changeFeed := c.Bool("pg-change-feed")
+
+	var notifiers []notifier.Notifier
+	for _, name := range c.StringSlice("notifier") {
+		if changeFeed && name == "pg" {
+			continue
+		}
+
+		n, err := notifier.New(name, configs[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		notifiers = append(notifiers, n)
 	}
 
-	provider := *ref
+	// the gRPC Watch is fed by the same notifications
+	notifiers = append(notifiers, events)
+
+	provider := combineNotifiers(notifiers)
 
 	if err := provider.Init(ctx); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// the notifiers whose health is to be checked
+	checked := provider
+
+	if changeFeed {
+		// the store publishes only on the postgres channel, while the
+		// configured notifiers are fed by the listener with the changes
+		// coming from every instance
+		pgConfig := configs["pg"]
+
+		publisher, err := notifier.New("pg", pgConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := publisher.Init(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		var opts []pg.ListenerOption
+		// the payloads are reduced to the ids if exceeding the size limit of
+		// pg_notify, so the rows are fetched unless told otherwise
+		if pgConfig["fetch"] != "false" {
+			opts = append(opts, pg.WithRowFetching(pool))
+		}
+
+		listener := pg.NewListener(pool, pgConfig["channel"], provider, opts...)
+		go listener.Run(ctx)
+
+		checked = notifier.NewMulti(publisher, provider)
+		provider = publisher
+	}
+
+	return notifying.NewNotifyingStore(wrapped, provider), checked, nil
+}
+
+func combineNotifiers(notifiers []notifier.Notifier) notifier.Notifier {
+	if len(notifiers) == 1 {
+		return notifiers[0]
+	}
+
+	return notifier.NewMulti(notifiers...)
+}
+
+// parseNotifierOpts groups options in the <notifier>.<key>=<value> form by
+// notifier.
+func parseNotifierOpts(opts []string) (map[string]map[string]string, error) {
+	configs := make(map[string]map[string]string)
+
+	for _, opt := range opts {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed notifier option, expected <notifier>.<key>=<value>: %s", opt)
+		}
+
+		name, key, ok := strings.Cut(key, ".")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("malformed notifier option, expected <notifier>.<key>=<value>: %s", opt)
+		}
+
+		if configs[name] == nil {
+			configs[name] = make(map[string]string)
+		}
+		configs[name][key] = value
 	}
 
-	return notifying.NewNotifyingStore(wrapped, provider), nil
+	return configs, nil
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz/internal/grpcutils"
+)
+
+func TestRecovered(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+
+	// the interceptors panic before the handlers are reached, even before
+	// the logger is in the context
+	unary := []grpc.UnaryServerInterceptor{
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			panic("boom")
+		},
+		grpcutils.UnaryLogger(logger),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			panic("boom")
+		},
+		grpcutils.StreamLogger(logger),
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(recovered(logger, unary, stream)...)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(err)
+	t.Cleanup(func() { conn.Close() })
+
+	client := healthpb.NewHealthClient(conn)
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(codes.Internal, status.Code(err))
+
+	watch, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(err)
+	_, err = watch.Recv()
+	assert.Equal(codes.Internal, status.Code(err))
+
+	assert.Contains(logs.String(), "Recovered from panic in gRPC handler")
+	assert.Contains(logs.String(), "/grpc.health.v1.Health/Check")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+// drainer is a server that stops accepting new requests and waits for those
+// in flight on Shutdown, and cuts them on Close, like http.Server.
+type drainer interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// grpcDrainer drains a gRPC server, its streams included.
+type grpcDrainer struct {
+	server *grpc.Server
+}
+
+func (d grpcDrainer) Shutdown(ctx context.Context) error {
+	return grpcutils.GracefulStop(ctx, d.server)
+}
+
+// Close is a no-op, as GracefulStop stops the server anyway.
+func (d grpcDrainer) Close() error {
+	return nil
+}
+
+// instance is what shutdown stops.
+type instance struct {
+	// markNotReady fails the healthchecks, for no new requests to be routed
+	// to the instance.
+	markNotReady func()
+	// preStopDelay is waited after marking the instance not ready, still
+	// serving, for the load balancers to notice.
+	preStopDelay time.Duration
+	// drainTimeout is how long the requests in flight are waited for.
+	drainTimeout time.Duration
+	// events, if any, end the Watch streams.
+	events *notifier.Broadcaster
+	// apis are drained together.
+	apis []drainer
+	// provider, if any, delivers the notifications still pending.
+	provider notifier.Notifier
+	metrics  drainer
+	// stopBackground stops the work in the background, which needs the
+	// pool.
+	stopBackground func()
+	pool           interface{ Close() }
+}
+
+// shutdown stops the instance, in order: it is marked not ready and, after
+// the pre-stop delay, the APIs stop accepting new requests and wait for
+// those in flight to finish, or else cut them after the drain timeout, the
+// notifications still pending are delivered within the same timeout and
+// finally the metrics server, the work in the background and the pool are
+// stopped. The Watch streams are ended as the draining starts, for the
+// clients to resume elsewhere.
+func shutdown(ctx context.Context, i *instance) {
+	logger := zerolog.Ctx(ctx)
+
+	i.markNotReady()
+
+	if i.preStopDelay > 0 {
+		logger.Info().Dur("delay", i.preStopDelay).Msg("Waiting before stopping")
+		select {
+		case <-time.After(i.preStopDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, i.drainTimeout)
+	defer cancel()
+
+	if i.events != nil {
+		i.events.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, api := range i.apis {
+		wg.Add(1)
+		go func(api drainer) {
+			defer wg.Done()
+
+			if err := api.Shutdown(ctx); err != nil {
+				logger.Warn().Err(err).Msg("Requests cut by the shutdown")
+				api.Close()
+			}
+		}(api)
+	}
+	wg.Wait()
+
+	if i.provider != nil {
+		if err := notifier.Flush(ctx, i.provider); err != nil {
+			logger.Err(err).Msg("Failed to flush the notifications")
+		}
+	}
+
+	if err := i.metrics.Shutdown(ctx); err != nil {
+		i.metrics.Close()
+	}
+
+	// the pool is closed last, after the work in the background is stopped
+	i.stopBackground()
+	i.pool.Close()
+}
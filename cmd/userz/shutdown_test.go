@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+// steps records the steps of the shutdown, in order.
+type steps struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (s *steps) record(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.names = append(s.names, name)
+}
+
+func (s *steps) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.names...)
+}
+
+// recordingDrainer records when it is drained, after stalling until the
+// context is done if stuck.
+type recordingDrainer struct {
+	name  string
+	steps *steps
+	stuck bool
+}
+
+func (d *recordingDrainer) Shutdown(ctx context.Context) error {
+	if d.stuck {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	d.steps.record(d.name + " drained")
+	return nil
+}
+
+func (d *recordingDrainer) Close() error {
+	d.steps.record(d.name + " cut")
+	return nil
+}
+
+type recordingProvider struct {
+	steps *steps
+}
+
+func (p *recordingProvider) Init(ctx context.Context) error {
+	return nil
+}
+
+func (p *recordingProvider) Notify(ctx context.Context, event notifier.NotificationEvent, metadata map[string]string) error {
+	return nil
+}
+
+func (p *recordingProvider) Flush(ctx context.Context) error {
+	p.steps.record("flushed")
+	return nil
+}
+
+type recordingPool struct {
+	steps *steps
+}
+
+func (p *recordingPool) Close() {
+	p.steps.record("pool closed")
+}
+
+func newInstance(s *steps, stuck bool) *instance {
+	return &instance{
+		markNotReady: func() { s.record("not ready") },
+		drainTimeout: time.Second,
+		apis: []drainer{
+			&recordingDrainer{name: "http", steps: s, stuck: stuck},
+			&recordingDrainer{name: "grpc", steps: s},
+		},
+		provider:       &recordingProvider{steps: s},
+		metrics:        &recordingDrainer{name: "metrics", steps: s, stuck: stuck},
+		stopBackground: func() { s.record("background stopped") },
+		pool:           &recordingPool{steps: s},
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("drained", func(t *testing.T) {
+		assert := assert.New(t)
+		s := &steps{}
+
+		shutdown(context.Background(), newInstance(s, false))
+
+		names := s.get()
+		if !assert.Len(names, 7) {
+			return
+		}
+		assert.Equal("not ready", names[0])
+		// the APIs are drained together
+		assert.ElementsMatch([]string{"http drained", "grpc drained"}, names[1:3])
+		assert.Equal([]string{"flushed", "metrics drained", "background stopped", "pool closed"}, names[3:])
+	})
+
+	t.Run("cut", func(t *testing.T) {
+		assert := assert.New(t)
+		s := &steps{}
+
+		i := newInstance(s, true)
+		i.drainTimeout = 100 * time.Millisecond
+
+		shutdown(context.Background(), i)
+
+		names := s.get()
+		if !assert.Len(names, 7) {
+			return
+		}
+		assert.Equal("not ready", names[0])
+		assert.ElementsMatch([]string{"http cut", "grpc drained"}, names[1:3])
+		// the rest is stopped anyway, the metrics server cut as well
+		assert.Equal([]string{"flushed", "metrics cut", "background stopped", "pool closed"}, names[3:])
+	})
+
+	t.Run("delayed", func(t *testing.T) {
+		assert := assert.New(t)
+		s := &steps{}
+
+		i := newInstance(s, false)
+		i.preStopDelay = 200 * time.Millisecond
+		i.drainTimeout = 100 * time.Millisecond
+		// still serving during the delay
+		i.markNotReady = func() {
+			s.record("not ready")
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				s.record("served")
+			}()
+		}
+
+		start := time.Now()
+		shutdown(context.Background(), i)
+
+		// the delay does not eat into the drain timeout
+		assert.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+		names := s.get()
+		if !assert.Len(names, 8) {
+			return
+		}
+		assert.Equal([]string{"not ready", "served"}, names[:2])
+		assert.ElementsMatch([]string{"http drained", "grpc drained"}, names[2:4])
+	})
+}
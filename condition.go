@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"reflect"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/constraints"
@@ -71,8 +72,105 @@ func (Cond[T]) Hash(string) (string, error) {
 	panic("Must override")
 }
 
+// Matcher is optionally implemented by the conditions able to tell, in
+// memory, whether a value satisfies them.
+type Matcher[T Conditionable] interface {
+	Match(value T) (bool, error)
+}
+
+var _ Matcher[string] = Cond[string]{}
+
+// Match tells whether the value satisfies the condition, as the backends
+// would: the strings are compared byte by byte, and the intervals of times
+// include their ends.
+func (c Cond[T]) Match(value T) (bool, error) {
+	if err := ValidateOp(c.Op, c.Value, c.Values...); err != nil {
+		return false, err
+	}
+
+	switch c.Op {
+	case OpEq:
+		return compare(value, c.Value) == 0, nil
+	case OpNe:
+		return compare(value, c.Value) != 0, nil
+	case OpGt:
+		return compare(value, c.Value) > 0, nil
+	case OpGe:
+		return compare(value, c.Value) >= 0, nil
+	case OpLt:
+		return compare(value, c.Value) < 0, nil
+	case OpLe:
+		return compare(value, c.Value) <= 0, nil
+	case OpInside:
+		if _, ok := any(value).(time.Time); ok {
+			return compare(value, c.Values[0]) >= 0 && compare(value, c.Values[1]) <= 0, nil
+		}
+
+		for _, v := range c.Values {
+			if compare(value, v) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case OpOutside:
+		if _, ok := any(value).(time.Time); ok {
+			return compare(value, c.Values[0]) <= 0 || compare(value, c.Values[1]) >= 0, nil
+		}
+
+		for _, v := range c.Values {
+			if compare(value, v) == 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	case OpBegins:
+		return strings.HasPrefix(fmt.Sprint(value), fmt.Sprint(c.Value)), nil
+	case OpEnds:
+		return strings.HasSuffix(fmt.Sprint(value), fmt.Sprint(c.Value)), nil
+	default:
+		return false, fmt.Errorf("unknown operation: %d", c.Op)
+	}
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+func compare[T Conditionable](a, b T) int {
+	if at, ok := any(a).(time.Time); ok {
+		bt := any(b).(time.Time)
+		return sign(at.Before(bt), at.After(bt))
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch va.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sign(va.Int() < vb.Int(), va.Int() > vb.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return sign(va.Uint() < vb.Uint(), va.Uint() > vb.Uint())
+	case reflect.Float32, reflect.Float64:
+		return sign(va.Float() < vb.Float(), va.Float() > vb.Float())
+	default:
+		return strings.Compare(va.String(), vb.String())
+	}
+}
+
+func sign(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
+
 type ReprCondition[T Conditionable] Cond[T]
 
+var _ Matcher[string] = &ReprCondition[string]{}
+
+func (c *ReprCondition[T]) Match(value T) (bool, error) {
+	return Cond[T](*c).Match(value)
+}
+
 var _ Condition[string] = &ReprCondition[string]{}
 
 func (c *ReprCondition[T]) Evaluate(field string) (result any, err error) {
@@ -106,3 +106,96 @@ func TestEvaluateTime(t *testing.T) {
 		})
 	}
 }
+
+func TestMatch(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	cases := []struct {
+		name     string
+		match    func() (bool, error)
+		expected bool
+	}{
+		{name: "eq", match: func() (bool, error) { return Cond[string]{Op: OpEq, Value: "a"}.Match("a") }, expected: true},
+		{name: "ne", match: func() (bool, error) { return Cond[string]{Op: OpNe, Value: "a"}.Match("a") }},
+		{name: "begins", match: func() (bool, error) { return Cond[string]{Op: OpBegins, Value: "ab"}.Match("abc") }, expected: true},
+		{name: "ends", match: func() (bool, error) { return Cond[string]{Op: OpEnds, Value: "ab"}.Match("abc") }},
+		{name: "inside", match: func() (bool, error) { return Cond[string]{Op: OpInside, Values: []string{"a", "b"}}.Match("b") }, expected: true},
+		{name: "outside", match: func() (bool, error) { return Cond[string]{Op: OpOutside, Values: []string{"a", "b"}}.Match("b") }},
+		{name: "gt", match: func() (bool, error) { return Cond[int]{Op: OpGt, Value: 1}.Match(2) }, expected: true},
+		{name: "le", match: func() (bool, error) { return Cond[int]{Op: OpLe, Value: 1}.Match(2) }},
+		{name: "time-ge", match: func() (bool, error) { return Cond[time.Time]{Op: OpGe, Value: start}.Match(start) }, expected: true},
+		{name: "time-inside", match: func() (bool, error) {
+			return Cond[time.Time]{Op: OpInside, Values: []time.Time{start, end}}.Match(end)
+		}, expected: true},
+		{name: "time-outside", match: func() (bool, error) {
+			return Cond[time.Time]{Op: OpOutside, Values: []time.Time{start, end}}.Match(start.Add(time.Minute))
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.match()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+
+	_, err := Cond[string]{Op: OpGt, Value: "a"}.Match("b")
+	assert.Error(t, err)
+}
+
+func TestFilterMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &User{Id: "1", NickName: "one", Email: "one@example.com", Country: "IT"}
+
+	filter, err := ParseFilter(map[string]string{"email": "$ @example.com", "country": "in (IT,FR)"})
+	require.NoError(t, err)
+
+	ok, err := filter.Match(user)
+	assert.NoError(err)
+	assert.True(ok)
+
+	filter.Id = "2"
+	ok, err = filter.Match(user)
+	assert.NoError(err)
+	assert.False(ok)
+
+	ok, err = (*Filter)(nil).Match(user)
+	assert.NoError(err)
+	assert.True(ok)
+
+	_, err = (&Filter{Email: &unmatchable{}}).Match(user)
+	assert.ErrorIs(err, ErrMatchUnsupported)
+}
+
+type unmatchable struct{}
+
+func (unmatchable) Evaluate(string) (any, error) { return nil, nil }
+
+func (unmatchable) Hash(string) (string, error) { return "", nil }
+
+func TestUserMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &User{
+		Id:        "1",
+		NickName:  "one",
+		Email:     "one@example.com",
+		Country:   "IT",
+		CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 1000, time.UTC),
+	}
+
+	metadata := map[string]string{"id": user.Id}
+	user.AddMetadata(metadata, "previous_")
+	assert.NotContains(metadata, "previous_first_name")
+	assert.NotContains(metadata, "previous_updated_at")
+
+	decoded, ok := UserFromMetadata(metadata, user.Id, "previous_")
+	assert.True(ok)
+	assert.Equal(user, decoded)
+
+	_, ok = UserFromMetadata(metadata, user.Id, "")
+	assert.False(ok)
+}
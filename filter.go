@@ -9,6 +9,10 @@ import (
 func (f *Filter) Hash() (string, error) {
 	var hashes string
 
+	if f.Id != "" {
+		hashes = fmt.Sprintf("%sid=%s", hashes, f.Id)
+	}
+
 	if f.FirstName != nil {
 		hash, err := f.FirstName.Hash("first_name")
 		if err != nil {
@@ -72,3 +76,59 @@ func Hash(str string) string {
 	sum := sha256.Sum256([]byte(str))
 	return fmt.Sprintf("%x", sum)
 }
+
+// Match tells whether the user satisfies the filter, evaluated in memory.
+// It returns ErrMatchUnsupported if any of the conditions does not
+// implement Matcher. A nil filter matches everyone.
+func (f *Filter) Match(user *User) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+
+	if f.Id != "" && f.Id != user.Id {
+		return false, nil
+	}
+
+	if ok, err := matchCondition(f.FirstName, user.FirstName); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.LastName, user.LastName); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.NickName, user.NickName); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.Email, user.Email); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.Country, user.Country); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.CreatedAt, user.CreatedAt); !ok || err != nil {
+		return false, err
+	}
+
+	if ok, err := matchCondition(f.UpdatedAt, user.UpdatedAt); !ok || err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func matchCondition[T Conditionable](cond Condition[T], value T) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+
+	matcher, ok := cond.(Matcher[T])
+	if !ok {
+		return false, ErrMatchUnsupported
+	}
+
+	return matcher.Match(value)
+}
@@ -3,7 +3,10 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -34,7 +37,23 @@ func (h *AddHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var userData userz.UserData
 	if err := json.NewDecoder(r.Body).Decode(&userData); err != nil {
 		logger.Err(err).Msg("Failure in decoding request body")
-		httputils.BadRequest(w, "Malformed request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+
+	errs := missingFields(&userData, "nickname", "email")
+	if !userData.SetsPassword() {
+		errs = append(errs, httputils.FieldError{Field: "password", Detail: "is mandatory"})
+	}
+	if len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Incomplete user")
+		httputils.BadRequest(w, r, "Incomplete user", errs...)
+		return
+	}
+
+	if errs := passwordErrors(&userData); len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Invalid password")
+		httputils.BadRequest(w, r, "Invalid password", errs...)
 		return
 	}
 
@@ -42,12 +61,23 @@ func (h *AddHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	newUser, err := h.store.Add(expiring, &userData)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if errors.Is(err, userz.ErrConflict) {
+		logger.Info().Err(err).Msg("User conflicting with another one")
+		httputils.Conflict(w, r, "A user with the same nickname or email already exists")
+		return
+	}
 	if err != nil {
 		logger.Err(err).Msg("Failure in adding the user")
-		httputils.ServerError(w, "Failure in adding the user in the store")
+		httputils.ServerError(w, r, "Failure in adding the user in the store")
 		return
 	}
 
 	logger.Info().Str("ID", newUser.Id).Msg("New user added")
-	httputils.Ok(w, newUser.Id)
+	location := strings.TrimRight(r.URL.Path, "/") + "/" + url.PathEscape(newUser.Id)
+	httputils.Created(w, location, newUser)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -12,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
 )
 
 func TestAddHandler(t *testing.T) {
@@ -44,10 +46,69 @@ func TestAddHandler(t *testing.T) {
 
 	router.ServeHTTP(w, req)
 	resp := w.Result()
-	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	assert.Equal("/1", resp.Header.Get("Location"))
 
-	var result string
+	var result userz.User
 	json.NewDecoder(resp.Body).Decode(&result)
-	assert.Equal(user.Id, result)
+	assert.Equal(user, &result)
 	assert.Equal(1, store.added)
+
+	// Incomplete user
+	req = httptest.NewRequest(http.MethodPut, localhost, strings.NewReader(`{"nickname": "jd"}`))
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+
+	var problem httputils.Problem
+	require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(http.StatusBadRequest, problem.Status)
+	assert.Equal("/", problem.Instance)
+	assert.Equal([]httputils.FieldError{
+		{Field: "email", Detail: "is mandatory"},
+		{Field: "password", Detail: "is mandatory"},
+	}, problem.Errors)
+	assert.Equal(1, store.added)
+
+	// Legacy password hash
+	req = httptest.NewRequest(http.MethodPut, localhost, strings.NewReader(
+		`{"nickname": "jd", "email": "jd@morgue.com", "password_hash": "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"}`,
+	))
+	w = httptest.NewRecorder()
+	store.data = []*userz.User{user}
+
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusCreated, w.Result().StatusCode)
+	assert.Equal(2, store.added)
+
+	for _, body := range []string{
+		`{"nickname": "jd", "email": "jd@morgue.com", "password_hash": "md5$unknown"}`,
+		`{"nickname": "jd", "email": "jd@morgue.com", "password": "passw0rd", "password_hash": "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"}`,
+	} {
+		req = httptest.NewRequest(http.MethodPut, localhost, strings.NewReader(body))
+		w = httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		resp = w.Result()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+		problem = httputils.Problem{}
+		require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+		require.Len(problem.Errors, 1)
+		assert.Equal("password_hash", problem.Errors[0].Field)
+	}
+	assert.Equal(2, store.added)
+
+	// Malformed body
+	req = httptest.NewRequest(http.MethodPut, localhost, strings.NewReader(`{`))
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
 }
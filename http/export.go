@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/bulk"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeCSV    = "text/csv"
+)
+
+var _ http.Handler = &ExportHandler{}
+
+// ExportHandler streams all the users matching the filter, as NDJSON or CSV
+// according to the Accept header, gzipped if the client accepts it. The
+// columns query parameter selects the fields to export.
+type ExportHandler struct {
+	store userz.Store
+}
+
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "ExportHandler").
+		Logger()
+
+	format, contentType := negotiateExport(r.Header.Get("Accept"))
+	if format == "" {
+		logger.Debug().Str("accept", r.Header.Get("Accept")).Msg("Unacceptable export format")
+		httputils.NotAcceptable(w, r, "The users can be exported as "+ContentTypeNDJSON+" or "+ContentTypeCSV)
+		return
+	}
+
+	columns, err := bulk.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		logger.Debug().Err(err).Msg("Unacceptable columns")
+		httputils.BadRequest(w, r, "Unacceptable columns", httputils.FieldError{Field: "columns", Detail: err.Error()})
+		return
+	}
+
+	var pageSize uint64
+	if v := r.URL.Query().Get("pageSize"); v != "" {
+		pageSize, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			logger.Debug().Msg("pageSize must be a non negative integer")
+			httputils.BadRequest(w, r, "pageSize must be a non negative integer")
+			return
+		}
+	}
+
+	filter, success := parseFilter(w, r, &logger)
+	if !success {
+		return
+	}
+
+	out := &exportWriter{w: w}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		w.Header().Set("Content-Encoding", "gzip")
+		out.gz = gzip.NewWriter(w)
+	}
+
+	count, err := bulk.Export(ctx, h.store, filter, out, bulk.ExportOptions{
+		Format:   format,
+		Columns:  columns,
+		PageSize: uint(pageSize),
+	})
+	if err != nil && !out.started {
+		w.Header().Del("Content-Encoding")
+
+		if errors.Is(err, userz.ErrForbidden) {
+			logger.Info().Msg("Operation not allowed")
+			httputils.Forbidden(w, r, "The operation is not allowed")
+			return
+		}
+
+		logger.Err(err).Msg("Failure in exporting the users")
+		httputils.ServerError(w, r, "Failure in exporting the users")
+		return
+	}
+	if err != nil {
+		// too late to tell the client, but for truncating the response
+		logger.Err(err).Uint("exported", count).Msg("Export interrupted")
+		panic(http.ErrAbortHandler)
+	}
+
+	if out.gz != nil {
+		if err := out.gz.Close(); err != nil {
+			logger.Err(err).Msg("Failure in closing the export")
+			return
+		}
+	}
+
+	logger.Info().Uint("exported", count).Msg("Users exported")
+}
+
+// exportWriter writes the export to the response, possibly gzipped,
+// flushing it to the client after every page.
+type exportWriter struct {
+	w       http.ResponseWriter
+	gz      *gzip.Writer
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.started = true
+
+	if e.gz != nil {
+		return e.gz.Write(p)
+	}
+
+	return e.w.Write(p)
+}
+
+func (e *exportWriter) Flush() error {
+	if e.gz != nil {
+		if err := e.gz.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// negotiateExport returns the format preferred in the Accept header, NDJSON
+// if missing, or nothing if none is acceptable.
+func negotiateExport(accept string) (bulk.Format, string) {
+	if strings.TrimSpace(accept) == "" {
+		return bulk.FormatNDJSON, ContentTypeNDJSON
+	}
+
+	var best bulk.Format
+	var bestType string
+	bestQ := 0.0
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		switch mediaType {
+		case ContentTypeNDJSON, "application/*", "*/*":
+			best, bestType, bestQ = bulk.FormatNDJSON, ContentTypeNDJSON, q
+		case ContentTypeCSV, "text/*":
+			best, bestType, bestQ = bulk.FormatCSV, ContentTypeCSV, q
+		}
+	}
+
+	return best, bestType
+}
+
+// acceptsGzip tells whether gzip is in the Accept-Encoding header, and not
+// refused with a zero quality.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+
+		params = strings.TrimSpace(params)
+		if !strings.HasPrefix(params, "q=") {
+			return true
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+		return err == nil && q > 0
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func newExportRouter(store *mockStore) chi.Router {
+	h := &ExportHandler{store}
+	router := chi.NewRouter()
+	router.Get("/export", h.ServeHTTP)
+
+	return router
+}
+
+func exportUsers() []*userz.User {
+	createdAt := time.Date(2022, 11, 20, 12, 0, 0, 0, time.UTC)
+
+	return []*userz.User{
+		{Id: "1", NickName: "jd", Email: "jd@morgue.com", Password: userz.Password("hash"), Country: "US", CreatedAt: createdAt},
+		{Id: "2", NickName: "mr", Email: "mr@morgue.com", Password: userz.Password("hash"), CreatedAt: createdAt},
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	router := newExportRouter(&mockStore{data: exportUsers()})
+
+	// NDJSON by default
+	req := httptest.NewRequest(http.MethodGet, localhost+"export?pageSize=1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(ContentTypeNDJSON, resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	assert.Equal(
+		`{"id":"1","first_name":"","last_name":"","nickname":"jd","email":"jd@morgue.com","country":"US","created_at":"2022-11-20T12:00:00Z","updated_at":null}`+"\n"+
+			`{"id":"2","first_name":"","last_name":"","nickname":"mr","email":"mr@morgue.com","country":"","created_at":"2022-11-20T12:00:00Z","updated_at":null}`+"\n",
+		string(body),
+	)
+	assert.NotContains(string(body), "hash")
+
+	// CSV, gzipped, with some columns
+	req = httptest.NewRequest(http.MethodGet, localhost+"export?columns=email,id", nil)
+	req.Header.Set("Accept", "application/json;q=0.9, text/csv")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(ContentTypeCSV, resp.Header.Get("Content-Type"))
+	assert.Equal("gzip", resp.Header.Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(resp.Body)
+	require.NoError(err)
+	body, err = io.ReadAll(gz)
+	require.NoError(err)
+	assert.Equal("email,id\njd@morgue.com,1\nmr@morgue.com,2\n", string(body))
+}
+
+func TestExportHandlerErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		target string
+		accept string
+		err    error
+		status int
+	}{
+		{"unacceptable format", "export", "application/xml", nil, http.StatusNotAcceptable},
+		{"unknown column", "export?columns=id,password", "", nil, http.StatusBadRequest},
+		{"forbidden", "export", "", userz.ErrForbidden, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			router := newExportRouter(&mockStore{err: c.err})
+
+			req := httptest.NewRequest(http.MethodGet, localhost+c.target, nil)
+			req.Header.Set("Accept", c.accept)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+			assert.Empty(resp.Header.Get("Content-Encoding"))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	defaultGetTimeout = 30 * time.Second
+)
+
+var _ http.Handler = &GetHandler{}
+
+// GetHandler returns a single user, by id. It is authorized as a page.
+type GetHandler struct {
+	store userz.Store
+}
+
+func (h *GetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "GetHandler").
+		Logger()
+
+	id := strings.Trim(chi.URLParam(r, "id"), "\"")
+	if id == "" {
+		httputils.BadRequest(w, r, "Missing user id in request url")
+		return
+	}
+
+	expiring, cancel := context.WithTimeout(ctx, defaultGetTimeout)
+	defer cancel()
+
+	users, _, err := h.store.Page(expiring, &userz.Filter{Id: id}, &userz.PageParams{
+		Size:  1,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Str("ID", id).Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if err != nil {
+		logger.Err(err).Str("ID", id).Msg("Failure in retrieving the user")
+		httputils.ServerError(w, r, "Failure in retrieving the user")
+		return
+	}
+
+	for _, user := range users {
+		if user.Id == id {
+			logger.Info().Str("ID", user.Id).Msg("User retrieved")
+			httputils.Ok(w, user)
+			return
+		}
+	}
+
+	logger.Warn().Str("ID", id).Msg("Missing user")
+	httputils.NotFound(w, r, "No user found")
+}
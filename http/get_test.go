@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func TestGetHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	user := &userz.User{
+		Id: "1",
+	}
+	store := &mockStore{data: []*userz.User{user}}
+	h := &GetHandler{store}
+	router := chi.NewRouter()
+	router.Get("/{id}", h.ServeHTTP)
+
+	// Correct request
+	req := httptest.NewRequest(http.MethodGet, localhost+"1", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	var result userz.User
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(user, &result)
+
+	assert.Equal(1, store.paged)
+	assert.Equal("1", store.pagedWith.Id)
+
+	// Missing user
+	req = httptest.NewRequest(http.MethodGet, localhost+"2", nil)
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+}
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/bulk"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+// maxImportSize is the size of the largest body accepted by ImportHandler.
+const maxImportSize = 64 << 20
+
+var _ http.Handler = &ImportHandler{}
+
+// ImportHandler adds in bulk the users in the body, as NDJSON or CSV
+// according to the Content-Type, replying with a report of the import. The
+// mode query parameter tells whether to refuse everything if any row is not
+// valid (all-or-nothing, the default) or to skip the invalid rows
+// (skip-invalid).
+type ImportHandler struct {
+	store userz.Store
+}
+
+func (h *ImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "ImportHandler").
+		Logger()
+
+	var format bulk.Format
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case ContentTypeNDJSON:
+		format = bulk.FormatNDJSON
+	case ContentTypeCSV:
+		format = bulk.FormatCSV
+	default:
+		logger.Debug().Str("contentType", mediaType).Msg("Unsupported import format")
+		w.Header().Set("Accept-Post", ContentTypeNDJSON+", "+ContentTypeCSV)
+		httputils.UnsupportedMediaType(w, r, "The users can be imported as "+ContentTypeNDJSON+" or "+ContentTypeCSV)
+		return
+	}
+
+	mode, err := bulk.ParseMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		logger.Debug().Err(err).Msg("Unacceptable mode")
+		httputils.BadRequest(w, r, "Unacceptable mode", httputils.FieldError{Field: "mode", Detail: err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	report, err := bulk.Import(ctx, h.store, body, bulk.ImportOptions{
+		Format: format,
+		Mode:   mode,
+	})
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		logger.Debug().Msg("Import too large")
+		httputils.RequestEntityTooLarge(w, r, fmt.Sprintf("The users to import can take up to %d bytes", maxImportSize))
+	case errors.Is(err, bulk.ErrMalformedFile):
+		logger.Debug().Err(err).Msg("Malformed import")
+		httputils.BadRequest(w, r, err.Error())
+	case errors.Is(err, bulk.ErrInvalidRows):
+		logger.Info().Uint("invalid", report.Invalid).Uint("total", report.Total).Msg("Import refused")
+		httputils.UnprocessableEntity(w, r,
+			fmt.Sprintf("%d of %d rows are not valid, none was imported", report.Invalid, report.Total),
+			rowErrors(report.Errors)...)
+	case errors.Is(err, userz.ErrConflict):
+		logger.Info().Err(err).Msg("Import conflicting with the existing users")
+		httputils.Conflict(w, r, "Some of the users already exist, none was imported")
+	case errors.Is(err, userz.ErrForbidden):
+		logger.Info().Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+	case err != nil:
+		logger.Err(err).Msg("Failure in importing the users")
+		httputils.ServerError(w, r, "Failure in importing the users")
+	default:
+		logger.Info().
+			Uint("imported", report.Imported).
+			Uint("invalid", report.Invalid).
+			Msg("Users imported")
+		httputils.Ok(w, report)
+	}
+}
+
+func rowErrors(errs []bulk.RowError) []httputils.FieldError {
+	fieldErrs := make([]httputils.FieldError, len(errs))
+	for i, err := range errs {
+		fieldErrs[i] = httputils.FieldError{Line: err.Line, Field: err.Field, Detail: err.Detail}
+	}
+
+	return fieldErrs
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/bulk"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const importNDJSON = `{"nickname":"jd","email":"jd@morgue.com","password":"secret"}
+{"nickname":"mr","email":"mr@morgue.com"}
+{"nickname":"jb","email":"jb@morgue.com","password":"secret"}
+`
+
+func newImportRouter(store *mockStore) chi.Router {
+	h := &ImportHandler{store}
+	router := chi.NewRouter()
+	router.Post("/import", h.ServeHTTP)
+
+	return router
+}
+
+func TestImportHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &mockStore{}
+	router := newImportRouter(store)
+
+	// all or nothing, by default
+	req := httptest.NewRequest(http.MethodPost, localhost+"import", strings.NewReader(importNDJSON))
+	req.Header.Set("Content-Type", ContentTypeNDJSON)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+
+	var problem httputils.Problem
+	require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal("1 of 3 rows are not valid, none was imported", problem.Detail)
+	assert.Equal([]httputils.FieldError{
+		{Line: 2, Field: "password", Detail: "missing"},
+	}, problem.Errors)
+	assert.Equal(0, store.added)
+
+	// skipping the invalid rows
+	req = httptest.NewRequest(http.MethodPost, localhost+"import?mode=skip-invalid", strings.NewReader(importNDJSON))
+	req.Header.Set("Content-Type", ContentTypeNDJSON)
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	var report bulk.ImportReport
+	require.NoError(json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(uint(3), report.Total)
+	assert.Equal(uint(2), report.Imported)
+	assert.Equal(uint(1), report.Invalid)
+	assert.Equal(2, store.added)
+
+	// CSV
+	req = httptest.NewRequest(http.MethodPost, localhost+"import", strings.NewReader("nickname,email,password\njd,jd@morgue.com,secret\n"))
+	req.Header.Set("Content-Type", ContentTypeCSV+"; charset=utf-8")
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Result().StatusCode)
+	assert.Equal(3, store.added)
+}
+
+func TestImportHandlerErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		err         error
+		status      int
+	}{
+		{"unsupported format", "import", "application/json", importNDJSON, nil, http.StatusUnsupportedMediaType},
+		{"unknown mode", "import?mode=some", ContentTypeNDJSON, importNDJSON, nil, http.StatusBadRequest},
+		{"unknown column", "import", ContentTypeCSV, "nickname,email,password,id\n", nil, http.StatusBadRequest},
+		{"too large", "import", ContentTypeNDJSON, strings.Repeat("\n", maxImportSize+1), nil, http.StatusRequestEntityTooLarge},
+		{"conflict", "import?mode=skip-invalid", ContentTypeNDJSON, importNDJSON, userz.ErrConflict, http.StatusConflict},
+		{"forbidden", "import?mode=skip-invalid", ContentTypeNDJSON, importNDJSON, userz.ErrForbidden, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			router := newImportRouter(&mockStore{err: c.err})
+
+			req := httptest.NewRequest(http.MethodPost, localhost+c.target, strings.NewReader(c.body))
+			req.Header.Set("Content-Type", c.contentType)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/leophys/userz/internal/httputils"
+)
+
+// openAPIBase is the base route of the paths in the OpenAPI document.
+const openAPIBase = "/api"
+
+// openAPIDocument is the OpenAPI 3.1 document of the REST API, describing
+// every route registered in New.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// OpenAPI returns the OpenAPI 3.1 document of the REST API.
+func OpenAPI() []byte {
+	return append([]byte(nil), openAPIDocument...)
+}
+
+var (
+	_ http.Handler = &OpenAPIHandler{}
+	_ http.Handler = &DocsHandler{}
+)
+
+// OpenAPIHandler serves the OpenAPI document of the REST API.
+type OpenAPIHandler struct{}
+
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", httputils.ContentTypeJSON)
+	w.Write(openAPIDocument)
+}
+
+// docsPage renders the OpenAPI document next to it with Redoc, loaded from
+// its CDN.
+const docsPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>userz API</title>
+    <meta charset="utf-8"/>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+  </head>
+  <body>
+    <redoc spec-url="openapi.json"></redoc>
+    <script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"></script>
+  </body>
+</html>
+`
+
+// DocsHandler serves a page documenting the REST API, to be mounted next to
+// the OpenAPI document (e.g. at /api/docs).
+type DocsHandler struct{}
+
+func (h *DocsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	// the document is served even to those not authenticated
+	refuse := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httputils.Unauthorized(w, r, "authentication required")
+		})
+	}
+	router := New("/api", &mockStore{}, nil, refuse)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeJSON, resp.Header.Get("Content-Type"))
+
+	var doc map[string]any
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal("3.1.0", doc["openapi"])
+
+	req = httptest.NewRequest(http.MethodGet, "/api?pageSize=1&offset=0", nil)
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Result().StatusCode)
+}
+
+// TestOpenAPIRoutes fails if a route is registered in New and not
+// documented, or the other way around.
+func TestOpenAPIRoutes(t *testing.T) {
+	require := require.New(t)
+
+	var routes []string
+	err := chi.Walk(New("/api", &mockStore{}, nil), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	require.NoError(err)
+
+	v, err := NewValidator("/api")
+	require.NoError(err)
+
+	var documented []string
+	for _, op := range v.operations {
+		documented = append(documented, op.method+" "+op.path)
+	}
+
+	sort.Strings(routes)
+	sort.Strings(documented)
+	require.Equal(routes, documented)
+}
+
+func openAPIUsers() []*userz.User {
+	createdAt := time.Date(2022, 11, 20, 12, 0, 0, 0, time.UTC)
+
+	var users []*userz.User
+	for _, id := range []string{"1", "2", "3"} {
+		users = append(users, &userz.User{
+			Id:        id,
+			FirstName: "John",
+			LastName:  "Doe",
+			NickName:  "jd" + id,
+			Email:     "jd" + id + "@morgue.com",
+			Country:   "US",
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		})
+	}
+
+	return users
+}
+
+// TestOpenAPIResponses fails if a handler replies something not documented,
+// checking the requests too, unless meant to be invalid. Every documented
+// operation has to be exercised.
+func TestOpenAPIResponses(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		err         error
+		invalid     bool
+		status      int
+	}{
+		{"page", http.MethodGet, "/api?pageSize=2&offset=0&order_by=nick_name&country=%3DUS", "", "", nil, false, http.StatusOK},
+		{"page without offset", http.MethodGet, "/api?pageSize=2", "", "", nil, true, http.StatusBadRequest},
+		{"page forbidden", http.MethodGet, "/api?pageSize=2&offset=0", "", "", userz.ErrForbidden, false, http.StatusForbidden},
+		{"page failure", http.MethodGet, "/api?pageSize=2&offset=0", "", "", errors.New("boom"), false, http.StatusInternalServerError},
+		{"add", http.MethodPut, "/api", "application/json", `{"nickname": "jd", "email": "jd@morgue.com", "password": "passw0rd"}`, nil, false, http.StatusCreated},
+		{"add conflict", http.MethodPut, "/api", "application/json", `{"nickname": "jd", "email": "jd@morgue.com", "password": "passw0rd"}`, userz.ErrConflict, false, http.StatusConflict},
+		{"add incomplete", http.MethodPut, "/api", "", `{"nickname": "jd"}`, nil, true, http.StatusBadRequest},
+		{"export", http.MethodGet, "/api/export?columns=id,email", "", "", nil, false, http.StatusOK},
+		{"export unacceptable columns", http.MethodGet, "/api/export?columns=password", "", "", nil, false, http.StatusBadRequest},
+		{"import", http.MethodPost, "/api/import", ContentTypeCSV, "nickname,email,password\njd,jd@morgue.com,secret\n", nil, false, http.StatusOK},
+		{"import invalid", http.MethodPost, "/api/import", ContentTypeNDJSON, importNDJSON, nil, false, http.StatusUnprocessableEntity},
+		{"import conflict", http.MethodPost, "/api/import", ContentTypeNDJSON, `{"nickname":"jd","email":"jd@morgue.com","password":"secret"}`, userz.ErrConflict, false, http.StatusConflict},
+		{"import unsupported", http.MethodPost, "/api/import", "application/json", "{}", nil, true, http.StatusUnsupportedMediaType},
+		{"verify", http.MethodPost, "/api/verify", "application/json", `{"login": "jd", "password": "passw0rd"}`, nil, false, http.StatusOK},
+		{"verify invalid credentials", http.MethodPost, "/api/verify", "application/json", `{"login": "jd", "password": "passw0rd"}`, userz.ErrInvalidCredentials, false, http.StatusUnauthorized},
+		{"openapi", http.MethodGet, "/api/openapi.json", "", "", nil, false, http.StatusOK},
+		{"get", http.MethodGet, "/api/1", "", "", nil, false, http.StatusOK},
+		{"get missing", http.MethodGet, "/api/9", "", "", nil, false, http.StatusNotFound},
+		{"get forbidden", http.MethodGet, "/api/1", "", "", userz.ErrForbidden, false, http.StatusForbidden},
+		{"update", http.MethodPost, "/api/1", "application/json", `{"country": "IT"}`, nil, false, http.StatusOK},
+		{"update missing", http.MethodPost, "/api/1", "application/json", `{"country": "IT"}`, userz.ErrNotFound, false, http.StatusNotFound},
+		{"update invalid id", http.MethodPost, "/api/1", "application/json", `{"country": "IT"}`, userz.ErrInvalidId, false, http.StatusBadRequest},
+		{"update conflict", http.MethodPost, "/api/1", "application/json", `{"nickname": "jd"}`, userz.ErrConflict, false, http.StatusConflict},
+		{"update failure", http.MethodPost, "/api/1", "application/json", `{"country": "IT"}`, errors.New("boom"), false, http.StatusInternalServerError},
+		{"patch", http.MethodPatch, "/api/1", MergePatchType, `{"country": null}`, nil, false, http.StatusOK},
+		{"patch conflict", http.MethodPatch, "/api/1", MergePatchType, `{"email": "jd@morgue.com"}`, userz.ErrConflict, false, http.StatusConflict},
+		{"patch unsupported", http.MethodPatch, "/api/1", "application/json", `{"country": null}`, nil, true, http.StatusUnsupportedMediaType},
+		{"replace", http.MethodPut, "/api/1", "application/json", `{"nickname": "jd", "email": "jd@morgue.com"}`, nil, false, http.StatusOK},
+		{"replace conflict", http.MethodPut, "/api/1", "application/json", `{"nickname": "jd", "email": "jd@morgue.com"}`, userz.ErrConflict, false, http.StatusConflict},
+		{"remove", http.MethodDelete, "/api/1", "", "", nil, false, http.StatusOK},
+		{"remove missing", http.MethodDelete, "/api/1", "", "", userz.ErrNotFound, false, http.StatusNotFound},
+		{"remove forbidden", http.MethodDelete, "/api/1", "", "", userz.ErrForbidden, false, http.StatusForbidden},
+	}
+
+	v, err := NewValidator("/api")
+	require.NoError(t, err)
+
+	exercised := make(map[*operation]bool)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			router := New("/api", &mockStore{data: openAPIUsers(), err: c.err}, nil)
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+
+			op, _ := v.find(req)
+			if !assert.NotNil(op, "undocumented operation") {
+				return
+			}
+			exercised[op] = true
+
+			if c.invalid {
+				assert.Error(v.ValidateRequest(req))
+			} else {
+				assert.NoError(v.ValidateRequest(req))
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.NoError(v.ValidateResponse(req, resp.StatusCode, resp.Header, w.Body.Bytes()))
+		})
+	}
+
+	for _, op := range v.operations {
+		assert.True(t, exercised[op], "%s %s not exercised", op.method, op.path)
+	}
+}
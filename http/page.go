@@ -2,8 +2,11 @@ package httpapi
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -47,17 +50,20 @@ func (h *PageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	expiring, cancel := context.WithTimeout(ctx, defaultPageTimeout)
 	defer cancel()
 
-	users, err := h.store.Page(expiring, filter, params)
+	users, pagination, err := h.store.Page(expiring, filter, params)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
 	if err != nil {
 		logger.Err(err).Msg("Failure in retrieving the users")
-		httputils.ServerError(w, "Failure in retrieving the users")
+		httputils.ServerError(w, r, "Failure in retrieving the users")
 		return
 	}
 
 	if users == nil {
-		logger.Debug().Msg("No users found")
-		httputils.NotFound(w, "No more pages")
-		return
+		users = []*userz.User{}
 	}
 
 	var ids []string
@@ -65,40 +71,81 @@ func (h *PageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ids = append(ids, u.Id)
 	}
 	logger.Info().Strs("ID", ids).Msg("Users retrieved")
+
+	setPaginationHeaders(w, r, params, pagination)
 	httputils.Ok(w, users)
 }
 
+// setPaginationHeaders describes the pagination with the X-Total-Count,
+// X-Total-Pages, X-Page-Size and X-Offset headers, and links to the other
+// pages in the Link header (RFC 8288).
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, params *userz.PageParams, pagination userz.PaginationData) {
+	header := w.Header()
+	header.Set("X-Total-Count", strconv.FormatUint(uint64(pagination.TotalElements), 10))
+	header.Set("X-Total-Pages", strconv.FormatUint(uint64(pagination.TotalPages), 10))
+	header.Set("X-Page-Size", strconv.FormatUint(uint64(params.Size), 10))
+	header.Set("X-Offset", strconv.FormatUint(uint64(params.Offset), 10))
+
+	link := func(offset uint, rel string) string {
+		query := r.URL.Query()
+		query.Set("offset", strconv.FormatUint(uint64(offset), 10))
+
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(0, "first")}
+	if params.Size > 0 {
+		if params.Offset > 0 {
+			prev := uint(0)
+			if params.Offset > params.Size {
+				prev = params.Offset - params.Size
+			}
+			links = append(links, link(prev, "prev"))
+		}
+
+		if params.Offset+params.Size < pagination.TotalElements {
+			links = append(links, link(params.Offset+params.Size, "next"))
+		}
+
+		if pagination.TotalPages > 0 {
+			links = append(links, link((pagination.TotalPages-1)*params.Size, "last"))
+		}
+	}
+
+	header.Set("Link", strings.Join(links, ", "))
+}
+
 func parsePageParams(w http.ResponseWriter, r *http.Request, logger *zerolog.Logger) *userz.PageParams {
 	pageSizeStr := r.URL.Query().Get("pageSize")
 	if pageSizeStr == "" {
 		logger.Debug().Msg("Missing pageSize in request url")
-		httputils.BadRequest(w, "Missing pageSize in request url")
+		httputils.BadRequest(w, r, "Missing pageSize in request url")
 		return nil
 	}
 	pageSize, err := strconv.ParseUint(pageSizeStr, 10, 32)
 	if err != nil {
 		logger.Debug().Msg("pageSize must be a non negative integer")
-		httputils.BadRequest(w, "pageSize must be a non negative integer")
+		httputils.BadRequest(w, r, "pageSize must be a non negative integer")
 		return nil
 	}
 
 	offsetStr := r.URL.Query().Get("offset")
 	if offsetStr == "" {
 		logger.Debug().Msg("Missing offset in request url")
-		httputils.BadRequest(w, "Missing offset in request url")
+		httputils.BadRequest(w, r, "Missing offset in request url")
 		return nil
 	}
 	offset, err := strconv.ParseUint(offsetStr, 10, 32)
 	if err != nil {
 		logger.Debug().Msg("offset must be a non negative integer")
-		httputils.BadRequest(w, "offset must be a non negative integer")
+		httputils.BadRequest(w, r, "offset must be a non negative integer")
 		return nil
 	}
 
 	ord, err := userz.ParseOrder(r.URL.Query().Get("order_by"), r.URL.Query().Get("order_dir"))
 	if err != nil {
 		logger.Info().Err(err).Msg("Unacceptable order_by")
-		httputils.BadRequest(w, "unacceptable order_by")
+		httputils.BadRequest(w, r, "unacceptable order_by")
 		return nil
 	}
 
@@ -121,7 +168,8 @@ func parseFilter(w http.ResponseWriter, r *http.Request, logger *zerolog.Logger)
 	}
 
 	if v := r.URL.Query().Get("nickname"); v != "" {
-		params["nickname"] = v
+		// named after the gRPC field
+		params["nick_name"] = v
 	}
 
 	if v := r.URL.Query().Get("email"); v != "" {
@@ -143,7 +191,7 @@ func parseFilter(w http.ResponseWriter, r *http.Request, logger *zerolog.Logger)
 	filter, err := userz.ParseFilter(params)
 	if err != nil {
 		logger.Info().Err(err).Msg("Malformed filter")
-		httputils.BadRequest(w, "Malformed filter")
+		httputils.BadRequest(w, r, "Malformed filter")
 		return nil, false
 	}
 
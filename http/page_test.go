@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -31,7 +32,7 @@ func TestPageHandler(t *testing.T) {
 	router := chi.NewRouter()
 	router.Get("/", h.ServeHTTP)
 
-    // get the first page
+	// get the first page
 	req := httptest.NewRequest(http.MethodGet, localhost+"?pageSize=3&offset=0", nil)
 	w := httptest.NewRecorder()
 
@@ -47,7 +48,7 @@ func TestPageHandler(t *testing.T) {
 	json.NewDecoder(resp.Body).Decode(&result)
 	assert.Equal(users[:3], result)
 
-    // get the second page
+	// get the second page
 	req = httptest.NewRequest(http.MethodGet, localhost+"?pageSize=3&offset=3", nil)
 	w = httptest.NewRecorder()
 
@@ -59,17 +60,107 @@ func TestPageHandler(t *testing.T) {
 		t.Log(string(body))
 	}
 
-    result = nil
+	result = nil
 	json.NewDecoder(resp.Body).Decode(&result)
-    assert.Equal(users[3:], result)
+	assert.Equal(users[3:], result)
 
-    // try to get to a third page, get 404
+	assert.Equal("6", resp.Header.Get("X-Total-Count"))
+	assert.Equal("2", resp.Header.Get("X-Total-Pages"))
+	assert.Equal("3", resp.Header.Get("X-Page-Size"))
+	assert.Equal("3", resp.Header.Get("X-Offset"))
+	assert.Equal(
+		`</?offset=0&pageSize=3>; rel="first", </?offset=0&pageSize=3>; rel="prev", </?offset=3&pageSize=3>; rel="last"`,
+		resp.Header.Get("Link"),
+	)
+
+	// get past the last page, get an empty one
 	req = httptest.NewRequest(http.MethodGet, localhost+"?pageSize=3&offset=6", nil)
 	w = httptest.NewRecorder()
 
 	router.ServeHTTP(w, req)
 	resp = w.Result()
-    require.Equal(http.StatusNotFound, resp.StatusCode)
+	require.Equal(http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	assert.JSONEq("[]", string(body))
+	assert.Equal("6", resp.Header.Get("X-Total-Count"))
 
 	assert.Equal(3, store.paged)
 }
+
+func TestPageHandlerLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	var users []*userz.User
+	for i := 0; i < 10; i++ {
+		users = append(users, &userz.User{Id: strconv.Itoa(i)})
+	}
+	store := &mockStore{data: users}
+	h := &PageHandler{store}
+	router := chi.NewRouter()
+	router.Get("/api", h.ServeHTTP)
+
+	req := httptest.NewRequest(http.MethodGet, localhost+"api?pageSize=3&offset=4&country=%3DIT", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("4", resp.Header.Get("X-Total-Pages"))
+	assert.Equal(
+		`</api?country=%3DIT&offset=0&pageSize=3>; rel="first", `+
+			`</api?country=%3DIT&offset=1&pageSize=3>; rel="prev", `+
+			`</api?country=%3DIT&offset=7&pageSize=3>; rel="next", `+
+			`</api?country=%3DIT&offset=9&pageSize=3>; rel="last"`,
+		resp.Header.Get("Link"),
+	)
+}
+
+func TestPageHandlerCount(t *testing.T) {
+	assert := assert.New(t)
+
+	var users []*userz.User
+	for i := 0; i < 10; i++ {
+		users = append(users, &userz.User{Id: strconv.Itoa(i)})
+	}
+	store := &mockStore{data: users}
+	h := &PageHandler{store}
+	router := chi.NewRouter()
+	router.Get("/api", h.ServeHTTP)
+
+	// the page is empty, yet the users are counted
+	req := httptest.NewRequest(http.MethodGet, localhost+"api?pageSize=0&offset=0", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("10", resp.Header.Get("X-Total-Count"))
+	assert.Equal("0", resp.Header.Get("X-Total-Pages"))
+	assert.Equal(`</api?offset=0&pageSize=0>; rel="first"`, resp.Header.Get("Link"))
+
+	var result []*userz.User
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	assert.Empty(result)
+}
+
+func TestPageHandlerFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &mockStore{}
+	h := &PageHandler{store}
+	router := chi.NewRouter()
+	router.Get("/", h.ServeHTTP)
+
+	req := httptest.NewRequest(http.MethodGet, localhost+"?pageSize=3&offset=0&nickname=%3Djd&country=%3DIT", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Result().StatusCode)
+	require.NotNil(store.pagedWith)
+	assert.NotNil(store.pagedWith.NickName)
+	assert.NotNil(store.pagedWith.Country)
+	assert.Nil(store.pagedWith.Email)
+}
@@ -0,0 +1,209 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	defaultPatchTimeout = 30 * time.Second
+	// MergePatchType is the media type of the JSON Merge Patch (RFC 7396).
+	MergePatchType = "application/merge-patch+json"
+)
+
+var _ http.Handler = &PatchHandler{}
+
+// dataFields are the fields of the user data, by their JSON name.
+var dataFields = map[string]func(*userz.UserData) *string{
+	"first_name":    func(d *userz.UserData) *string { return &d.FirstName },
+	"last_name":     func(d *userz.UserData) *string { return &d.LastName },
+	"nickname":      func(d *userz.UserData) *string { return &d.NickName },
+	"email":         func(d *userz.UserData) *string { return &d.Email },
+	"password":      func(d *userz.UserData) *string { return &d.Password },
+	"password_hash": func(d *userz.UserData) *string { return &d.PasswordHash },
+	"country":       func(d *userz.UserData) *string { return &d.Country },
+}
+
+// PatchHandler updates a user with a JSON Merge Patch: the fields set to a
+// value are changed, those set to null are cleared (only the optional
+// ones) and the missing ones are left untouched.
+type PatchHandler struct {
+	store userz.Store
+}
+
+func (h *PatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "PatchHandler").
+		Logger()
+
+	id := strings.Trim(chi.URLParam(r, "id"), "\"")
+	if id == "" {
+		httputils.BadRequest(w, r, "Missing user id in request url")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != MergePatchType {
+		logger.Debug().Str("contentType", mediaType).Msg("Unsupported patch format")
+		w.Header().Set("Accept-Patch", MergePatchType)
+		httputils.UnsupportedMediaType(w, r, "The patch must be a "+MergePatchType)
+		return
+	}
+
+	userData, errs, err := decodeMergePatch(r.Body)
+	if err != nil {
+		logger.Err(err).Msg("Failure in decoding request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+	if len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Invalid patch")
+		httputils.BadRequest(w, r, "Invalid patch", errs...)
+		return
+	}
+
+	expiring, cancel := context.WithTimeout(ctx, defaultPatchTimeout)
+	defer cancel()
+
+	user, err := h.store.Update(expiring, id, userData)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Str("ID", id).Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if errors.Is(err, userz.ErrNotFound) {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+	if errors.Is(err, userz.ErrInvalidId) {
+		logger.Debug().Err(err).Str("ID", id).Msg("Invalid user id")
+		httputils.BadRequest(w, r, "Invalid user id")
+		return
+	}
+	if errors.Is(err, userz.ErrConflict) {
+		logger.Info().Err(err).Str("ID", id).Msg("Patch conflicting with another user")
+		httputils.Conflict(w, r, "A user with the same nickname or email already exists")
+		return
+	}
+	if err != nil {
+		logger.Err(err).Str("ID", id).Msg("Failure in patching the user")
+		httputils.ServerError(w, r, "Failure in patching the user")
+		return
+	}
+	if user == nil {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+
+	logger.Info().Str("ID", user.Id).Msg("User patched")
+	httputils.Ok(w, user)
+}
+
+// decodeMergePatch translates a JSON Merge Patch to the data for the
+// update, or to the errors of its fields.
+func decodeMergePatch(body io.Reader) (*userz.UserData, []httputils.FieldError, error) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&patch); err != nil {
+		return nil, nil, err
+	}
+	if patch == nil {
+		return nil, nil, errors.New("the patch is not an object")
+	}
+
+	data := &userz.UserData{}
+	var errs []httputils.FieldError
+	for name, raw := range patch {
+		target, ok := dataFields[name]
+		if !ok {
+			errs = append(errs, httputils.FieldError{Field: name, Detail: "cannot be patched"})
+			continue
+		}
+
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if !isOptional(name) {
+				errs = append(errs, httputils.FieldError{Field: name, Detail: "cannot be cleared"})
+				continue
+			}
+
+			data.Clear = append(data.Clear, userz.Field(name))
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			errs = append(errs, httputils.FieldError{Field: name, Detail: "must be a string"})
+			continue
+		}
+		if value == "" {
+			errs = append(errs, httputils.FieldError{Field: name, Detail: "cannot be empty, use null to clear it"})
+			continue
+		}
+
+		*target(data) = value
+	}
+
+	errs = append(errs, passwordErrors(data)...)
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+
+	return data, errs, nil
+}
+
+func isOptional(name string) bool {
+	for _, field := range userz.OptionalFields {
+		if string(field) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// missingFields returns an error for each of the given fields that is empty.
+func missingFields(data *userz.UserData, names ...string) []httputils.FieldError {
+	var errs []httputils.FieldError
+	for _, name := range names {
+		if *dataFields[name](data) == "" {
+			errs = append(errs, httputils.FieldError{Field: name, Detail: "is mandatory"})
+		}
+	}
+
+	return errs
+}
+
+// passwordErrors returns an error if the password is given both in
+// plaintext and already hashed, or if the hash is not in a recognised
+// format.
+func passwordErrors(data *userz.UserData) []httputils.FieldError {
+	if data.PasswordHash == "" {
+		return nil
+	}
+
+	if data.Password != "" {
+		return []httputils.FieldError{{Field: "password_hash", Detail: "cannot be given along with password"}}
+	}
+
+	if _, err := userz.ParsePasswordHash(data.PasswordHash); err != nil {
+		return []httputils.FieldError{{Field: "password_hash", Detail: err.Error()}}
+	}
+
+	return nil
+}
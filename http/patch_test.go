@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func TestPatchHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	user := &userz.User{
+		Id:       "1",
+		NickName: "jd",
+		Email:    "jd@morgue.com",
+	}
+	store := &mockStore{data: []*userz.User{user}}
+	h := &PatchHandler{store}
+	router := chi.NewRouter()
+	router.Patch("/{id}", h.ServeHTTP)
+
+	patch := func(body, contentType string) *http.Response {
+		req := httptest.NewRequest(http.MethodPatch, localhost+"1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// Wrong media type
+	resp := patch(`{"country": null}`, "application/json")
+	assert.Equal(http.StatusUnsupportedMediaType, resp.StatusCode)
+	assert.Equal(MergePatchType, resp.Header.Get("Accept-Patch"))
+
+	// Invalid patches
+	for _, body := range []string{`[]`, `null`, `{`} {
+		resp = patch(body, MergePatchType)
+		assert.Equal(http.StatusBadRequest, resp.StatusCode, body)
+	}
+
+	resp = patch(`{"id": "2", "email": null, "country": 1, "last_name": ""}`, MergePatchType)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+
+	var problem httputils.Problem
+	require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal([]httputils.FieldError{
+		{Field: "country", Detail: "must be a string"},
+		{Field: "email", Detail: "cannot be cleared"},
+		{Field: "id", Detail: "cannot be patched"},
+		{Field: "last_name", Detail: "cannot be empty, use null to clear it"},
+	}, problem.Errors)
+	assert.Equal(0, store.updated)
+
+	// Correct patch
+	resp = patch(`{"country": null, "last_name": null, "email": "john@morgue.com"}`, MergePatchType+"; charset=utf-8")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	var result userz.User
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(user, &result)
+
+	assert.Equal(1, store.updated)
+	require.NotNil(store.updatedWith)
+	assert.Equal("john@morgue.com", store.updatedWith.Email)
+	assert.Empty(store.updatedWith.NickName)
+	assert.ElementsMatch([]userz.Field{userz.FieldCountry, userz.FieldLastName}, store.updatedWith.Clear)
+}
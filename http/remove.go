@@ -2,6 +2,7 @@ package httpapi
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -32,7 +33,7 @@ func (h *RemoveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	id := strings.Trim(chi.URLParam(r, "id"), "\"")
 	if id == "" {
-		httputils.BadRequest(w, "Missing user id in request url")
+		httputils.BadRequest(w, r, "Missing user id in request url")
 		return
 	}
 
@@ -40,9 +41,30 @@ func (h *RemoveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	user, err := h.store.Remove(expiring, id)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Str("ID", id).Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if errors.Is(err, userz.ErrNotFound) {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+	if errors.Is(err, userz.ErrInvalidId) {
+		logger.Debug().Err(err).Str("ID", id).Msg("Invalid user id")
+		httputils.BadRequest(w, r, "Invalid user id")
+		return
+	}
 	if err != nil {
 		logger.Err(err).Str("ID", id).Msg("Failure in removing the user")
-		httputils.ServerError(w, "Failure in removing the user")
+		httputils.ServerError(w, r, "Failure in removing the user")
+		return
+	}
+
+	if user == nil {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
 		return
 	}
 
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
 )
 
 func TestRemoveHandler(t *testing.T) {
@@ -44,4 +45,14 @@ func TestRemoveHandler(t *testing.T) {
 	assert.Equal(user, &result)
 
 	assert.Equal(1, store.removed)
+
+	// Missing user
+	store.data = []*userz.User{nil}
+	req = httptest.NewRequest(http.MethodDelete, localhost+"2", nil)
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
 }
@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	defaultReplaceTimeout = 30 * time.Second
+)
+
+var _ http.Handler = &ReplaceHandler{}
+
+// ReplaceHandler replaces a user with the one in the body: the optional
+// fields missing from it are cleared. The password, which is never
+// returned, is changed only if given.
+type ReplaceHandler struct {
+	store userz.Store
+}
+
+func (h *ReplaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "ReplaceHandler").
+		Logger()
+
+	id := strings.Trim(chi.URLParam(r, "id"), "\"")
+	if id == "" {
+		httputils.BadRequest(w, r, "Missing user id in request url")
+		return
+	}
+
+	var userData userz.UserData
+	if err := json.NewDecoder(r.Body).Decode(&userData); err != nil {
+		logger.Err(err).Msg("Failure in decoding request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+
+	if errs := missingFields(&userData, "nickname", "email"); len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Incomplete user")
+		httputils.BadRequest(w, r, "Incomplete user", errs...)
+		return
+	}
+
+	if errs := passwordErrors(&userData); len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Invalid password")
+		httputils.BadRequest(w, r, "Invalid password", errs...)
+		return
+	}
+
+	values := map[userz.Field]string{
+		userz.FieldFirstName: userData.FirstName,
+		userz.FieldLastName:  userData.LastName,
+		userz.FieldCountry:   userData.Country,
+	}
+	for _, field := range userz.OptionalFields {
+		if values[field] == "" {
+			userData.Clear = append(userData.Clear, field)
+		}
+	}
+
+	expiring, cancel := context.WithTimeout(ctx, defaultReplaceTimeout)
+	defer cancel()
+
+	user, err := h.store.Update(expiring, id, &userData)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Str("ID", id).Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if errors.Is(err, userz.ErrNotFound) {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+	if errors.Is(err, userz.ErrInvalidId) {
+		logger.Debug().Err(err).Str("ID", id).Msg("Invalid user id")
+		httputils.BadRequest(w, r, "Invalid user id")
+		return
+	}
+	if errors.Is(err, userz.ErrConflict) {
+		logger.Info().Err(err).Str("ID", id).Msg("Replacement conflicting with another user")
+		httputils.Conflict(w, r, "A user with the same nickname or email already exists")
+		return
+	}
+	if err != nil {
+		logger.Err(err).Str("ID", id).Msg("Failure in replacing the user")
+		httputils.ServerError(w, r, "Failure in replacing the user")
+		return
+	}
+	if user == nil {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+
+	logger.Info().Str("ID", user.Id).Msg("User replaced")
+	httputils.Ok(w, user)
+}
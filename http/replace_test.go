@@ -0,0 +1,46 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+)
+
+func TestReplaceHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &mockStore{data: []*userz.User{{Id: "1"}}}
+	h := &ReplaceHandler{store}
+	router := chi.NewRouter()
+	router.Put("/{id}", h.ServeHTTP)
+
+	replace := func(body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPut, localhost+"1", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// Incomplete user
+	resp := replace(`{"nickname": "jd"}`)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(0, store.updated)
+
+	// Correct request
+	resp = replace(`{"nickname": "jd", "email": "jd@morgue.com", "last_name": "Doe"}`)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	assert.Equal(1, store.updated)
+	require.NotNil(store.updatedWith)
+	assert.Equal("Doe", store.updatedWith.LastName)
+	assert.ElementsMatch([]userz.Field{userz.FieldFirstName, userz.FieldCountry}, store.updatedWith.Clear)
+}
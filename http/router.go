@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -8,28 +9,70 @@ import (
 
 	"github.com/leophys/userz"
 	"github.com/leophys/userz/internal/httputils"
+	"github.com/leophys/userz/internal/ratelimit"
 )
 
-func New(baseRoute string, store userz.Store, logger *zerolog.Logger) chi.Router {
+// New returns the router of the REST API, described by the OpenAPI document
+// served at /openapi.json. The middlewares, e.g. for the authentication, are
+// applied after the logging one, to all the routes but the document.
+func New(baseRoute string, store userz.Store, logger *zerolog.Logger, middlewares ...func(http.Handler) http.Handler) chi.Router {
 	router := chi.NewRouter()
 
 	if logger != nil {
 		router.Use(httputils.LoggerMiddleware(*logger))
 	}
 
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httputils.NotFound(w, r, "No such resource")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		httputils.WriteProblem(w, r, &httputils.Problem{Status: http.StatusMethodNotAllowed})
+	})
+
 	base := strings.TrimRight(baseRoute, "/")
 
+	openAPI := &OpenAPIHandler{}
+	router.Get(base+"/openapi.json", openAPI.ServeHTTP)
+
+	router.Group(func(router chi.Router) {
+		router.Use(middlewares...)
+		routeUsers(router, base, store)
+	})
+
+	return router
+}
+
+// routeUsers registers the handlers of the users.
+func routeUsers(router chi.Router, base string, store userz.Store) {
 	page := &PageHandler{store}
 	router.Get(base, page.ServeHTTP)
 
+	// the exports last as long as the users, so they are capped apart from
+	// the other requests in flight
+	export := &ExportHandler{store}
+	router.Get(base+"/export", ratelimit.Streaming(export).ServeHTTP)
+
+	importer := &ImportHandler{store}
+	router.Post(base+"/import", importer.ServeHTTP)
+
+	verify := &VerifyHandler{store}
+	router.Post(base+"/verify", verify.ServeHTTP)
+
 	add := &AddHandler{store}
 	router.Put(base, add.ServeHTTP)
 
+	get := &GetHandler{store}
+	router.Get(base+"/{id}", get.ServeHTTP)
+
 	update := &UpdateHandler{store}
 	router.Post(base+"/{id}", update.ServeHTTP)
 
+	patch := &PatchHandler{store}
+	router.Patch(base+"/{id}", patch.ServeHTTP)
+
+	replace := &ReplaceHandler{store}
+	router.Put(base+"/{id}", replace.ServeHTTP)
+
 	remove := &RemoveHandler{store}
 	router.Delete(base+"/{id}", remove.ServeHTTP)
-
-	return router
 }
@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func TestRouterProblems(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		err    error
+		status int
+	}{
+		{"unknown path", http.MethodGet, "/other", "", nil, http.StatusNotFound},
+		{"unknown method", http.MethodPost, "/api", "", nil, http.StatusMethodNotAllowed},
+		{"bad page size", http.MethodGet, "/api?pageSize=a&offset=0", "", nil, http.StatusBadRequest},
+		{"forbidden", http.MethodDelete, "/api/1", "", userz.ErrForbidden, http.StatusForbidden},
+		{"store failure", http.MethodPost, "/api/1", `{"country": "IT"}`, errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			router := New("/api", &mockStore{err: c.err}, nil)
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+
+			var problem httputils.Problem
+			require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(httputils.ProblemTypeDefault, problem.Type)
+			assert.Equal(http.StatusText(c.status), problem.Title)
+			assert.Equal(c.status, problem.Status)
+			assert.Equal(req.URL.Path, problem.Instance)
+		})
+	}
+}
+
+func TestRouterStoreErrors(t *testing.T) {
+	const user = `{"nickname": "jd", "email": "jd@example.com", "password": "passw0rd1"}`
+
+	notFound := fmt.Errorf("%w: no rows", userz.ErrNotFound)
+	invalidId := fmt.Errorf("%w: invalid length", userz.ErrInvalidId)
+	conflict := fmt.Errorf("%w: Key (nickname)=(jd) already exists.", userz.ErrConflict)
+
+	cases := []struct {
+		name   string
+		method string
+		target string
+		err    error
+		status int
+	}{
+		{"add conflict", http.MethodPut, "/api", conflict, http.StatusConflict},
+		{"update not found", http.MethodPost, "/api/1", notFound, http.StatusNotFound},
+		{"update invalid id", http.MethodPost, "/api/1", invalidId, http.StatusBadRequest},
+		{"update conflict", http.MethodPost, "/api/1", conflict, http.StatusConflict},
+		{"patch not found", http.MethodPatch, "/api/1", notFound, http.StatusNotFound},
+		{"patch invalid id", http.MethodPatch, "/api/1", invalidId, http.StatusBadRequest},
+		{"patch conflict", http.MethodPatch, "/api/1", conflict, http.StatusConflict},
+		{"replace not found", http.MethodPut, "/api/1", notFound, http.StatusNotFound},
+		{"replace invalid id", http.MethodPut, "/api/1", invalidId, http.StatusBadRequest},
+		{"replace conflict", http.MethodPut, "/api/1", conflict, http.StatusConflict},
+		{"remove not found", http.MethodDelete, "/api/1", notFound, http.StatusNotFound},
+		{"remove invalid id", http.MethodDelete, "/api/1", invalidId, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			router := New("/api", &mockStore{err: c.err}, nil)
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(user))
+			req.Header.Set("Content-Type", MergePatchType)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+		})
+	}
+}
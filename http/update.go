@@ -3,6 +3,7 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -33,14 +34,20 @@ func (h *UpdateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	id := strings.Trim(chi.URLParam(r, "id"), "\"")
 	if id == "" {
-		httputils.BadRequest(w, "Missing user id in request url")
+		httputils.BadRequest(w, r, "Missing user id in request url")
 		return
 	}
 
 	var userData userz.UserData
 	if err := json.NewDecoder(r.Body).Decode(&userData); err != nil {
 		logger.Err(err).Msg("Failure in decoding request body")
-		httputils.BadRequest(w, "Malformed request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+
+	if errs := passwordErrors(&userData); len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Invalid password")
+		httputils.BadRequest(w, r, "Invalid password", errs...)
 		return
 	}
 
@@ -48,14 +55,34 @@ func (h *UpdateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	user, err := h.store.Update(expiring, id, &userData)
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Str("ID", id).Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if errors.Is(err, userz.ErrNotFound) {
+		logger.Warn().Str("ID", id).Msg("Missing user")
+		httputils.NotFound(w, r, "No user found")
+		return
+	}
+	if errors.Is(err, userz.ErrInvalidId) {
+		logger.Debug().Err(err).Str("ID", id).Msg("Invalid user id")
+		httputils.BadRequest(w, r, "Invalid user id")
+		return
+	}
+	if errors.Is(err, userz.ErrConflict) {
+		logger.Info().Err(err).Str("ID", id).Msg("Update conflicting with another user")
+		httputils.Conflict(w, r, "A user with the same nickname or email already exists")
+		return
+	}
 	if err != nil {
 		logger.Err(err).Str("ID", id).Msg("Failure in updating the user")
-		httputils.ServerError(w, "Failure in updating the user")
+		httputils.ServerError(w, r, "Failure in updating the user")
 		return
 	}
 	if user == nil {
 		logger.Warn().Err(err).Str("ID", id).Msg("Missing user")
-		httputils.NotFound(w, "No user found")
+		httputils.NotFound(w, r, "No user found")
 		return
 	}
 
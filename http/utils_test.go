@@ -17,17 +17,45 @@ type mockStore struct {
 	paged   int
 
 	data []*userz.User
+	// updatedWith is the data of the last update
+	updatedWith *userz.UserData
+	// pagedWith is the filter of the last page
+	pagedWith *userz.Filter
+	// err, if set, is returned by every method
+	err error
 }
 
 func (s *mockStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
 	s.added++
+	if s.err != nil {
+		return nil, s.err
+	}
 	u := s.data[0]
 	s.data = s.data[1:]
 	return u, nil
 }
 
+func (s *mockStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.added += len(users)
+	return uint(len(users)), nil
+}
+
+func (s *mockStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.data[0], nil
+}
+
 func (s *mockStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
 	s.updated++
+	s.updatedWith = user
+	if s.err != nil {
+		return nil, s.err
+	}
 	u := s.data[0]
 	s.data = s.data[1:]
 	return u, nil
@@ -35,21 +63,55 @@ func (s *mockStore) Update(ctx context.Context, id string, user *userz.UserData)
 
 func (s *mockStore) Remove(ctx context.Context, id string) (*userz.User, error) {
 	s.removed++
+	if s.err != nil {
+		return nil, s.err
+	}
 	u := s.data[0]
 	s.data = s.data[1:]
 	return u, nil
 }
 
 func (s *mockStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
-	return nil, nil
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &mockIterator{data: s.data, pageSize: pageSize}, nil
 }
 
-func (s *mockStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, error) {
+type mockIterator struct {
+	data     []*userz.User
+	pageSize uint
+}
+
+func (i *mockIterator) Len() userz.PaginationData {
+	return userz.NewPaginationData(uint(len(i.data)), i.pageSize)
+}
+
+func (i *mockIterator) Next(ctx context.Context) ([]*userz.User, error) {
+	if len(i.data) == 0 {
+		return nil, userz.ErrNoMorePages
+	}
+	page := i.data
+	if uint(len(page)) > i.pageSize {
+		page = page[:i.pageSize]
+	}
+	i.data = i.data[len(page):]
+	return page, nil
+}
+
+func (s *mockStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
 	s.paged++
-	if uint(len(s.data)) < params.Size {
-		return nil, nil
+	s.pagedWith = filter
+	if s.err != nil {
+		return nil, userz.PaginationData{}, s.err
+	}
+	pagination := userz.NewPaginationData(uint(len(s.data)), params.Size)
+	if params.Offset >= uint(len(s.data)) {
+		return nil, pagination, nil
+	}
+	users := s.data[params.Offset:]
+	if uint(len(users)) > params.Size {
+		users = users[:params.Size]
 	}
-	users := s.data[0:params.Size]
-	s.data = s.data[params.Size:]
-	return users, nil
+	return users, pagination, nil
 }
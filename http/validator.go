@@ -0,0 +1,650 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	// openAPIURL identifies the OpenAPI document among the schemas.
+	openAPIURL = "mem:///openapi.json"
+	// maxValidatedBodySize is the size of the largest JSON body validated.
+	maxValidatedBodySize = 1 << 20
+)
+
+var (
+	// ErrUnsupportedMediaType is returned by Validator.ValidateRequest when
+	// the Content-Type of the body is not among the documented ones.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrBodyTooLarge is returned by Validator.ValidateRequest when the JSON
+	// body is too large to be validated.
+	ErrBodyTooLarge = errors.New("body too large to be validated")
+)
+
+// ValidationError tells why a request or a response does not match the
+// OpenAPI document.
+type ValidationError struct {
+	Errors []httputils.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		if err.Field == "" {
+			msgs[i] = err.Detail
+		} else {
+			msgs[i] = err.Field + ": " + err.Detail
+		}
+	}
+
+	return "not matching the API specification: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) fail(field, detail string) {
+	e.Errors = append(e.Errors, httputils.FieldError{Field: field, Detail: detail})
+}
+
+func (e *ValidationError) failSchema(prefix string, err error) {
+	var schemaErr *jsonschema.ValidationError
+	if !errors.As(err, &schemaErr) {
+		e.fail(prefix, err.Error())
+		return
+	}
+
+	for _, leaf := range leaves(schemaErr) {
+		field := strings.TrimPrefix(leaf.InstanceLocation, "/")
+		if prefix != "" {
+			field = strings.TrimSuffix(prefix+"/"+field, "/")
+		}
+		e.fail(field, leaf.Message)
+	}
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// leaves returns the innermost causes of the schema error.
+func leaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	var all []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		all = append(all, leaves(cause)...)
+	}
+
+	return all
+}
+
+// Validator checks the requests and the responses of the REST API against
+// its OpenAPI document. The requests not matching any operation in the
+// document are left to the router.
+type Validator struct {
+	operations []*operation
+}
+
+// operation is a method on a path of the document.
+type operation struct {
+	method   string
+	path     string
+	segments []string
+	params   []*parameter
+	body     *content
+	// responses are by status code, or default
+	responses map[string]*response
+}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	// integer tells to parse the value as such before validating it
+	integer bool
+	schema  *jsonschema.Schema
+}
+
+type response struct {
+	headers []string
+	content *content
+}
+
+// content is the media types of a body, with the schemas of the JSON ones.
+type content struct {
+	required bool
+	schemas  map[string]*jsonschema.Schema
+}
+
+func (c *content) accepts(mediaType string) bool {
+	_, ok := c.schemas[mediaType]
+	return ok
+}
+
+func (c *content) mediaTypes() []string {
+	types := make([]string, 0, len(c.schemas))
+	for mediaType := range c.schemas {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// NewValidator returns a validator for the REST API served at baseRoute.
+func NewValidator(baseRoute string) (*Validator, error) {
+	return newValidator(baseRoute, openAPIDocument)
+}
+
+func newValidator(baseRoute string, document []byte) (*Validator, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("malformed OpenAPI document: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource(openAPIURL, bytes.NewReader(document)); err != nil {
+		return nil, err
+	}
+
+	l := &loader{doc: doc, compiler: compiler}
+	base := strings.TrimRight(baseRoute, "/")
+
+	paths, _ := doc["paths"].(map[string]any)
+	v := &Validator{}
+	for path, item := range paths {
+		methods, _ := item.(map[string]any)
+		for method, node := range methods {
+			ptr := pointer("paths", path, method)
+			op, err := l.operation(strings.ToUpper(method), node, ptr)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+
+			op.path = base + strings.TrimPrefix(path, openAPIBase)
+			op.segments = strings.Split(op.path, "/")
+			v.operations = append(v.operations, op)
+		}
+	}
+
+	return v, nil
+}
+
+// loader reads the operations from the document, compiling their schemas.
+type loader struct {
+	doc      map[string]any
+	compiler *jsonschema.Compiler
+}
+
+func (l *loader) operation(method string, node any, ptr string) (*operation, error) {
+	object, ptr, err := l.resolve(node, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &operation{method: method, responses: make(map[string]*response)}
+
+	params, _ := object["parameters"].([]any)
+	for i, node := range params {
+		param, err := l.parameter(node, ptr+"/parameters/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		op.params = append(op.params, param)
+	}
+
+	if node, ok := object["requestBody"]; ok {
+		if op.body, err = l.content(node, ptr+"/requestBody"); err != nil {
+			return nil, err
+		}
+	}
+
+	responses, _ := object["responses"].(map[string]any)
+	for status, node := range responses {
+		resp, err := l.response(node, pointer(ptr, "responses", status))
+		if err != nil {
+			return nil, err
+		}
+		op.responses[status] = resp
+	}
+
+	return op, nil
+}
+
+func (l *loader) parameter(node any, ptr string) (*parameter, error) {
+	object, ptr, err := l.resolve(node, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	param := &parameter{}
+	param.name, _ = object["name"].(string)
+	param.in, _ = object["in"].(string)
+	param.required, _ = object["required"].(bool)
+
+	schema, schemaPtr, err := l.resolve(object["schema"], ptr+"/schema")
+	if err != nil {
+		return nil, err
+	}
+	param.integer = schema["type"] == "integer"
+
+	if param.schema, err = l.compiler.Compile(openAPIURL + "#" + schemaPtr); err != nil {
+		return nil, err
+	}
+
+	return param, nil
+}
+
+func (l *loader) response(node any, ptr string) (*response, error) {
+	object, ptr, err := l.resolve(node, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &response{}
+
+	headers, _ := object["headers"].(map[string]any)
+	for name, node := range headers {
+		header, _, err := l.resolve(node, pointer(ptr, "headers", name))
+		if err != nil {
+			return nil, err
+		}
+		if required, _ := header["required"].(bool); required {
+			resp.headers = append(resp.headers, name)
+		}
+	}
+
+	if _, ok := object["content"]; ok {
+		if resp.content, err = l.content(object, ptr); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// content reads the content of a request body or of a response.
+func (l *loader) content(node any, ptr string) (*content, error) {
+	object, ptr, err := l.resolve(node, ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &content{schemas: make(map[string]*jsonschema.Schema)}
+	c.required, _ = object["required"].(bool)
+
+	types, _ := object["content"].(map[string]any)
+	for mediaType := range types {
+		c.schemas[mediaType] = nil
+		if !isJSON(mediaType) {
+			continue
+		}
+
+		schemaPtr := pointer(ptr, "content", mediaType, "schema")
+		if c.schemas[mediaType], err = l.compiler.Compile(openAPIURL + "#" + schemaPtr); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// resolve follows the reference in the node, if any, returning the object
+// found and its location in the document.
+func (l *loader) resolve(node any, ptr string) (map[string]any, string, error) {
+	object, ok := node.(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("%s is not an object", ptr)
+	}
+
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return object, ptr, nil
+	}
+
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, "", fmt.Errorf("unsupported reference %q", ref)
+	}
+
+	var found any = l.doc
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		parent, ok := found.(map[string]any)
+		if !ok {
+			return nil, "", fmt.Errorf("dangling reference %q", ref)
+		}
+		if found, ok = parent[token]; !ok {
+			return nil, "", fmt.Errorf("dangling reference %q", ref)
+		}
+	}
+
+	return l.resolve(found, strings.TrimPrefix(ref, "#"))
+}
+
+// pointer joins the tokens in a JSON pointer, escaped to be used as the
+// fragment of a URL.
+func pointer(tokens ...string) string {
+	var ptr strings.Builder
+	for i, token := range tokens {
+		if i == 0 && strings.HasPrefix(token, "/") {
+			// already a pointer
+			ptr.WriteString(token)
+			continue
+		}
+
+		token = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+		ptr.WriteString("/" + url.PathEscape(token))
+	}
+
+	return ptr.String()
+}
+
+// isJSON tells whether the media type is JSON, or based on it.
+func isJSON(mediaType string) bool {
+	return mediaType == httputils.ContentTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// find returns the operation matching the request, preferring the paths
+// with fewer parameters, along with the values of the parameters.
+func (v *Validator) find(r *http.Request) (*operation, map[string]string) {
+	segments := strings.Split(r.URL.Path, "/")
+
+	var found *operation
+	var foundParams map[string]string
+	for _, op := range v.operations {
+		if op.method != r.Method || len(op.segments) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		for i, segment := range op.segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				params[segment[1:len(segment)-1]] = segments[i]
+				continue
+			}
+			if segment != segments[i] {
+				params = nil
+				break
+			}
+		}
+
+		if params != nil && (found == nil || len(params) < len(foundParams)) {
+			found, foundParams = op, params
+		}
+	}
+
+	return found, foundParams
+}
+
+// ValidateRequest checks the parameters and the body of the request
+// against the operation it matches. The JSON body is read and replaced
+// with a copy, to be read again.
+func (v *Validator) ValidateRequest(r *http.Request) error {
+	op, pathParams := v.find(r)
+	if op == nil {
+		return nil
+	}
+
+	errs := &ValidationError{}
+
+	query := r.URL.Query()
+	for _, param := range op.params {
+		var value string
+		var ok bool
+		switch param.in {
+		case "path":
+			value, ok = pathParams[param.name]
+		case "query":
+			ok = query.Has(param.name)
+			value = query.Get(param.name)
+		case "header":
+			value = r.Header.Get(param.name)
+			ok = value != ""
+		}
+
+		if !ok {
+			if param.required {
+				errs.fail(param.name, "missing")
+			}
+			continue
+		}
+
+		var instance any = value
+		if param.integer {
+			if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+				instance = json.Number(value)
+			}
+		}
+
+		if err := param.schema.Validate(instance); err != nil {
+			errs.failSchema(param.name, err)
+		}
+	}
+
+	if op.body == nil {
+		return errs.err()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "" && op.body.accepts(httputils.ContentTypeJSON) {
+		// the handlers do not insist on it
+		mediaType = httputils.ContentTypeJSON
+	}
+	if !op.body.accepts(mediaType) {
+		return fmt.Errorf("%w %q, expected one of %s", ErrUnsupportedMediaType, mediaType, strings.Join(op.body.mediaTypes(), ", "))
+	}
+
+	schema := op.body.schemas[mediaType]
+	if schema == nil {
+		return errs.err()
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBodySize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxValidatedBodySize {
+		return ErrBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.body.required {
+			errs.fail("", "missing body")
+		}
+		return errs.err()
+	}
+
+	instance, err := decodeJSON(body)
+	if err != nil {
+		errs.fail("", "malformed body")
+		return errs.err()
+	}
+
+	if err := schema.Validate(instance); err != nil {
+		errs.failSchema("", err)
+	}
+
+	return errs.err()
+}
+
+// ValidateResponse checks the status, the headers and the body of the
+// response to the request against the operation it matches. The body is
+// validated only if JSON, and can be nil to skip it.
+func (v *Validator) ValidateResponse(r *http.Request, status int, header http.Header, body []byte) error {
+	op, _ := v.find(r)
+	if op == nil {
+		return nil
+	}
+
+	resp, ok := op.responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = op.responses[fmt.Sprintf("%dXX", status/100)]
+	}
+	if !ok {
+		resp, ok = op.responses["default"]
+	}
+	if !ok {
+		return &ValidationError{Errors: []httputils.FieldError{{Detail: fmt.Sprintf("undocumented status %d", status)}}}
+	}
+
+	errs := &ValidationError{}
+
+	for _, name := range resp.headers {
+		if header.Get(name) == "" {
+			errs.fail(name, "missing header")
+		}
+	}
+
+	if resp.content == nil {
+		return errs.err()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if !resp.content.accepts(mediaType) {
+		errs.fail("Content-Type", fmt.Sprintf("%q, expected one of %s", mediaType, strings.Join(resp.content.mediaTypes(), ", ")))
+		return errs.err()
+	}
+
+	schema := resp.content.schemas[mediaType]
+	if schema == nil || body == nil {
+		return errs.err()
+	}
+
+	instance, err := decodeJSON(body)
+	if err != nil {
+		errs.fail("", "malformed body")
+		return errs.err()
+	}
+
+	if err := schema.Validate(instance); err != nil {
+		errs.failSchema("", err)
+	}
+
+	return errs.err()
+}
+
+func decodeJSON(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var instance any
+	if err := decoder.Decode(&instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+// Middleware refuses the requests not matching the OpenAPI document, and
+// logs the responses not matching it, which are sent anyway.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+
+		err := v.ValidateRequest(r)
+
+		var invalid *ValidationError
+		switch {
+		case errors.Is(err, ErrUnsupportedMediaType):
+			logger.Debug().Err(err).Msg("Request not matching the API specification")
+			httputils.UnsupportedMediaType(w, r, err.Error())
+			return
+		case errors.Is(err, ErrBodyTooLarge):
+			logger.Debug().Err(err).Msg("Request not matching the API specification")
+			httputils.RequestEntityTooLarge(w, r, fmt.Sprintf("The body can take up to %d bytes", maxValidatedBodySize))
+			return
+		case errors.As(err, &invalid):
+			logger.Debug().Interface("errors", invalid.Errors).Msg("Request not matching the API specification")
+			httputils.BadRequest(w, r, "The request does not match the API specification", invalid.Errors...)
+			return
+		case err != nil:
+			logger.Err(err).Msg("Failure in validating the request")
+			httputils.BadRequest(w, r, "Malformed request")
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if err := v.ValidateResponse(r, recorder.statusCode(), w.Header(), recorder.body()); err != nil {
+			logger.Warn().Err(err).Str("path", r.URL.Path).Msg("Response not matching the API specification")
+		}
+	})
+}
+
+// responseRecorder keeps the status of the response, and a copy of the
+// body if JSON.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    *bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header().Get("Content-Type"))
+		if isJSON(mediaType) && r.Header().Get("Content-Encoding") == "" {
+			r.buf = &bytes.Buffer{}
+		}
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	n, err := r.ResponseWriter.Write(p)
+	if r.buf != nil {
+		r.buf.Write(p[:n])
+	}
+
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+func (r *responseRecorder) body() []byte {
+	if r.buf == nil {
+		return nil
+	}
+
+	return r.buf.Bytes()
+}
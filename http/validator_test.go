@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func TestValidatorMiddleware(t *testing.T) {
+	v, err := NewValidator("/api/")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		errs        []httputils.FieldError
+	}{
+		{"missing parameter", http.MethodGet, "/api?offset=0", "", "", http.StatusBadRequest, []httputils.FieldError{
+			{Field: "pageSize", Detail: "missing"},
+		}},
+		{"wrong parameter", http.MethodGet, "/api?pageSize=a&offset=0&order_dir=UP", "", "", http.StatusBadRequest, []httputils.FieldError{
+			{Field: "pageSize", Detail: "expected integer, but got string"},
+			{Field: "order_dir", Detail: `value must be one of "ASC", "DESC"`},
+		}},
+		{"wrong body", http.MethodPost, "/api/1", "application/json", `{"country": 1}`, http.StatusBadRequest, []httputils.FieldError{
+			{Field: "country", Detail: "expected string, but got number"},
+		}},
+		{"malformed body", http.MethodPost, "/api/verify", "application/json", `{`, http.StatusBadRequest, []httputils.FieldError{
+			{Detail: "malformed body"},
+		}},
+		{"wrong media type", http.MethodPatch, "/api/1", "application/json", `{}`, http.StatusUnsupportedMediaType, nil},
+		{"valid", http.MethodPatch, "/api/1", MergePatchType, `{"country": null}`, http.StatusOK, nil},
+		{"undocumented", http.MethodGet, "/other", "", "", http.StatusNotFound, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			store := &mockStore{data: openAPIUsers()}
+			router := New("/api", store, nil, v.Middleware)
+
+			req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			require.Equal(c.status, resp.StatusCode)
+			if c.status == http.StatusOK {
+				assert.Equal(1, store.updated)
+				return
+			}
+			assert.Zero(store.updated)
+
+			var problem httputils.Problem
+			require.NoError(json.NewDecoder(resp.Body).Decode(&problem))
+			assert.ElementsMatch(c.errs, problem.Errors)
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v, err := NewValidator("/api")
+	require.NoError(err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/1", nil)
+	header := http.Header{"Content-Type": []string{httputils.ContentTypeJSON}}
+
+	user, err := json.Marshal(openAPIUsers()[0])
+	require.NoError(err)
+	assert.NoError(v.ValidateResponse(req, http.StatusOK, header, user))
+	// the body is not checked
+	assert.NoError(v.ValidateResponse(req, http.StatusOK, header, nil))
+
+	err = v.ValidateResponse(req, http.StatusOK, header, []byte(`{"id": 1, "nick_name": "jd"}`))
+	var invalid *ValidationError
+	require.ErrorAs(err, &invalid)
+	assert.Contains(invalid.Errors, httputils.FieldError{Field: "id", Detail: "expected string, but got number"})
+
+	err = v.ValidateResponse(req, http.StatusTeapot, header, nil)
+	require.ErrorAs(err, &invalid)
+	assert.Equal([]httputils.FieldError{{Detail: "undocumented status 418"}}, invalid.Errors)
+
+	err = v.ValidateResponse(req, http.StatusOK, http.Header{"Content-Type": []string{ContentTypeCSV}}, nil)
+	require.ErrorAs(err, &invalid)
+	assert.Equal("Content-Type", invalid.Errors[0].Field)
+
+	// the location of the new user is mandatory
+	req = httptest.NewRequest(http.MethodPut, "/api", nil)
+	err = v.ValidateResponse(req, http.StatusCreated, header, user)
+	require.ErrorAs(err, &invalid)
+	assert.Equal([]httputils.FieldError{{Field: "Location", Detail: "missing header"}}, invalid.Errors)
+
+	// the problems are validated too
+	problem := &httputils.Problem{Type: httputils.ProblemTypeDefault, Title: "Not Found", Status: http.StatusNotFound}
+	body, err := json.Marshal(problem)
+	require.NoError(err)
+	problemHeader := http.Header{"Content-Type": []string{httputils.ContentTypeProblem}}
+	assert.NoError(v.ValidateResponse(req, http.StatusForbidden, problemHeader, body))
+	assert.Error(v.ValidateResponse(req, http.StatusForbidden, problemHeader, []byte(`{"title": "Forbidden"}`)))
+}
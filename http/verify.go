@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	defaultVerifyTimeout = 30 * time.Second
+)
+
+var _ http.Handler = &VerifyHandler{}
+
+// VerifyHandler checks the credentials of a user, given as
+// {"login": <nickname or email>, "password": <plaintext>}, and returns the
+// user if they are valid.
+type VerifyHandler struct {
+	store userz.Store
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+func (h *VerifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "VerifyHandler").
+		Logger()
+
+	verifier, ok := h.store.(userz.Verifier)
+	if !ok {
+		logger.Error().Msg("The store cannot verify credentials")
+		httputils.ServerError(w, r, "Failure in verifying the credentials")
+		return
+	}
+
+	var creds credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		logger.Err(err).Msg("Failure in decoding request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+
+	var errs []httputils.FieldError
+	if creds.Login == "" {
+		errs = append(errs, httputils.FieldError{Field: "login", Detail: "is mandatory"})
+	}
+	if creds.Password == "" {
+		errs = append(errs, httputils.FieldError{Field: "password", Detail: "is mandatory"})
+	}
+	if len(errs) > 0 {
+		logger.Debug().Interface("errors", errs).Msg("Incomplete credentials")
+		httputils.BadRequest(w, r, "Incomplete credentials", errs...)
+		return
+	}
+
+	expiring, cancel := context.WithTimeout(ctx, defaultVerifyTimeout)
+	defer cancel()
+
+	user, err := verifier.Verify(expiring, creds.Login, creds.Password)
+	if errors.Is(err, userz.ErrInvalidCredentials) {
+		logger.Info().Msg("Invalid credentials")
+		httputils.Unauthorized(w, r, "Invalid credentials")
+		return
+	}
+	if errors.Is(err, userz.ErrForbidden) {
+		logger.Info().Msg("Operation not allowed")
+		httputils.Forbidden(w, r, "The operation is not allowed")
+		return
+	}
+	if err != nil {
+		logger.Err(err).Msg("Failure in verifying the credentials")
+		httputils.ServerError(w, r, "Failure in verifying the credentials")
+		return
+	}
+
+	logger.Info().Str("ID", user.Id).Msg("Credentials verified")
+	httputils.Ok(w, user)
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+func newVerifyRouter(store *mockStore) chi.Router {
+	h := &VerifyHandler{store}
+	router := chi.NewRouter()
+	router.Post("/verify", h.ServeHTTP)
+
+	return router
+}
+
+func TestVerifyHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	user := &userz.User{Id: "1", NickName: "jd"}
+	router := newVerifyRouter(&mockStore{data: []*userz.User{user}})
+
+	req := httptest.NewRequest(http.MethodPost, localhost+"verify", strings.NewReader(`{"login": "jd", "password": "passw0rd"}`))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	var result userz.User
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(user, &result)
+}
+
+func TestVerifyHandlerErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{"malformed", `{`, nil, http.StatusBadRequest},
+		{"incomplete", `{"login": "jd"}`, nil, http.StatusBadRequest},
+		{"invalid credentials", `{"login": "jd", "password": "wrong"}`, userz.ErrInvalidCredentials, http.StatusUnauthorized},
+		{"forbidden", `{"login": "jd", "password": "passw0rd"}`, userz.ErrForbidden, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			router := newVerifyRouter(&mockStore{err: c.err})
+
+			req := httptest.NewRequest(http.MethodPost, localhost+"verify", strings.NewReader(c.body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(c.status, resp.StatusCode)
+			assert.Equal(httputils.ContentTypeProblem, resp.Header.Get("Content-Type"))
+		})
+	}
+}
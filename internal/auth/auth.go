@@ -0,0 +1,206 @@
+// Package auth authenticates the clients of the APIs, via static API keys or
+// JWT bearer tokens, and carries the authenticated Principal in the context.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	MethodAPIKey = "apikey"
+	MethodJWT    = "jwt"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is an authenticated client.
+type Principal struct {
+	// ID is the id of the API key or the subject of the token.
+	ID string `json:"id"`
+	// Method is either MethodAPIKey or MethodJWT.
+	Method string `json:"method"`
+	// Roles are the roles of the API key, or taken from the "roles" (or
+	// else the space separated "scope") claim of the token.
+	Roles []string `json:"roles,omitempty"`
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context carrying the principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal in the context, if any.
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// APIKey is an entry of the API keys file. Only the SHA-256 of the key is
+// stored, as "sha256:<hex>".
+type APIKey struct {
+	ID    string   `json:"id"`
+	Hash  string   `json:"hash"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// HashAPIKey returns the hash of the key, as expected in the API keys file.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Authenticator verifies the credentials of the clients.
+type Authenticator struct {
+	apiKeys  []APIKey
+	jwks     *JWKS
+	issuer   string
+	audience string
+}
+
+// Option customizes the Authenticator.
+type Option func(*Authenticator) error
+
+// WithAPIKeys loads the API keys from a JSON file, a list of APIKey.
+func WithAPIKeys(path string) Option {
+	return func(a *Authenticator) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var keys []APIKey
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("malformed API keys in %s: %w", path, err)
+		}
+
+		for _, key := range keys {
+			if key.ID == "" || !strings.HasPrefix(key.Hash, "sha256:") {
+				return fmt.Errorf("malformed API key %q in %s: need an id and a sha256:<hex> hash", key.ID, path)
+			}
+		}
+
+		a.apiKeys = keys
+
+		return nil
+	}
+}
+
+// WithJWKS loads the keys to verify the JWT tokens from a JWKS file. Tokens
+// must carry an expiration and, if not empty, the given issuer and audience.
+func WithJWKS(path, issuer, audience string) Option {
+	return func(a *Authenticator) error {
+		jwks, err := LoadJWKS(path)
+		if err != nil {
+			return err
+		}
+
+		a.jwks = jwks
+		a.issuer = issuer
+		a.audience = audience
+
+		return nil
+	}
+}
+
+// New returns an Authenticator. Without options it refuses everybody.
+func New(opts ...Option) (*Authenticator, error) {
+	a := &Authenticator{}
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate verifies either an API key or a bearer token, whichever is
+// not empty.
+func (a *Authenticator) Authenticate(apiKey, bearer string) (*Principal, error) {
+	switch {
+	case apiKey != "":
+		return a.authenticateAPIKey(apiKey)
+	case bearer != "":
+		return a.authenticateJWT(bearer)
+	default:
+		return nil, ErrNoCredentials
+	}
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	hash := []byte(HashAPIKey(key))
+
+	for _, apiKey := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash, []byte(apiKey.Hash)) == 1 {
+			return &Principal{
+				ID:     apiKey.ID,
+				Method: MethodAPIKey,
+				Roles:  apiKey.Roles,
+			}, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// claims are the claims of the tokens.
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+}
+
+func (a *Authenticator) authenticateJWT(token string) (*Principal, error) {
+	if a.jwks == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, a.jwks.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+
+	if c.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: the token has no expiration", ErrInvalidCredentials)
+	}
+
+	if a.issuer != "" && !c.VerifyIssuer(a.issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	}
+
+	if a.audience != "" && !c.VerifyAudience(a.audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: the token has no subject", ErrInvalidCredentials)
+	}
+
+	roles := c.Roles
+	if roles == nil && c.Scope != "" {
+		roles = strings.Fields(c.Scope)
+	}
+
+	return &Principal{
+		ID:     c.Subject,
+		Method: MethodJWT,
+		Roles:  roles,
+	}, nil
+}
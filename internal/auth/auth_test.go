@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKey = "s3cr3t-api-key"
+
+// testKeys writes an API keys file and a JWKS file with a fresh EC key,
+// returned to sign the tokens.
+func testKeys(t *testing.T) (apiKeysPath, jwksPath string, key *ecdsa.PrivateKey) {
+	dir := t.TempDir()
+
+	apiKeys, err := json.Marshal([]APIKey{
+		{ID: "backoffice", Hash: HashAPIKey(testAPIKey), Roles: []string{"admin"}},
+	})
+	require.NoError(t, err)
+	apiKeysPath = filepath.Join(dir, "apikeys.json")
+	require.NoError(t, os.WriteFile(apiKeysPath, apiKeys, 0o600))
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "test",
+			"use": "sig",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+	require.NoError(t, err)
+	jwksPath = filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(jwksPath, jwks, 0o600))
+
+	return apiKeysPath, jwksPath, key
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, c jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, c)
+	token.Header["kid"] = "test"
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	apiKeysPath, jwksPath, key := testKeys(t)
+
+	a, err := New(
+		WithAPIKeys(apiKeysPath),
+		WithJWKS(jwksPath, "https://issuer.example.org", "userz"),
+	)
+	require.NoError(err)
+
+	_, err = a.Authenticate("", "")
+	assert.ErrorIs(err, ErrNoCredentials)
+
+	// API keys
+	principal, err := a.Authenticate(testAPIKey, "")
+	require.NoError(err)
+	assert.Equal(&Principal{ID: "backoffice", Method: MethodAPIKey, Roles: []string{"admin"}}, principal)
+
+	_, err = a.Authenticate("wrong", "")
+	assert.ErrorIs(err, ErrInvalidCredentials)
+
+	// JWT
+	valid := jwt.MapClaims{
+		"sub":   "jdoe",
+		"iss":   "https://issuer.example.org",
+		"aud":   "userz",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"scope": "users:read users:write",
+	}
+
+	principal, err = a.Authenticate("", sign(t, key, valid))
+	require.NoError(err)
+	assert.Equal(&Principal{ID: "jdoe", Method: MethodJWT, Roles: []string{"users:read", "users:write"}}, principal)
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"expired":      func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no exp":       func(c jwt.MapClaims) { delete(c, "exp") },
+		"wrong issuer": func(c jwt.MapClaims) { c["iss"] = "https://evil.example.org" },
+		"wrong aud":    func(c jwt.MapClaims) { c["aud"] = "other" },
+		"no subject":   func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		c := jwt.MapClaims{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		change(c)
+
+		_, err := a.Authenticate("", sign(t, key, c))
+		assert.ErrorIs(err, ErrInvalidCredentials, name)
+	}
+
+	// signed by another key
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	_, err = a.Authenticate("", sign(t, other, valid))
+	assert.ErrorIs(err, ErrInvalidCredentials)
+
+	// no signature at all
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(err)
+	_, err = a.Authenticate("", unsigned)
+	assert.ErrorIs(err, ErrInvalidCredentials)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	// APIKeyHeader carries the API keys, both in HTTP and in the gRPC
+	// metadata (lowercase).
+	APIKeyHeader = "X-API-Key"
+	// healthService is never authenticated, for the probes.
+	healthService = "/grpc.health.v1.Health/"
+)
+
+func bearer(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// withPrincipal stores the principal in the context and adds it to the
+// logger.
+func withPrincipal(ctx context.Context, principal *Principal) context.Context {
+	logger := zerolog.Ctx(ctx).With().
+		Str("principal", principal.ID).
+		Str("authMethod", principal.Method).
+		Logger()
+
+	return logger.WithContext(WithPrincipal(ctx, principal))
+}
+
+// Middleware authenticates the HTTP requests, with an API key in the
+// X-API-Key header or a bearer token in the Authorization one, refusing the
+// others with 401.
+func Middleware(a *Authenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			principal, err := a.Authenticate(r.Header.Get(APIKeyHeader), bearer(r.Header.Get("Authorization")))
+			if err != nil {
+				zerolog.Ctx(ctx).Info().Err(err).Msg("Authentication failed")
+
+				w.Header().Set("WWW-Authenticate", `Bearer realm="userz"`)
+				httputils.Unauthorized(w, r, "authentication required")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withPrincipal(ctx, principal)))
+		})
+	}
+}
+
+// authenticateGRPC authenticates with the credentials in the metadata, as in
+// HTTP.
+func authenticateGRPC(ctx context.Context, a *Authenticator, method string) (context.Context, error) {
+	if strings.HasPrefix(method, healthService) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	principal, err := a.Authenticate(first(strings.ToLower(APIKeyHeader)), bearer(first("authorization")))
+	if err != nil {
+		zerolog.Ctx(ctx).Info().Err(err).Msg("Authentication failed")
+		return ctx, status.Error(codes.Unauthenticated, "userz: authentication required")
+	}
+
+	return withPrincipal(ctx, principal), nil
+}
+
+// UnaryInterceptor authenticates the gRPC requests, with the same
+// credentials of the HTTP ones in the metadata.
+func UnaryInterceptor(a *Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticateGRPC(ctx, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor is the same as UnaryInterceptor, for streams.
+func StreamInterceptor(a *Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateGRPC(ss.Context(), a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, grpcutils.WrapStream(ss, ctx))
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	apiKeysPath, _, _ := testKeys(t)
+	a, err := New(WithAPIKeys(apiKeysPath))
+	require.NoError(err)
+
+	var principal *Principal
+	handler := Middleware(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(w.Header().Get("WWW-Authenticate"))
+	assert.Nil(principal)
+
+	req.Header.Set(APIKeyHeader, testAPIKey)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	require.NotNil(principal)
+	assert.Equal("backoffice", principal.ID)
+}
+
+// echoDesc describes a service replying SERVING if the request carries a
+// principal.
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Check",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(healthpb.HealthCheckRequest)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req any) (any, error) {
+				if PrincipalFrom(ctx) == nil {
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+				}
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+			}
+
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Check"}, handler)
+		},
+	}},
+}
+
+func TestInterceptor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, jwksPath, key := testKeys(t)
+	a, err := New(WithJWKS(jwksPath, "", ""))
+	require.NoError(err)
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(UnaryInterceptor(a)))
+	s.RegisterService(&echoDesc, struct{}{})
+	healthpb.RegisterHealthServer(s, health.NewServer())
+
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(err)
+	defer conn.Close()
+
+	echo := func(ctx context.Context) (*healthpb.HealthCheckResponse, error) {
+		resp := new(healthpb.HealthCheckResponse)
+		err := conn.Invoke(ctx, "/test.Echo/Check", &healthpb.HealthCheckRequest{}, resp)
+		return resp, err
+	}
+
+	_, err = echo(context.Background())
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+
+	token := sign(t, key, map[string]any{"sub": "jdoe", "exp": 4102444800})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	resp, err := echo(ctx)
+	require.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	// the probes need no credentials
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+}
@@ -0,0 +1,287 @@
+// Package bulk moves the users in and out of a store in bulk, as NDJSON or
+// CSV.
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/leophys/userz"
+)
+
+// DefaultPageSize is the number of users fetched from the store at a time.
+const DefaultPageSize = 1000
+
+// Format is the encoding of the users.
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatNDJSON, FormatCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// column is a field of the users that can be exported. The value is not
+// set for the zero timestamps.
+type column struct {
+	name  string
+	value func(*userz.User) (string, bool)
+}
+
+func stringColumn(name string, value func(*userz.User) string) column {
+	return column{name, func(u *userz.User) (string, bool) { return value(u), true }}
+}
+
+func timeColumn(name string, value func(*userz.User) time.Time) column {
+	return column{name, func(u *userz.User) (string, bool) {
+		t := value(u)
+		if t.IsZero() {
+			return "", false
+		}
+		return t.Format(time.RFC3339Nano), true
+	}}
+}
+
+// columns are all the fields that can be exported, in their default order.
+// The password is deliberately missing.
+var columns = []column{
+	stringColumn("id", func(u *userz.User) string { return u.Id }),
+	stringColumn("first_name", func(u *userz.User) string { return u.FirstName }),
+	stringColumn("last_name", func(u *userz.User) string { return u.LastName }),
+	stringColumn("nickname", func(u *userz.User) string { return u.NickName }),
+	stringColumn("email", func(u *userz.User) string { return u.Email }),
+	stringColumn("country", func(u *userz.User) string { return u.Country }),
+	timeColumn("created_at", func(u *userz.User) time.Time { return u.CreatedAt }),
+	timeColumn("updated_at", func(u *userz.User) time.Time { return u.UpdatedAt }),
+}
+
+// Columns returns the names of all the fields that can be exported.
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+
+	return names
+}
+
+// ParseColumns returns the columns in the comma separated list, or all of
+// them if empty.
+func ParseColumns(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return Columns(), nil
+	}
+
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, err := lookupColumn(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func lookupColumn(name string) (column, error) {
+	for _, c := range columns {
+		if c.name == name {
+			return c, nil
+		}
+	}
+
+	return column{}, fmt.Errorf("unknown column %q", name)
+}
+
+// ExportOptions tune Export.
+type ExportOptions struct {
+	Format Format
+	// Columns are the fields to export, all of them if empty.
+	Columns []string
+	// PageSize is the number of users fetched at a time, DefaultPageSize if
+	// zero.
+	PageSize uint
+}
+
+// Flusher is implemented by the writers buffering their output, to be
+// flushed after every page.
+type Flusher interface {
+	Flush() error
+}
+
+// Export writes the users matching the filter to out, fetching them a page
+// at a time from the store, so that the memory used does not depend on their
+// number. After every page, out is flushed if it is a Flusher. It returns
+// the number of users written.
+//
+// The store is asked for the users before anything is written, so that an
+// error there can still be reported by the caller.
+func Export(ctx context.Context, store userz.Store, filter *userz.Filter, out io.Writer, opts ExportOptions) (uint, error) {
+	names := opts.Columns
+	if len(names) == 0 {
+		names = Columns()
+	}
+
+	cols := make([]column, len(names))
+	for i, name := range names {
+		c, err := lookupColumn(name)
+		if err != nil {
+			return 0, err
+		}
+		cols[i] = c
+	}
+
+	var enc encoder
+	switch opts.Format {
+	case FormatNDJSON, "":
+		enc = &ndjsonEncoder{out: out, cols: cols}
+	case FormatCSV:
+		enc = &csvEncoder{out: csv.NewWriter(out), cols: cols}
+	default:
+		return 0, fmt.Errorf("unknown format %q", opts.Format)
+	}
+
+	pageSize := opts.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+
+	iterator, err := store.List(ctx, filter, pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := enc.begin(); err != nil {
+		return 0, err
+	}
+
+	var count uint
+	for {
+		users, err := iterator.Next(ctx)
+		if errors.Is(err, userz.ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		for _, user := range users {
+			if err := enc.encode(user); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if err := enc.flush(); err != nil {
+			return count, err
+		}
+		if flusher, ok := out.(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, enc.flush()
+}
+
+type encoder interface {
+	begin() error
+	encode(user *userz.User) error
+	flush() error
+}
+
+// ndjsonEncoder writes a JSON object per line, with the columns in order.
+// The zero timestamps are null.
+type ndjsonEncoder struct {
+	out  io.Writer
+	cols []column
+	buf  bytes.Buffer
+}
+
+func (e *ndjsonEncoder) begin() error {
+	return nil
+}
+
+func (e *ndjsonEncoder) encode(user *userz.User) error {
+	e.buf.Reset()
+	e.buf.WriteByte('{')
+
+	for i, c := range e.cols {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(c.name)
+		e.buf.Write(key)
+		e.buf.WriteByte(':')
+
+		value, ok := c.value(user)
+		if !ok {
+			e.buf.WriteString("null")
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.buf.Write(encoded)
+	}
+
+	e.buf.WriteString("}\n")
+
+	_, err := e.out.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return nil
+}
+
+// csvEncoder writes a header with the names of the columns, then a record
+// per user. The zero timestamps are empty.
+type csvEncoder struct {
+	out    *csv.Writer
+	cols   []column
+	record []string
+}
+
+func (e *csvEncoder) begin() error {
+	e.record = make([]string, len(e.cols))
+	for i, c := range e.cols {
+		e.record[i] = c.name
+	}
+
+	return e.out.Write(e.record)
+}
+
+func (e *csvEncoder) encode(user *userz.User) error {
+	for i, c := range e.cols {
+		e.record[i], _ = c.value(user)
+	}
+
+	return e.out.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.out.Flush()
+	return e.out.Error()
+}
@@ -0,0 +1,103 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+)
+
+var _ userz.Store = &pagedStore{}
+
+// pagedStore lists its users in pages, and supports nothing else.
+type pagedStore struct {
+	userz.Store
+	users []*userz.User
+}
+
+func (s *pagedStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	return &pagedIterator{users: s.users, pageSize: pageSize}, nil
+}
+
+type pagedIterator struct {
+	users    []*userz.User
+	pageSize uint
+}
+
+func (i *pagedIterator) Len() userz.PaginationData {
+	return userz.NewPaginationData(uint(len(i.users)), i.pageSize)
+}
+
+func (i *pagedIterator) Next(ctx context.Context) ([]*userz.User, error) {
+	if len(i.users) == 0 {
+		return nil, userz.ErrNoMorePages
+	}
+
+	page := i.users
+	if uint(len(page)) > i.pageSize {
+		page = page[:i.pageSize]
+	}
+	i.users = i.users[len(page):]
+
+	return page, nil
+}
+
+// flushCounter counts the flushes.
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushCounter) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &pagedStore{users: []*userz.User{
+		{Id: "1", NickName: "jd", Email: "jd@morgue.com", Password: userz.Password("secret"), LastName: "Doe, John"},
+		{Id: "2", NickName: "mr", Email: "mr@morgue.com", Password: userz.Password("secret")},
+		{Id: "3", NickName: "jb", Email: "jb@morgue.com", Password: userz.Password("secret")},
+	}}
+
+	out := &flushCounter{}
+	count, err := Export(context.Background(), store, nil, out, ExportOptions{
+		Format:   FormatCSV,
+		Columns:  []string{"id", "last_name", "created_at"},
+		PageSize: 2,
+	})
+	require.NoError(err)
+	assert.Equal(uint(3), count)
+	assert.Equal(2, out.flushes)
+	assert.Equal("id,last_name,created_at\n1,\"Doe, John\",\n2,,\n3,,\n", out.String())
+
+	out = &flushCounter{}
+	count, err = Export(context.Background(), store, nil, out, ExportOptions{})
+	require.NoError(err)
+	assert.Equal(uint(3), count)
+	assert.Equal(1, out.flushes)
+	assert.NotContains(out.String(), "secret")
+	assert.Equal(3, bytes.Count(out.Bytes(), []byte("\n")))
+}
+
+func TestParseColumns(t *testing.T) {
+	assert := assert.New(t)
+
+	columns, err := ParseColumns("")
+	assert.NoError(err)
+	assert.Equal(Columns(), columns)
+
+	columns, err = ParseColumns("email, id")
+	assert.NoError(err)
+	assert.Equal([]string{"email", "id"}, columns)
+
+	_, err = ParseColumns("id,password")
+	assert.Error(err)
+}
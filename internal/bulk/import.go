@@ -0,0 +1,437 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/leophys/userz"
+)
+
+const (
+	// maxLineSize is the size of the longest NDJSON line accepted.
+	maxLineSize = 1 << 20
+	// takenBatchSize is the number of rows checked against the store by
+	// each query.
+	takenBatchSize = 1000
+)
+
+// Mode is the behaviour of Import in the presence of invalid rows.
+type Mode string
+
+const (
+	// ModeAllOrNothing imports nothing if any row is invalid.
+	ModeAllOrNothing Mode = "all-or-nothing"
+	// ModeSkipInvalid imports the valid rows, skipping the others.
+	ModeSkipInvalid Mode = "skip-invalid"
+)
+
+// ParseMode returns the mode with the given name, ModeAllOrNothing if empty.
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(strings.ToLower(name)); m {
+	case "":
+		return ModeAllOrNothing, nil
+	case ModeAllOrNothing, ModeSkipInvalid:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q", name)
+	}
+}
+
+var (
+	// ErrInvalidRows is returned by Import in ModeAllOrNothing, along with
+	// the report of the invalid rows, if any.
+	ErrInvalidRows = errors.New("some rows are not valid")
+	// ErrMalformedFile is returned by Import for the errors in the file as a
+	// whole, e.g. an unknown CSV column.
+	ErrMalformedFile = errors.New("the file is malformed")
+)
+
+// field is a field of the users that can be imported.
+type field struct {
+	name     string
+	required bool
+	value    func(*userz.UserData) *string
+}
+
+// fields are all the fields that can be imported.
+var fields = []field{
+	{"first_name", false, func(d *userz.UserData) *string { return &d.FirstName }},
+	{"last_name", false, func(d *userz.UserData) *string { return &d.LastName }},
+	{"nickname", true, func(d *userz.UserData) *string { return &d.NickName }},
+	{"email", true, func(d *userz.UserData) *string { return &d.Email }},
+	{"password", false, func(d *userz.UserData) *string { return &d.Password }},
+	{"password_hash", false, func(d *userz.UserData) *string { return &d.PasswordHash }},
+	{"country", false, func(d *userz.UserData) *string { return &d.Country }},
+}
+
+func lookupField(name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+// ImportOptions tune Import.
+type ImportOptions struct {
+	Format Format
+	// Mode is ModeAllOrNothing if empty.
+	Mode Mode
+}
+
+// ImportReport summarises an import.
+type ImportReport struct {
+	// Total is the number of rows read.
+	Total uint `json:"total"`
+	// Imported is the number of users added to the store.
+	Imported uint `json:"imported"`
+	// Invalid is the number of rows not valid.
+	Invalid uint `json:"invalid"`
+	// Errors explain why the rows are not valid, possibly many per row.
+	Errors []RowError `json:"errors,omitempty"`
+}
+
+// RowError explains why a row is not valid.
+type RowError struct {
+	// Line is where the row starts in the file, counting from 1.
+	Line uint `json:"line"`
+	// Field is the offending field, if any.
+	Field  string `json:"field,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// row is a user read from the file.
+type row struct {
+	line uint
+	data *userz.UserData
+	errs []RowError
+}
+
+func (r *row) fail(field, detail string) {
+	r.errs = append(r.errs, RowError{Line: r.line, Field: field, Detail: detail})
+}
+
+// Import reads all the users in, validates them and adds the valid ones to
+// the store in a single AddBulk, which the store has to support. The rows
+// with the nickname or the email of an existing user are invalid, if the
+// store can tell which are taken. In
+// ModeAllOrNothing, nothing is added if any row is invalid, and
+// ErrInvalidRows is returned. The report tells about the invalid rows
+// in any case.
+//
+// The errors in the file as a whole are returned as ErrMalformedFile,
+// without a report.
+func Import(ctx context.Context, store userz.Store, in io.Reader, opts ImportOptions) (*ImportReport, error) {
+	adder, ok := store.(userz.BulkAdder)
+	if !ok {
+		return nil, userz.ErrBulkUnsupported
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = ModeAllOrNothing
+	}
+
+	var rows []*row
+	var err error
+	switch opts.Format {
+	case FormatNDJSON, "":
+		rows, err = readNDJSON(in)
+	case FormatCSV:
+		rows, err = readCSV(in)
+	default:
+		err = fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	validate(rows)
+	if err := checkTaken(ctx, store, rows); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Total: uint(len(rows))}
+	var users []*userz.UserData
+	for _, r := range rows {
+		if len(r.errs) > 0 {
+			report.Invalid++
+			report.Errors = append(report.Errors, r.errs...)
+			continue
+		}
+		users = append(users, r.data)
+	}
+
+	if report.Invalid > 0 && mode == ModeAllOrNothing {
+		return report, ErrInvalidRows
+	}
+
+	if len(users) == 0 {
+		return report, nil
+	}
+
+	report.Imported, err = adder.AddBulk(ctx, users)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// validate checks that the rows have the required fields, a password either
+// in plaintext or hashed, and do not clash with each other.
+func validate(rows []*row) {
+	nicknames := make(map[string]uint)
+	emails := make(map[string]uint)
+
+	for _, r := range rows {
+		if r.data == nil {
+			// malformed
+			continue
+		}
+
+		for _, f := range fields {
+			if f.required && *f.value(r.data) == "" {
+				r.fail(f.name, "missing")
+			}
+		}
+
+		switch {
+		case r.data.Password == "" && r.data.PasswordHash == "":
+			r.fail("password", "missing")
+		case r.data.Password != "" && r.data.PasswordHash != "":
+			r.fail("password_hash", "given along with password")
+		case r.data.PasswordHash != "":
+			if _, err := userz.ParsePasswordHash(r.data.PasswordHash); err != nil {
+				r.fail("password_hash", err.Error())
+			}
+		}
+
+		unique(r, "nickname", r.data.NickName, nicknames)
+		unique(r, "email", r.data.Email, emails)
+	}
+}
+
+// checkTaken fails the valid rows with the nickname or the email of an
+// existing user, asking the store in batches. Nothing is checked if the
+// store cannot tell.
+func checkTaken(ctx context.Context, store userz.Store, rows []*row) error {
+	checker, ok := store.(userz.TakenChecker)
+	if !ok {
+		return nil
+	}
+
+	var valid []*row
+	for _, r := range rows {
+		if r.data != nil && len(r.errs) == 0 {
+			valid = append(valid, r)
+		}
+	}
+
+	for start := 0; start < len(valid); start += takenBatchSize {
+		end := start + takenBatchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		batch := valid[start:end]
+
+		nicknames := make([]string, len(batch))
+		emails := make([]string, len(batch))
+		for i, r := range batch {
+			nicknames[i] = r.data.NickName
+			emails[i] = r.data.Email
+		}
+
+		takenNicknames, takenEmails, err := checker.Taken(ctx, nicknames, emails)
+		if errors.Is(err, userz.ErrTakenUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		isTakenNickname := toSet(takenNicknames)
+		isTakenEmail := toSet(takenEmails)
+		for _, r := range batch {
+			if isTakenNickname[r.data.NickName] {
+				r.fail("nickname", "already taken")
+			}
+			if isTakenEmail[r.data.Email] {
+				r.fail("email", "already taken")
+			}
+		}
+	}
+
+	return nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+
+	return set
+}
+
+// unique fails the row if the value was already seen at another line.
+func unique(r *row, name, value string, seen map[string]uint) {
+	if value == "" {
+		return
+	}
+
+	if line, ok := seen[value]; ok {
+		r.fail(name, fmt.Sprintf("duplicate of line %d", line))
+		return
+	}
+	seen[value] = r.line
+}
+
+// readNDJSON reads a user per line, skipping the blank ones.
+func readNDJSON(in io.Reader) ([]*row, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var rows []*row
+	var line uint
+	for scanner.Scan() {
+		line++
+
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		rows = append(rows, parseNDJSON(line, data))
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, fmt.Errorf("%w: line %d longer than %d bytes", ErrMalformedFile, line+1, maxLineSize)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read line %d: %w", line+1, err)
+	}
+
+	return rows, nil
+}
+
+func parseNDJSON(line uint, data []byte) *row {
+	r := &row{line: line}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		r.fail("", "not a JSON object")
+		return r
+	}
+
+	user := &userz.UserData{}
+	for name, raw := range object {
+		f, ok := lookupField(name)
+		if !ok {
+			r.fail(name, "unknown field")
+			continue
+		}
+
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			r.fail(name, "not a string")
+			continue
+		}
+		if value != nil {
+			*f.value(user) = *value
+		}
+	}
+
+	// the fields of an object come in no particular order
+	sort.Slice(r.errs, func(i, j int) bool { return r.errs[i].Field < r.errs[j].Field })
+
+	if len(r.errs) == 0 {
+		r.data = user
+	}
+
+	return r
+}
+
+// readCSV reads a user per record, after a header naming the fields.
+func readCSV(in io.Reader) ([]*row, error) {
+	reader := csv.NewReader(in)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, fmt.Errorf("%w: header: %s", ErrMalformedFile, parseErr.Err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+
+	byColumn := make([]field, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		f, ok := lookupField(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrMalformedFile, name)
+		}
+		if containsField(byColumn[:i], name) {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrMalformedFile, name)
+		}
+		byColumn[i] = f
+	}
+	for _, f := range fields {
+		if f.required && !containsField(byColumn, f.name) {
+			return nil, fmt.Errorf("%w: missing column %q", ErrMalformedFile, f.name)
+		}
+	}
+	if !containsField(byColumn, "password") && !containsField(byColumn, "password_hash") {
+		return nil, fmt.Errorf("%w: missing column %q or %q", ErrMalformedFile, "password", "password_hash")
+	}
+
+	var rows []*row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if errors.As(err, &parseErr) {
+			r := &row{line: uint(parseErr.StartLine)}
+			r.fail("", parseErr.Err.Error())
+			rows = append(rows, r)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		user := &userz.UserData{}
+		for i, value := range record {
+			*byColumn[i].value(user) = value
+		}
+		rows = append(rows, &row{line: uint(line), data: user})
+	}
+
+	return rows, nil
+}
+
+func containsField(list []field, name string) bool {
+	for _, f := range list {
+		if f.name == name {
+			return true
+		}
+	}
+
+	return false
+}
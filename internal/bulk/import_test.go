@@ -0,0 +1,240 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+)
+
+var (
+	_ userz.Store     = &bulkStore{}
+	_ userz.BulkAdder = &bulkStore{}
+)
+
+// bulkStore records the users added in bulk, and supports nothing else.
+type bulkStore struct {
+	userz.Store
+	added [][]*userz.UserData
+	err   error
+}
+
+func (s *bulkStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	s.added = append(s.added, users)
+	return uint(len(users)), nil
+}
+
+const invalidNDJSON = `{"nickname":"jd","email":"jd@morgue.com","password":"secret","country":"US"}
+
+{"nickname":"mr","email":"mr@morgue.com"}
+{"nickname":"jd","email":"jd2@morgue.com","password":"secret","id":"1"}
+not json
+{"nickname":"jb","email":"jb@morgue.com","password":"secret","country":null}
+`
+
+func TestImportNDJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := &bulkStore{}
+	report, err := Import(context.Background(), store, strings.NewReader(invalidNDJSON), ImportOptions{})
+	assert.ErrorIs(err, ErrInvalidRows)
+	require.NotNil(report)
+	assert.Equal(uint(5), report.Total)
+	assert.Equal(uint(0), report.Imported)
+	assert.Equal(uint(3), report.Invalid)
+	assert.Equal([]RowError{
+		{Line: 3, Field: "password", Detail: "missing"},
+		{Line: 4, Field: "id", Detail: "unknown field"},
+		{Line: 5, Detail: "not a JSON object"},
+	}, report.Errors)
+	assert.Empty(store.added)
+
+	report, err = Import(context.Background(), store, strings.NewReader(invalidNDJSON), ImportOptions{Mode: ModeSkipInvalid})
+	require.NoError(err)
+	assert.Equal(uint(2), report.Imported)
+	assert.Equal(uint(3), report.Invalid)
+	require.Len(store.added, 1)
+	assert.Equal([]*userz.UserData{
+		{NickName: "jd", Email: "jd@morgue.com", Password: "secret", Country: "US"},
+		{NickName: "jb", Email: "jb@morgue.com", Password: "secret"},
+	}, store.added[0])
+}
+
+func TestImportCSV(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	in := "nickname,email,password,last_name\n" +
+		"jd,jd@morgue.com,secret,\"Doe,\nJohn\"\n" +
+		"mr,jd@morgue.com,secret,Rossi\n" +
+		"jb,jb@morgue.com,secret\n" +
+		"kk,kk@morgue.com,secret,Kay\n"
+
+	store := &bulkStore{}
+	report, err := Import(context.Background(), store, strings.NewReader(in), ImportOptions{
+		Format: FormatCSV,
+		Mode:   ModeSkipInvalid,
+	})
+	require.NoError(err)
+	assert.Equal(uint(4), report.Total)
+	assert.Equal(uint(2), report.Imported)
+	assert.Equal([]RowError{
+		{Line: 4, Field: "email", Detail: "duplicate of line 2"},
+		{Line: 5, Detail: "wrong number of fields"},
+	}, report.Errors)
+	require.Len(store.added, 1)
+	assert.Equal("Doe,\nJohn", store.added[0][0].LastName)
+	assert.Equal("kk", store.added[0][1].NickName)
+}
+
+func TestImportMalformed(t *testing.T) {
+	cases := map[string]string{
+		"unknown column":   "nickname,email,password,id\n",
+		"missing column":   "nickname,email\n",
+		"duplicate column": "nickname,email,password,email\n",
+	}
+
+	for name, in := range cases {
+		t.Run(name, func(t *testing.T) {
+			report, err := Import(context.Background(), &bulkStore{}, strings.NewReader(in), ImportOptions{Format: FormatCSV})
+			assert.ErrorIs(t, err, ErrMalformedFile)
+			assert.Nil(t, report)
+		})
+	}
+}
+
+func TestImportStoreFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	in := `{"nickname":"jd","email":"jd@morgue.com","password":"secret"}`
+
+	report, err := Import(context.Background(), &bulkStore{err: userz.ErrConflict}, strings.NewReader(in), ImportOptions{})
+	assert.ErrorIs(err, userz.ErrConflict)
+	assert.Equal(uint(0), report.Imported)
+
+	_, err = Import(context.Background(), &pagedStore{}, strings.NewReader(in), ImportOptions{})
+	assert.ErrorIs(err, userz.ErrBulkUnsupported)
+}
+
+func TestImportPasswordHash(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	in := "nickname,email,password,password_hash\n" +
+		"jd,jd@morgue.com,,sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479\n" +
+		"mr,mr@morgue.com,secret,sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479\n" +
+		"jb,jb@morgue.com,,md5$unknown\n" +
+		"kk,kk@morgue.com,,\n"
+
+	store := &bulkStore{}
+	report, err := Import(context.Background(), store, strings.NewReader(in), ImportOptions{
+		Format: FormatCSV,
+		Mode:   ModeSkipInvalid,
+	})
+	require.NoError(err)
+	assert.Equal(uint(1), report.Imported)
+	require.Len(report.Errors, 3)
+	assert.Equal(RowError{Line: 3, Field: "password_hash", Detail: "given along with password"}, report.Errors[0])
+	assert.Equal(uint(4), report.Errors[1].Line)
+	assert.Equal("password_hash", report.Errors[1].Field)
+	assert.Equal(RowError{Line: 5, Field: "password", Detail: "missing"}, report.Errors[2])
+
+	_, err = Import(context.Background(), store, strings.NewReader("nickname,email\n"), ImportOptions{Format: FormatCSV})
+	assert.ErrorIs(err, ErrMalformedFile)
+}
+
+// takenStore is a bulkStore telling the nicknames and emails taken.
+type takenStore struct {
+	bulkStore
+	nicknames []string
+	emails    []string
+	checks    int
+}
+
+func (s *takenStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	s.checks++
+
+	among := func(values, taken []string) []string {
+		var res []string
+		for _, value := range values {
+			for _, t := range taken {
+				if value == t {
+					res = append(res, value)
+				}
+			}
+		}
+		return res
+	}
+
+	return among(nicknames, s.nicknames), among(emails, s.emails), nil
+}
+
+func TestImportTaken(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	in := "nickname,email,password\n" +
+		"jd,jd@morgue.com,secret\n" +
+		"mr,mr@morgue.com,secret\n" +
+		"jb,jb@morgue.com,secret\n" +
+		"kk,,\n"
+
+	store := &takenStore{nicknames: []string{"jd"}, emails: []string{"jd@morgue.com", "jb@morgue.com"}}
+	report, err := Import(context.Background(), store, strings.NewReader(in), ImportOptions{Format: FormatCSV})
+	assert.ErrorIs(err, ErrInvalidRows)
+	require.NotNil(report)
+	assert.Equal(uint(3), report.Invalid)
+	assert.Equal([]RowError{
+		{Line: 2, Field: "nickname", Detail: "already taken"},
+		{Line: 2, Field: "email", Detail: "already taken"},
+		{Line: 4, Field: "email", Detail: "already taken"},
+		{Line: 5, Field: "email", Detail: "missing"},
+		{Line: 5, Field: "password", Detail: "missing"},
+	}, report.Errors)
+	assert.Empty(store.added)
+	assert.Equal(1, store.checks)
+
+	report, err = Import(context.Background(), store, strings.NewReader(in), ImportOptions{
+		Format: FormatCSV,
+		Mode:   ModeSkipInvalid,
+	})
+	require.NoError(err)
+	assert.Equal(uint(1), report.Imported)
+	require.Len(store.added, 1)
+	assert.Equal([]*userz.UserData{
+		{NickName: "mr", Email: "mr@morgue.com", Password: "secret"},
+	}, store.added[0])
+}
+
+func TestImportTakenBatches(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var in strings.Builder
+	in.WriteString("nickname,email,password\n")
+	for i := 0; i < takenBatchSize+1; i++ {
+		fmt.Fprintf(&in, "u%d,u%d@morgue.com,secret\n", i, i)
+	}
+
+	store := &takenStore{nicknames: []string{fmt.Sprintf("u%d", takenBatchSize)}}
+	report, err := Import(context.Background(), store, strings.NewReader(in.String()), ImportOptions{
+		Format: FormatCSV,
+		Mode:   ModeSkipInvalid,
+	})
+	require.NoError(err)
+	assert.Equal(2, store.checks)
+	assert.Equal(uint(takenBatchSize), report.Imported)
+	assert.Equal([]RowError{
+		{Line: takenBatchSize + 2, Field: "nickname", Detail: "already taken"},
+	}, report.Errors)
+}
@@ -0,0 +1,60 @@
+package grpcutils
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ServeHealth registers the standard health service on the server. The
+// status of the server and of every service already registered on it is kept
+// in sync with the given check, run every interval, and moved to NOT_SERVING
+// for good when the context is done.
+func ServeHealth(ctx context.Context, s *grpc.Server, check func(context.Context) error, interval time.Duration) *health.Server {
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+
+	services := []string{""}
+	for name := range s.GetServiceInfo() {
+		services = append(services, name)
+	}
+
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+
+		expiring, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+
+		if err := check(expiring); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("gRPC server not healthy")
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		for _, service := range services {
+			hs.SetServingStatus(service, status)
+		}
+	}
+
+	update()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				hs.Shutdown()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+
+	return hs
+}
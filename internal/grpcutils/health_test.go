@@ -0,0 +1,81 @@
+package grpcutils_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/proto"
+)
+
+func TestServeHealth(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	check := func(context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("unhealthy")
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	proto.RegisterUserzServer(s, proto.NewUserzServiceServer(nil))
+	grpcutils.ServeHealth(ctx, s, check, 10*time.Millisecond)
+
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(err)
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+
+	statusOf := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(err)
+		return resp.Status
+	}
+
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, statusOf(""))
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, statusOf("proto.Userz"))
+
+	healthy.Store(false)
+	assert.Eventually(func() bool {
+		return statusOf("proto.Userz") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	healthy.Store(true)
+	assert.Eventually(func() bool {
+		return statusOf("") == healthpb.HealthCheckResponse_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	// shutting down
+	cancel()
+	assert.Eventually(func() bool {
+		return statusOf("") == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,138 @@
+package grpcutils
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// healthService is always allowed, for the probes.
+const healthService = "/grpc.health.v1.Health/"
+
+type identityKey struct{}
+
+// Identity returns the authenticated identity of the client, if any.
+func Identity(ctx context.Context) string {
+	id, _ := ctx.Value(identityKey{}).(string)
+	return id
+}
+
+// PeerIdentity returns the identity in the verified certificate of the
+// client: the first URI SAN, DNS SAN or email SAN, in this order, or the
+// common name of the subject. It is empty without a verified certificate.
+func PeerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return certificateIdentity(info.State.VerifiedChains[0][0])
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.Subject.CommonName
+	}
+}
+
+// ACL maps the identities of the clients to the RPCs they are allowed to
+// call, by full method name (e.g. "/proto.Userz/List"). "/proto.Userz/*"
+// allows all the methods of a service and "*" everything. The health service
+// is always allowed.
+type ACL map[string][]string
+
+// LoadACL reads an ACL from a JSON file.
+func LoadACL(path string) (ACL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var acl ACL
+	if err := json.Unmarshal(data, &acl); err != nil {
+		return nil, fmt.Errorf("malformed ACL in %s: %w", path, err)
+	}
+
+	return acl, nil
+}
+
+// Allowed tells whether the identity can call the method.
+func (a ACL) Allowed(identity, method string) bool {
+	if strings.HasPrefix(method, healthService) {
+		return true
+	}
+
+	for _, allowed := range a[identity] {
+		switch {
+		case allowed == "*", allowed == method:
+			return true
+		case strings.HasSuffix(allowed, "/*") && strings.HasPrefix(method, strings.TrimSuffix(allowed, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// withIdentity stores in the context the identity of the client and adds it
+// to the logger, failing if the ACL (if any) does not allow the method.
+func withIdentity(ctx context.Context, acl ACL, method string) (context.Context, error) {
+	id := PeerIdentity(ctx)
+
+	logger := zerolog.Ctx(ctx).With().Str("identity", id).Logger()
+
+	if acl != nil && !acl.Allowed(id, method) {
+		logger.Warn().Msg("gRPC request denied")
+		return ctx, status.Errorf(codes.PermissionDenied, "userz: %s cannot call %s", id, method)
+	}
+
+	ctx = context.WithValue(ctx, identityKey{}, id)
+	return logger.WithContext(ctx), nil
+}
+
+// UnaryIdentity records the identity of the client from its certificate and
+// enforces the ACL, if not nil.
+func UnaryIdentity(acl ACL) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := withIdentity(ctx, acl, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamIdentity is the same as UnaryIdentity, for streams.
+func StreamIdentity(acl ACL) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := withIdentity(ss.Context(), acl, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &wrappedStream{ss, ctx})
+	}
+}
@@ -0,0 +1,154 @@
+package grpcutils_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/proto"
+)
+
+func TestACL(t *testing.T) {
+	assert := assert.New(t)
+
+	acl := grpcutils.ACL{
+		"reader": {"/proto.Userz/List", "/proto.Userz/Page"},
+		"writer": {"/proto.Userz/*"},
+		"admin":  {"*"},
+	}
+
+	assert.True(acl.Allowed("reader", "/proto.Userz/List"))
+	assert.False(acl.Allowed("reader", "/proto.Userz/Remove"))
+	assert.True(acl.Allowed("writer", "/proto.Userz/Remove"))
+	assert.False(acl.Allowed("writer", "/userz.v2.Userz/Remove"))
+	assert.True(acl.Allowed("admin", "/userz.v2.Userz/Remove"))
+	assert.False(acl.Allowed("", "/proto.Userz/List"))
+	assert.True(acl.Allowed("", "/grpc.health.v1.Health/Check"))
+}
+
+// certificate issues a certificate from the given template, signed by the
+// parent (self-signed if nil).
+func certificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	issuer, signer := template, any(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ca := certificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	cas := x509.NewCertPool()
+	cas.AddCert(ca.Leaf)
+
+	server := certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "userz"},
+		DNSNames:    []string{"userz"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+
+	clientURI, err := url.Parse("spiffe://test/client")
+	require.NoError(err)
+	client := certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ignored"},
+		URIs:        []*url.URL{clientURI},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	acl := grpcutils.ACL{
+		clientURI.String(): {"/proto.Userz/Update"},
+	}
+
+	store := &spyStore{}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{server},
+			ClientCAs:    cas,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})),
+		grpc.UnaryInterceptor(grpcutils.UnaryIdentity(acl)),
+	)
+	proto.RegisterUserzServer(s, proto.NewUserzServiceServer(store))
+	grpcutils.ServeHealth(context.Background(), s, func(context.Context) error { return nil }, time.Minute)
+
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{client},
+			RootCAs:      cas,
+			ServerName:   "userz",
+		})),
+	)
+	require.NoError(err)
+	defer conn.Close()
+
+	userzClient := proto.NewUserzClient(conn)
+
+	_, err = userzClient.Update(context.Background(), &proto.UpdateRequest{
+		ServiceOrigin: "spoofed",
+		Id:            "1",
+		Data:          &proto.UserData{},
+	})
+	require.NoError(err)
+	assert.Equal(clientURI.String(), grpcutils.Identity(store.ctx))
+	assert.Equal(clientURI.String(), proto.Origin(store.ctx, "spoofed"))
+
+	_, err = userzClient.Remove(context.Background(), &proto.RemoveRequest{Id: "1"})
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
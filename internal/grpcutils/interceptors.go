@@ -0,0 +1,147 @@
+// Package grpcutils holds the interceptors shared by the gRPC services.
+package grpcutils
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key carrying the request id, both in the
+// request and in the response headers.
+const RequestIDKey = "x-request-id"
+
+type requestIDKey struct{}
+
+// RequestID returns the id of the request, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequest stores in the context the request id, taken from the metadata
+// or generated, and a logger carrying it along with the method.
+func withRequest(ctx context.Context, logger zerolog.Logger, method string) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+	logger = logger.With().
+		Str("requestId", id).
+		Str("method", method).
+		Logger()
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return logger.WithContext(ctx)
+}
+
+func logCompletion(ctx context.Context, start time.Time, err error) {
+	zerolog.Ctx(ctx).Debug().
+		Str("code", status.Code(err).String()).
+		Dur("duration", time.Since(start)).
+		Msg("gRPC request served")
+}
+
+// UnaryLogger injects in the context the logger, with the request id.
+func UnaryLogger(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = withRequest(ctx, logger, info.FullMethod)
+
+		resp, err := handler(ctx, req)
+		logCompletion(ctx, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamLogger is the same as UnaryLogger, for streams.
+func StreamLogger(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := withRequest(ss.Context(), logger, info.FullMethod)
+
+		err := handler(srv, &wrappedStream{ss, ctx})
+		logCompletion(ctx, start, err)
+
+		return err
+	}
+}
+
+// UnaryRecovery turns the panics of the handlers, and of the interceptors
+// following it, into Internal errors. It has to be the first interceptor,
+// for all the panics to be recovered, so it logs them with the given logger,
+// as the one with the request id is not in the context yet.
+func UnaryRecovery(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverInto(logger, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is the same as UnaryRecovery, for streams.
+func StreamRecovery(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverInto(logger, info.FullMethod, &err)
+
+		return handler(srv, ss)
+	}
+}
+
+func recoverInto(logger zerolog.Logger, method string, err *error) {
+	if r := recover(); r != nil {
+		logger.Error().
+			Str("method", method).
+			Interface("panic", r).
+			Bytes("stack", debug.Stack()).
+			Msg("Recovered from panic in gRPC handler")
+
+		*err = status.Error(codes.Internal, "userz: there has been an internal error")
+	}
+}
+
+// UnaryDeadline applies the given timeout to the requests not carrying a
+// deadline already. The deadline reaches the store via the context.
+func UnaryDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// WrapStream returns the stream with its context replaced by ctx, for the
+// interceptors enriching it.
+func WrapStream(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &wrappedStream{ss, ctx}
+}
+
+// wrappedStream overrides the context of a stream.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
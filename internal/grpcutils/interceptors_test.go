@@ -0,0 +1,125 @@
+package grpcutils_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/proto"
+)
+
+// spyStore records the context of the last request and panics on Remove.
+type spyStore struct {
+	userz.Store
+	ctx context.Context
+}
+
+func (s *spyStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	s.ctx = ctx
+	return &userz.User{Id: id}, nil
+}
+
+func (s *spyStore) Remove(ctx context.Context, id string) (*userz.User, error) {
+	panic("boom")
+}
+
+func (s *spyStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	panic("boom")
+}
+
+func startServer(t *testing.T, store userz.Store, logger zerolog.Logger) proto.UserzClient {
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			grpcutils.UnaryRecovery(logger),
+			grpcutils.UnaryLogger(logger),
+			grpcutils.UnaryDeadline(time.Minute),
+		),
+		grpc.ChainStreamInterceptor(
+			grpcutils.StreamRecovery(logger),
+			grpcutils.StreamLogger(logger),
+		),
+	)
+	proto.RegisterUserzServer(s, proto.NewUserzServiceServer(store))
+
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return proto.NewUserzClient(conn)
+}
+
+func TestInterceptors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var logs bytes.Buffer
+	store := &spyStore{}
+	client := startServer(t, store, zerolog.New(&logs).Level(zerolog.DebugLevel))
+
+	// the request id is generated, the default deadline applied
+	var header metadata.MD
+	_, err := client.Update(context.Background(), &proto.UpdateRequest{Id: "1", Data: &proto.UserData{}}, grpc.Header(&header))
+	require.NoError(err)
+
+	generated := header.Get(grpcutils.RequestIDKey)
+	require.Len(generated, 1)
+	assert.NotEmpty(generated[0])
+	assert.Equal(generated[0], grpcutils.RequestID(store.ctx))
+
+	deadline, ok := store.ctx.Deadline()
+	require.True(ok)
+	assert.WithinDuration(time.Now().Add(time.Minute), deadline, 5*time.Second)
+	assert.Contains(logs.String(), generated[0])
+
+	// the request id and the deadline of the client are kept
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, grpcutils.RequestIDKey, "my-request")
+
+	_, err = client.Update(ctx, &proto.UpdateRequest{Id: "1", Data: &proto.UserData{}}, grpc.Header(&header))
+	require.NoError(err)
+	assert.Equal([]string{"my-request"}, header.Get(grpcutils.RequestIDKey))
+	assert.Equal("my-request", grpcutils.RequestID(store.ctx))
+
+	deadline, ok = store.ctx.Deadline()
+	require.True(ok)
+	assert.WithinDuration(time.Now().Add(10*time.Second), deadline, 5*time.Second)
+
+	// panics become Internal errors
+	_, err = client.Remove(context.Background(), &proto.RemoveRequest{Id: "1"})
+	assert.Equal(codes.Internal, status.Code(err))
+
+	stream, err := client.List(context.Background(), &proto.ListRequest{PageSize: 1})
+	require.NoError(err)
+	_, err = stream.Recv()
+	assert.Equal(codes.Internal, status.Code(err))
+
+	assert.Contains(logs.String(), "Recovered from panic in gRPC handler")
+
+	// the server is still alive
+	_, err = client.Update(context.Background(), &proto.UpdateRequest{Id: "1", Data: &proto.UserData{}})
+	assert.NoError(err)
+}
@@ -0,0 +1,28 @@
+package grpcutils
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// GracefulStop stops the server from accepting new connections and RPCs,
+// and waits for the pending ones to finish, streams included. When the
+// context is done first, the server is stopped anyway, cancelling the RPCs
+// still pending, and the error of the context is returned.
+func GracefulStop(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
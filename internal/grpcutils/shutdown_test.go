@@ -0,0 +1,159 @@
+package grpcutils_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/proto"
+)
+
+// steppedStore lists pages of a user each, every one only after a step.
+type steppedStore struct {
+	userz.Store
+	pages uint
+	step  chan struct{}
+}
+
+func (s *steppedStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	return &steppedIterator{store: s}, nil
+}
+
+type steppedIterator struct {
+	store *steppedStore
+	next  uint
+}
+
+func (i *steppedIterator) Len() userz.PaginationData {
+	return userz.NewPaginationData(i.store.pages, 1)
+}
+
+func (i *steppedIterator) Next(ctx context.Context) ([]*userz.User, error) {
+	if i.next == i.store.pages {
+		return nil, userz.ErrNoMorePages
+	}
+
+	select {
+	case <-i.store.step:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	i.next++
+
+	return []*userz.User{{Id: "user"}}, nil
+}
+
+// sigterm sends SIGTERM to the test itself, waiting for its arrival on the
+// context, which has to be notified of it.
+func sigterm(t *testing.T, signaled context.Context) {
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	select {
+	case <-signaled.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM not received")
+	}
+}
+
+func TestGracefulStop(t *testing.T) {
+	t.Run("drained", func(t *testing.T) {
+		testGracefulStop(t, true)
+	})
+
+	t.Run("cut", func(t *testing.T) {
+		testGracefulStop(t, false)
+	})
+}
+
+// testGracefulStop stops the server, on SIGTERM, while a List is in flight,
+// which is let finish if drained, or else is cut at the deadline.
+func testGracefulStop(t *testing.T, drained bool) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// the health goes down on SIGTERM
+	signaled, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	store := &steppedStore{pages: 3, step: make(chan struct{})}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	defer s.Stop()
+	proto.RegisterUserzServer(s, proto.NewUserzServiceServer(store))
+	grpcutils.ServeHealth(signaled, s, func(context.Context) error { return nil }, time.Minute)
+
+	go s.Serve(listener)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(err)
+	defer conn.Close()
+
+	client := proto.NewUserzClient(conn)
+	health := healthpb.NewHealthClient(conn)
+
+	stream, err := client.List(context.Background(), &proto.ListRequest{PageSize: 1})
+	require.NoError(err)
+
+	store.step <- struct{}{}
+	_, err = stream.Recv()
+	require.NoError(err)
+
+	// a long List is in flight
+	sigterm(t, signaled)
+	assert.Eventually(func() bool {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err == nil && resp.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	deadline := time.Second
+	if !drained {
+		deadline = 100 * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- grpcutils.GracefulStop(ctx, s)
+	}()
+
+	if drained {
+		// the stream is let finish
+		for i := 1; i < 3; i++ {
+			store.step <- struct{}{}
+			_, err = stream.Recv()
+			require.NoError(err)
+		}
+		_, err = stream.Recv()
+		assert.Equal(io.EOF, err)
+
+		assert.NoError(<-stopped)
+	} else {
+		// the stream is cut at the deadline
+		assert.ErrorIs(<-stopped, context.DeadlineExceeded)
+
+		_, err = stream.Recv()
+		assert.Error(err)
+		assert.NotEqual(io.EOF, err)
+	}
+}
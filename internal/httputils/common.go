@@ -5,30 +5,112 @@ import (
 	"net/http"
 )
 
-func Ok(w http.ResponseWriter, resp any) {
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeProblem = "application/problem+json"
+	// ProblemTypeDefault is the type of the problems with no more semantics
+	// than their status code (RFC 7807, section 4.2).
+	ProblemTypeDefault = "about:blank"
+)
+
+// Problem is the body of every error response (RFC 7807).
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors are the fields of the request that are not acceptable, if any.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError explains why a field of the request is not acceptable.
+type FieldError struct {
+	// Line locates the field in the body of the request, for the bodies
+	// made of many lines.
+	Line   uint   `json:"line,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// WriteProblem replies with the problem, having the status code and the
+// path of the request as instance, if missing.
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if problem.Type == "" {
+		problem.Type = ProblemTypeDefault
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Instance == "" && r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp any) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(resp)
 }
 
-func NotFound(w http.ResponseWriter, msg any) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(msg)
+func Ok(w http.ResponseWriter, resp any) {
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Created replies with the newly created resource, found at location.
+func Created(w http.ResponseWriter, location string, resp any) {
+	w.Header().Set("Location", location)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusNotFound, Detail: detail})
+}
+
+// BadRequest replies that the request is not acceptable, possibly because
+// of some of its fields.
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string, errs ...FieldError) {
+	WriteProblem(w, r, &Problem{Status: http.StatusBadRequest, Detail: detail, Errors: errs})
+}
+
+func Unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusUnauthorized, Detail: detail})
+}
+
+func Forbidden(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusForbidden, Detail: detail})
+}
+
+func NotAcceptable(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusNotAcceptable, Detail: detail})
+}
+
+func Conflict(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusConflict, Detail: detail})
+}
+
+func RequestEntityTooLarge(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusRequestEntityTooLarge, Detail: detail})
+}
+
+func UnsupportedMediaType(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusUnsupportedMediaType, Detail: detail})
+}
+
+// UnprocessableEntity replies that the content of the request is not
+// acceptable, because of some of its fields.
+func UnprocessableEntity(w http.ResponseWriter, r *http.Request, detail string, errs ...FieldError) {
+	WriteProblem(w, r, &Problem{Status: http.StatusUnprocessableEntity, Detail: detail, Errors: errs})
 }
 
-func BadRequest(w http.ResponseWriter, errMsg string) {
-	w.WriteHeader(http.StatusBadRequest)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": errMsg,
-	})
+func TooManyRequests(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusTooManyRequests, Detail: detail})
 }
 
-func ServerError(w http.ResponseWriter, msg string) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"reason": msg,
-	})
+func ServerError(w http.ResponseWriter, r *http.Request, detail string) {
+	WriteProblem(w, r, &Problem{Status: http.StatusInternalServerError, Detail: detail})
 }
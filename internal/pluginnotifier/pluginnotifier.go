@@ -0,0 +1,43 @@
+// Package pluginnotifier loads a notifier from a Go plugin. It is registered
+// as "plugin" and expects the path of the .so in the "path" configuration
+// key. The plugin has to expose a symbol called Provider of type
+// notifier.Notifier.
+package pluginnotifier
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+const name = "plugin"
+
+func init() {
+	notifier.Register(name, NewNotifier)
+}
+
+// NewNotifier opens the plugin at config["path"] and returns its Provider.
+func NewNotifier(config map[string]string) (notifier.Notifier, error) {
+	path := config["path"]
+	if path == "" {
+		return nil, fmt.Errorf("the %s notifier needs a path", name)
+	}
+
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := plug.Lookup("Provider")
+	if err != nil {
+		return nil, err
+	}
+
+	ref, ok := (sym).(*notifier.Notifier)
+	if !ok {
+		return nil, fmt.Errorf("Not a notifier: %T", sym)
+	}
+
+	return *ref, nil
+}
@@ -0,0 +1,238 @@
+package pollednotifier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// errUnknownGroup is returned acknowledging for a group that never joined,
+// not to create it by mistake, as it would prevent evictions.
+var errUnknownGroup = errors.New("no such group")
+
+// buffer holds the notifications ordered by sequence number. Entries are
+// evicted once every consumer group acknowledged them, or when the capacity
+// is reached, oldest first.
+type buffer struct {
+	capacity int
+	entries  []*notification
+	// lastSeq is the sequence number of the last appended notification.
+	lastSeq uint64
+	// overflowSeq is the highest sequence number evicted because of the
+	// capacity, regardless of the acknowledgements.
+	overflowSeq uint64
+	// overflowed counts the notifications evicted because of the capacity.
+	overflowed uint64
+	// groups maps every consumer group to the last acknowledged sequence
+	// number.
+	groups map[string]uint64
+	// wake is closed, and replaced, at every append.
+	wake chan struct{}
+}
+
+// readResult is the outcome of a read on the buffer.
+type readResult struct {
+	Notifications []*notification `json:"notifications"`
+	// LastSeq is the sequence number of the last notification in the
+	// buffer.
+	LastSeq uint64 `json:"last_seq"`
+	// Overflow is true when some of the notifications after the requested
+	// sequence number have been evicted before being read.
+	Overflow bool `json:"overflow"`
+}
+
+func newBuffer(capacity int) *buffer {
+	return &buffer{
+		capacity: capacity,
+		groups:   make(map[string]uint64),
+		wake:     make(chan struct{}),
+	}
+}
+
+// restore fills the buffer with notifications recovered from disk, keeping
+// their sequence numbers, and evicts what the groups already acknowledged.
+// The notifications exceeding the capacity are evicted as overflowed, unless
+// already counted in the state.
+func (b *buffer) restore(entries []*notification, state *logState) {
+	for group, seq := range state.Groups {
+		b.groups[group] = seq
+		if seq > b.lastSeq {
+			b.lastSeq = seq
+		}
+	}
+
+	b.overflowSeq = state.OverflowSeq
+	b.overflowed = state.Overflowed
+	if b.overflowSeq > b.lastSeq {
+		b.lastSeq = b.overflowSeq
+	}
+
+	if len(entries) > 0 && entries[len(entries)-1].Seq > b.lastSeq {
+		b.lastSeq = entries[len(entries)-1].Seq
+	}
+
+	if len(entries) > b.capacity {
+		for _, evicted := range entries[:len(entries)-b.capacity] {
+			if evicted.Seq > b.overflowSeq {
+				b.overflowSeq = evicted.Seq
+				b.overflowed++
+			}
+		}
+		entries = entries[len(entries)-b.capacity:]
+	}
+
+	b.entries = entries
+	b.compact()
+}
+
+// state returns what has to be kept alongside the notifications, to restore
+// the buffer.
+func (b *buffer) state() *logState {
+	return &logState{
+		Groups:      b.offsets(),
+		OverflowSeq: b.overflowSeq,
+		Overflowed:  b.overflowed,
+	}
+}
+
+// nextSeq returns the sequence number the next appended notification gets.
+func (b *buffer) nextSeq() uint64 {
+	return b.lastSeq + 1
+}
+
+// firstSeq returns the sequence number of the oldest notification in the
+// buffer, or of the next one if the buffer is empty.
+func (b *buffer) firstSeq() uint64 {
+	if len(b.entries) == 0 {
+		return b.lastSeq + 1
+	}
+
+	return b.entries[0].Seq
+}
+
+// append assigns the next sequence number to the notification and stores
+// it, evicting the oldest entry if the buffer is full. It returns true if an
+// entry has been evicted because of the capacity.
+func (b *buffer) append(n *notification) bool {
+	b.lastSeq++
+	n.Seq = b.lastSeq
+
+	var overflow bool
+	if len(b.entries) >= b.capacity {
+		b.overflowSeq = b.entries[0].Seq
+		b.overflowed++
+		b.entries = b.entries[1:]
+		overflow = true
+	}
+
+	b.entries = append(b.entries, n)
+
+	close(b.wake)
+	b.wake = make(chan struct{})
+
+	return overflow
+}
+
+// changed returns a channel that gets closed at the next append.
+func (b *buffer) changed() <-chan struct{} {
+	return b.wake
+}
+
+// read returns at most limit notifications with a sequence number greater
+// than after.
+func (b *buffer) read(after uint64, limit int) *readResult {
+	start := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].Seq > after
+	})
+
+	end := len(b.entries)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	notifications := make([]*notification, end-start)
+	copy(notifications, b.entries[start:end])
+
+	return &readResult{
+		Notifications: notifications,
+		LastSeq:       b.lastSeq,
+		Overflow:      after < b.overflowSeq,
+	}
+}
+
+// join registers a consumer group, if not yet known, and returns its last
+// acknowledged sequence number.
+func (b *buffer) join(group string) uint64 {
+	seq, ok := b.groups[group]
+	if !ok {
+		b.groups[group] = 0
+	}
+
+	return seq
+}
+
+// ack moves the offset of the group up to seq and evicts the notifications
+// acknowledged by every group. Acknowledging a sequence number lower than
+// the current offset is a no-op. The group has to be joined first.
+func (b *buffer) ack(group string, seq uint64) error {
+	if _, ok := b.groups[group]; !ok {
+		return errUnknownGroup
+	}
+
+	if seq > b.lastSeq {
+		return fmt.Errorf("cannot acknowledge %d, the last notification is %d", seq, b.lastSeq)
+	}
+
+	if seq > b.groups[group] {
+		b.groups[group] = seq
+	}
+
+	b.compact()
+
+	return nil
+}
+
+// leave removes a consumer group, so that it no longer prevents evictions.
+func (b *buffer) leave(group string) bool {
+	if _, ok := b.groups[group]; !ok {
+		return false
+	}
+
+	delete(b.groups, group)
+	b.compact()
+
+	return true
+}
+
+// offsets returns a copy of the offsets of all the consumer groups.
+func (b *buffer) offsets() map[string]uint64 {
+	offsets := make(map[string]uint64, len(b.groups))
+	for group, seq := range b.groups {
+		offsets[group] = seq
+	}
+
+	return offsets
+}
+
+// compact evicts the notifications acknowledged by every consumer group.
+// Without groups, nothing is evicted.
+func (b *buffer) compact() {
+	if len(b.groups) == 0 {
+		return
+	}
+
+	var acked uint64
+	first := true
+	for _, seq := range b.groups {
+		if first || seq < acked {
+			acked = seq
+			first = false
+		}
+	}
+
+	idx := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].Seq > acked
+	})
+
+	b.entries = b.entries[idx:]
+}
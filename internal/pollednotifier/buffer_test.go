@@ -0,0 +1,96 @@
+package pollednotifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+func seqs(notifications []*notification) []uint64 {
+	var result []uint64
+	for _, n := range notifications {
+		result = append(result, n.Seq)
+	}
+	return result
+}
+
+func TestBufferReadIsNotDestructive(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := newBuffer(10)
+	for i := 0; i < 5; i++ {
+		buf.append(&notification{Event: notifier.NotifyAccountCreated})
+	}
+
+	first := buf.read(0, 0)
+	second := buf.read(0, 0)
+	assert.Equal([]uint64{1, 2, 3, 4, 5}, seqs(first.Notifications))
+	assert.Equal(seqs(first.Notifications), seqs(second.Notifications))
+	assert.Equal(uint64(5), first.LastSeq)
+	assert.False(first.Overflow)
+
+	assert.Equal([]uint64{3, 4}, seqs(buf.read(2, 2).Notifications))
+	assert.Empty(buf.read(5, 0).Notifications)
+}
+
+func TestBufferGroups(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	buf := newBuffer(10)
+	for i := 0; i < 5; i++ {
+		buf.append(&notification{Event: notifier.NotifyAccountCreated})
+	}
+
+	assert.Equal(uint64(0), buf.join("a"))
+	assert.Equal(uint64(0), buf.join("b"))
+
+	require.NoError(buf.ack("a", 4))
+	// b did not acknowledge anything, so nothing is evicted
+	assert.Len(buf.entries, 5)
+
+	require.NoError(buf.ack("b", 2))
+	assert.Equal([]uint64{3, 4, 5}, seqs(buf.entries))
+
+	// acknowledgements are monotonic
+	require.NoError(buf.ack("a", 1))
+	assert.Equal(uint64(4), buf.join("a"))
+
+	assert.Error(buf.ack("a", 6))
+	// unknown groups are not created
+	assert.ErrorIs(buf.ack("c", 1), errUnknownGroup)
+	assert.NotContains(buf.offsets(), "c")
+
+	assert.True(buf.leave("b"))
+	assert.False(buf.leave("b"))
+	assert.Equal([]uint64{5}, seqs(buf.entries))
+	assert.Equal(map[string]uint64{"a": 4}, buf.offsets())
+}
+
+func TestBufferOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := newBuffer(3)
+	buf.join("a")
+
+	var overflows int
+	for i := 0; i < 5; i++ {
+		if buf.append(&notification{Event: notifier.NotifyAccountUpdated}) {
+			overflows++
+		}
+	}
+
+	assert.Equal(2, overflows)
+	assert.Equal(uint64(2), buf.overflowed)
+
+	result := buf.read(0, 0)
+	assert.Equal([]uint64{3, 4, 5}, seqs(result.Notifications))
+	assert.True(result.Overflow)
+
+	result = buf.read(2, 0)
+	assert.Equal([]uint64{3, 4, 5}, seqs(result.Notifications))
+	assert.False(result.Overflow)
+}
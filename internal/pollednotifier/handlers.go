@@ -0,0 +1,226 @@
+package pollednotifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	defaultLimit = 1000
+	maxWait      = 60 * time.Second
+)
+
+type ackRequest struct {
+	Seq uint64 `json:"seq"`
+}
+
+func (n *polledNotifier) router(logger *zerolog.Logger) chi.Router {
+	router := chi.NewRouter()
+	if logger != nil {
+		router.Use(httputils.LoggerMiddleware(*logger))
+	}
+
+	router.Get(defaultRoute, n.handleRead)
+	router.Get(defaultRoute+"/stream", n.handleStream)
+	router.Get(defaultRoute+"/groups", n.handleGroups)
+	router.Post(defaultRoute+"/groups/{group}/ack", n.handleAck)
+	router.Delete(defaultRoute+"/groups/{group}", n.handleLeave)
+
+	return router
+}
+
+// handleRead returns the notifications after the given sequence number,
+// without consuming them. The starting point is either the after query
+// parameter or, if missing, the offset of the given consumer group. With the
+// wait query parameter, if no notification is available, the request is held
+// until one arrives or the given duration elapses (long polling).
+func (n *polledNotifier) handleRead(w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context()).
+		With().
+		Str("Handler", "Notifier").
+		Logger()
+
+	query := r.URL.Query()
+
+	var after uint64
+	if afterStr := query.Get("after"); afterStr != "" {
+		var err error
+		after, err = strconv.ParseUint(afterStr, 10, 64)
+		if err != nil {
+			logger.Debug().Err(err).Msg("after must be a non negative integer")
+			httputils.BadRequest(w, r, "after must be a non negative integer")
+			return
+		}
+	}
+
+	limit := defaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			logger.Debug().Msg("limit must be a positive integer")
+			httputils.BadRequest(w, r, "limit must be a positive integer")
+			return
+		}
+	}
+
+	var timeout <-chan time.Time
+	if waitStr := query.Get("wait"); waitStr != "" {
+		wait, err := time.ParseDuration(waitStr)
+		if err != nil || wait < 0 {
+			logger.Debug().Msg("wait must be a non negative duration")
+			httputils.BadRequest(w, r, "wait must be a non negative duration")
+			return
+		}
+
+		if wait > maxWait {
+			wait = maxWait
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	if group := query.Get("group"); group != "" {
+		n.mu.Lock()
+		acked := n.buf.join(group)
+		n.mu.Unlock()
+
+		if query.Get("after") == "" {
+			after = acked
+		}
+	}
+
+	result := n.next(r.Context(), after, limit, timeout)
+
+	if result.Overflow {
+		logger.Warn().
+			Uint64("after", after).
+			Msg("Notifications evicted before being read")
+	}
+
+	httputils.Ok(w, result)
+}
+
+// next reads the notifications after the given sequence number. If there are
+// none, it waits for new ones until the timeout fires, the request is
+// canceled or the notifier is shut down. A nil timeout means no waiting.
+func (n *polledNotifier) next(ctx context.Context, after uint64, limit int, timeout <-chan time.Time) *readResult {
+	for {
+		n.mu.Lock()
+		result := n.buf.read(after, limit)
+		changed := n.buf.changed()
+		n.mu.Unlock()
+
+		if len(result.Notifications) > 0 || timeout == nil {
+			return result
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return result
+		case <-ctx.Done():
+			return result
+		case <-n.done:
+			return result
+		}
+	}
+}
+
+// handleGroups returns the offsets of all the consumer groups.
+func (n *polledNotifier) handleGroups(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	offsets := n.buf.offsets()
+	n.mu.Unlock()
+
+	httputils.Ok(w, offsets)
+}
+
+// handleAck moves the offset of a consumer group, allowing the eviction of
+// the notifications every group acknowledged.
+func (n *polledNotifier) handleAck(w http.ResponseWriter, r *http.Request) {
+	group := chi.URLParam(r, "group")
+	logger := zerolog.Ctx(r.Context()).
+		With().
+		Str("Handler", "Notifier").
+		Str("group", group).
+		Logger()
+
+	var req ackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Debug().Err(err).Msg("Failure in decoding request body")
+		httputils.BadRequest(w, r, "Malformed request body")
+		return
+	}
+
+	n.mu.Lock()
+	err := n.buf.ack(group, req.Seq)
+	offset := n.buf.groups[group]
+	var snap *snapshot
+	if err == nil {
+		snap = n.snapshot()
+	}
+	n.mu.Unlock()
+
+	persistErr := n.persist(snap)
+
+	if errors.Is(err, errUnknownGroup) {
+		httputils.NotFound(w, r, "No such group")
+		return
+	}
+
+	if err != nil {
+		logger.Debug().Err(err).Msg("Invalid acknowledgement")
+		httputils.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if persistErr != nil {
+		logger.Err(persistErr).Msg("Failed to persist the acknowledgement")
+		httputils.ServerError(w, r, "Failed to persist the acknowledgement")
+		return
+	}
+
+	logger.Debug().Uint64("seq", offset).Msg("Notifications acknowledged")
+	httputils.Ok(w, ackRequest{Seq: offset})
+}
+
+// handleLeave removes a consumer group.
+func (n *polledNotifier) handleLeave(w http.ResponseWriter, r *http.Request) {
+	group := chi.URLParam(r, "group")
+
+	n.mu.Lock()
+	found := n.buf.leave(group)
+	var snap *snapshot
+	if found {
+		snap = n.snapshot()
+	}
+	n.mu.Unlock()
+
+	persistErr := n.persist(snap)
+
+	if !found {
+		httputils.NotFound(w, r, "No such group")
+		return
+	}
+
+	if persistErr != nil {
+		zerolog.Ctx(r.Context()).Err(persistErr).Str("group", group).Msg("Failed to persist the group removal")
+		httputils.ServerError(w, r, "Failed to persist the group removal")
+		return
+	}
+
+	zerolog.Ctx(r.Context()).Info().Str("group", group).Msg("Consumer group removed")
+	httputils.Ok(w, group)
+}
@@ -0,0 +1,86 @@
+package pollednotifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+func TestHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	n := &polledNotifier{buf: newBuffer(10)}
+	for i := 0; i < 3; i++ {
+		n.buf.append(&notification{
+			Event:    notifier.NotifyAccountCreated,
+			Metadata: map[string]string{"id": "1"},
+		})
+	}
+	router := n.router(nil)
+
+	read := func(query string) *readResult {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+defaultRoute+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(http.StatusOK, w.Code)
+
+		var result readResult
+		require.NoError(json.NewDecoder(w.Body).Decode(&result))
+		return &result
+	}
+
+	// two consumer groups see the same notifications
+	assert.Equal([]uint64{1, 2, 3}, seqs(read("?group=a").Notifications))
+	assert.Equal([]uint64{1, 2, 3}, seqs(read("?group=b").Notifications))
+	assert.Equal([]uint64{2}, seqs(read("?after=1&limit=1").Notifications))
+
+	// acknowledge for a
+	req := httptest.NewRequest(http.MethodPost, "http://localhost"+defaultRoute+"/groups/a/ack", bytes.NewBufferString(`{"seq": 2}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+
+	assert.Equal([]uint64{3}, seqs(read("?group=a").Notifications))
+	assert.Equal([]uint64{1, 2, 3}, seqs(read("?group=b").Notifications))
+
+	// acknowledging the future is not allowed
+	req = httptest.NewRequest(http.MethodPost, "http://localhost"+defaultRoute+"/groups/a/ack", bytes.NewBufferString(`{"seq": 4}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// a typo does not create a group
+	req = httptest.NewRequest(http.MethodPost, "http://localhost"+defaultRoute+"/groups/typo/ack", bytes.NewBufferString(`{"seq": 1}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	// offsets
+	req = httptest.NewRequest(http.MethodGet, "http://localhost"+defaultRoute+"/groups", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+	var offsets map[string]uint64
+	require.NoError(json.NewDecoder(w.Body).Decode(&offsets))
+	assert.Equal(map[string]uint64{"a": 2, "b": 0}, offsets)
+
+	// removing b allows the eviction of what a acknowledged
+	req = httptest.NewRequest(http.MethodDelete, "http://localhost"+defaultRoute+"/groups/b", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+	assert.Equal([]uint64{3}, seqs(read("").Notifications))
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost"+defaultRoute+"?after=nope", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,412 @@
+package pollednotifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentExt         = ".log"
+	stateFile          = "state.json"
+	defaultSegmentSize = 16 << 20 // 16MiB
+)
+
+// logState is kept alongside the segments: the offsets of the consumer
+// groups, and the evictions because of the capacity, which the segments do
+// not tell anymore once compacted.
+type logState struct {
+	Groups      map[string]uint64 `json:"groups"`
+	OverflowSeq uint64            `json:"overflow_seq"`
+	Overflowed  uint64            `json:"overflowed"`
+}
+
+// fsyncPolicy tells when the segment log is flushed to disk.
+type fsyncPolicy string
+
+const (
+	// fsyncAlways syncs after every append.
+	fsyncAlways fsyncPolicy = "always"
+	// fsyncInterval syncs periodically, if anything has been appended.
+	fsyncInterval fsyncPolicy = "interval"
+	// fsyncNever leaves the flushing to the operating system.
+	fsyncNever fsyncPolicy = "never"
+)
+
+func parseFsyncPolicy(s string) (fsyncPolicy, error) {
+	switch p := fsyncPolicy(s); p {
+	case fsyncAlways, fsyncInterval, fsyncNever:
+		return p, nil
+	case "":
+		return fsyncInterval, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy: %s", s)
+	}
+}
+
+// segmentLog is an append-only log of notifications on disk, split in
+// segments named after the sequence number of their first notification.
+// Each segment holds one JSON-serialized notification per line. The
+// logState is kept alongside, in a separate file.
+type segmentLog struct {
+	dir         string
+	policy      fsyncPolicy
+	segmentSize int64
+
+	// segments holds the first sequence number of every segment, sorted.
+	// The last one is the active segment.
+	segments   []uint64
+	active     *os.File
+	activeSize int64
+	dirty      bool
+	stop       chan struct{}
+
+	mu sync.Mutex
+}
+
+// openSegmentLog opens, or creates, the log in dir and returns the recovered
+// notifications and state.
+func openSegmentLog(dir string, policy fsyncPolicy, interval time.Duration, segmentSize int64) (*segmentLog, []*notification, *logState, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, nil, nil, err
+	}
+
+	l := &segmentLog{
+		dir:         dir,
+		policy:      policy,
+		segmentSize: segmentSize,
+		stop:        make(chan struct{}),
+	}
+
+	entries, err := l.recover()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	state, err := l.loadState()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if policy == fsyncInterval {
+		go l.syncEvery(interval)
+	}
+
+	return l, entries, state, nil
+}
+
+func (l *segmentLog) segmentPath(first uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+// recover reads all the segments, in order, truncating a partially written
+// last line of the active segment.
+func (l *segmentLog) recover() ([]*notification, error) {
+	matches, err := filepath.Glob(filepath.Join(l.dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(match), segmentExt), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected file in the notification log: %s", match)
+		}
+		l.segments = append(l.segments, first)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	var entries []*notification
+	for i, first := range l.segments {
+		last := i == len(l.segments)-1
+
+		segmentEntries, size, err := readSegment(l.segmentPath(first), last)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, segmentEntries...)
+
+		if last {
+			l.active, err = os.OpenFile(l.segmentPath(first), os.O_WRONLY|os.O_APPEND, 0o640)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := l.active.Truncate(size); err != nil {
+				return nil, err
+			}
+			l.activeSize = size
+		}
+	}
+
+	return entries, nil
+}
+
+// readSegment returns the notifications in the segment and the size of the
+// well-formed part of it. A malformed last line is tolerated only if
+// tolerateTail is true, as it is the result of an interrupted write.
+func readSegment(path string, tolerateTail bool) ([]*notification, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var entries []*notification
+	var size int64
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 && !tolerateTail {
+				return nil, 0, fmt.Errorf("truncated segment: %s", path)
+			}
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var n notification
+		if err := json.Unmarshal(bytes.TrimSpace(line), &n); err != nil {
+			if tolerateTail {
+				if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+					return entries, size, nil
+				}
+			}
+			return nil, 0, fmt.Errorf("corrupted segment %s: %w", path, err)
+		}
+
+		entries = append(entries, &n)
+		size += int64(len(line))
+	}
+}
+
+func (l *segmentLog) loadState() (*logState, error) {
+	state := &logState{Groups: make(map[string]uint64)}
+
+	data, err := os.ReadFile(filepath.Join(l.dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("corrupted state file: %w", err)
+	}
+	if state.Groups == nil {
+		state.Groups = make(map[string]uint64)
+	}
+
+	return state, nil
+}
+
+// append writes the notification to the active segment, rotating it if it
+// exceeds the segment size.
+func (l *segmentLog) append(n *notification) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if l.active == nil || l.activeSize >= l.segmentSize {
+		if err := l.rotate(n.Seq); err != nil {
+			return err
+		}
+	}
+
+	written, err := l.active.Write(data)
+	l.activeSize += int64(written)
+	if err != nil {
+		return err
+	}
+
+	if l.policy == fsyncAlways {
+		return l.active.Sync()
+	}
+	l.dirty = true
+
+	return nil
+}
+
+// rotate closes the active segment and opens a new one starting at first.
+func (l *segmentLog) rotate(first uint64) error {
+	if l.active != nil {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+		if err := l.active.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.segmentPath(first), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if err := syncDir(l.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	l.active = f
+	l.activeSize = 0
+	l.dirty = false
+	l.segments = append(l.segments, first)
+
+	return nil
+}
+
+// saveState atomically replaces the state on disk.
+func (l *segmentLog) saveState(state *logState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(l.dir, stateFile+".tmp")
+	if err := writeSynced(tmp, data); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(l.dir, stateFile)); err != nil {
+		return err
+	}
+
+	return syncDir(l.dir)
+}
+
+// compactable tells whether compact would remove any segment.
+func (l *segmentLog) compactable(firstSeq uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.segments) > 1 && l.segments[1] <= firstSeq
+}
+
+// compact removes the segments holding only notifications preceding
+// firstSeq. The active segment is never removed.
+func (l *segmentLog) compact(firstSeq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var removed int
+	for i := 0; i < len(l.segments)-1; i++ {
+		if l.segments[i+1] > firstSeq {
+			break
+		}
+
+		if err := os.Remove(l.segmentPath(l.segments[i])); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	if removed == 0 {
+		return nil
+	}
+
+	l.segments = l.segments[removed:]
+
+	return syncDir(l.dir)
+}
+
+func (l *segmentLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty || l.active == nil {
+		return nil
+	}
+
+	// still dirty if failed, to be retried
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+
+	return nil
+}
+
+func (l *segmentLog) syncEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			// retried at the next tick, and at close
+			_ = l.sync()
+		}
+	}
+}
+
+// close flushes and closes the active segment.
+func (l *segmentLog) close() error {
+	close(l.stop)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active == nil {
+		return nil
+	}
+
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+
+	err := l.active.Close()
+	l.active = nil
+
+	return err
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
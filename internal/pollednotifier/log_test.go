@@ -0,0 +1,211 @@
+package pollednotifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+func TestSegmentLog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+
+	log, entries, state, err := openSegmentLog(dir, fsyncAlways, time.Second, 100)
+	require.NoError(err)
+	assert.Empty(entries)
+	assert.Empty(state.Groups)
+
+	buf := newBuffer(10)
+	for i := 0; i < 6; i++ {
+		n := &notification{
+			Event:    notifier.NotifyAccountCreated,
+			Metadata: map[string]string{"id": "some-id"},
+		}
+		buf.append(n)
+		require.NoError(log.append(n))
+	}
+
+	// every notification is ~55 bytes, so each segment holds two of them
+	assert.Equal([]uint64{1, 3, 5}, log.segments)
+
+	buf.join("a")
+	require.NoError(buf.ack("a", 3))
+	require.NoError(log.saveState(buf.state()))
+	require.NoError(log.compact(buf.firstSeq()))
+	// 4 is still needed
+	assert.Equal([]uint64{3, 5}, log.segments)
+
+	require.NoError(log.close())
+
+	// simulate a torn write
+	f, err := os.OpenFile(log.segmentPath(5), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(err)
+	_, err = f.WriteString(`{"seq":7,"ev`)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	log, entries, state, err = openSegmentLog(dir, fsyncNever, time.Second, 100)
+	require.NoError(err)
+	defer log.close()
+
+	assert.Equal([]uint64{3, 4, 5, 6}, seqs(entries))
+	assert.Equal(map[string]uint64{"a": 3}, state.Groups)
+
+	restored := newBuffer(10)
+	restored.restore(entries, state)
+	assert.Equal([]uint64{4, 5, 6}, seqs(restored.entries))
+
+	// the numbering continues
+	n := &notification{Event: notifier.NotifyAccountRemoved}
+	restored.append(n)
+	assert.Equal(uint64(7), n.Seq)
+	require.NoError(log.append(n))
+
+	active := log.segments[len(log.segments)-1]
+	recovered, size, err := readSegment(log.segmentPath(active), false)
+	require.NoError(err)
+	assert.Equal(log.activeSize, size)
+	assert.Equal(uint64(7), recovered[len(recovered)-1].Seq)
+}
+
+func TestSegmentLogCorruption(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "00000000000000000001.log"), []byte("garbage\n{\"seq\":2}\n"), 0o640))
+	require.NoError(os.WriteFile(filepath.Join(dir, "00000000000000000003.log"), []byte("{\"seq\":3}\n"), 0o640))
+
+	_, _, _, err := openSegmentLog(dir, fsyncNever, time.Second, 100)
+	require.Error(err)
+}
+
+func TestDurableNotifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+
+	n := &polledNotifier{
+		config: map[string]string{"dir": dir, "fsync": "always"},
+		buf:    newBuffer(10),
+	}
+	require.NoError(n.openLog(&logger))
+
+	for i := 0; i < 3; i++ {
+		notification := &notification{Event: notifier.NotifyAccountUpdated}
+		n.buf.append(notification)
+		require.NoError(n.log.append(notification))
+	}
+	n.buf.join("a")
+	require.NoError(n.buf.ack("a", 1))
+	require.NoError(n.persist(n.snapshot()))
+	require.NoError(n.log.close())
+
+	// restart
+	n = &polledNotifier{
+		config: map[string]string{"dir": dir},
+		buf:    newBuffer(10),
+	}
+	require.NoError(n.openLog(&logger))
+	defer n.log.close()
+
+	assert.Equal([]uint64{2, 3}, seqs(n.buf.entries))
+	assert.Equal(map[string]uint64{"a": 1}, n.buf.offsets())
+
+	n.config["fsync"] = "sometimes"
+	assert.Error(n.openLog(&logger))
+}
+
+func TestDurableOverflow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	config := map[string]string{"dir": dir, "fsync": "always", "segment_size": "100"}
+
+	n := &polledNotifier{config: config, buf: newBuffer(3)}
+	require.NoError(n.openLog(&logger))
+
+	for i := 0; i < 8; i++ {
+		n.receive(&logger, &notification{Event: notifier.NotifyAccountUpdated})
+	}
+	assert.Equal(uint64(5), n.buf.overflowed)
+	assert.Equal(uint64(5), n.buf.overflowSeq)
+	// the segments of the overflowed notifications are gone
+	assert.Less(len(n.log.segments), 4)
+	require.NoError(n.log.close())
+
+	// restart
+	n = &polledNotifier{config: config, buf: newBuffer(3)}
+	require.NoError(n.openLog(&logger))
+	defer n.log.close()
+
+	assert.Equal([]uint64{6, 7, 8}, seqs(n.buf.entries))
+	assert.Equal(uint64(5), n.buf.overflowed)
+	assert.True(n.buf.read(0, 0).Overflow)
+	assert.False(n.buf.read(5, 0).Overflow)
+}
+
+func TestSegmentLogSyncRetried(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	log, _, _, err := openSegmentLog(t.TempDir(), fsyncNever, time.Second, 100)
+	require.NoError(err)
+	require.NoError(log.append(&notification{Seq: 1}))
+
+	// the sync fails, and is to be retried
+	active := log.active
+	log.active, err = os.Open(os.DevNull)
+	require.NoError(err)
+	require.NoError(log.active.Close())
+	assert.Error(log.sync())
+	assert.True(log.dirty)
+
+	log.active = active
+	assert.NoError(log.sync())
+	assert.False(log.dirty)
+	require.NoError(log.close())
+}
+
+func TestPersistOrdered(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+
+	n := &polledNotifier{
+		config: map[string]string{"dir": dir},
+		buf:    newBuffer(10),
+	}
+	require.NoError(n.openLog(&logger))
+	defer n.log.close()
+
+	for i := 0; i < 3; i++ {
+		n.buf.append(&notification{Event: notifier.NotifyAccountUpdated})
+	}
+	n.buf.join("a")
+	older := n.snapshot()
+	require.NoError(n.buf.ack("a", 2))
+	newer := n.snapshot()
+
+	// the snapshots are written outside of the lock, in any order
+	require.NoError(n.persist(newer))
+	require.NoError(n.persist(older))
+
+	state, err := n.log.loadState()
+	require.NoError(err)
+	assert.Equal(map[string]uint64{"a": 2}, state.Groups)
+}
@@ -0,0 +1,20 @@
+// This is the entrypoint to build the polled notifier as a plugin, to be
+// loaded by the "plugin" notifier:
+//
+//	go build -buildmode=plugin -o pollednotifier.so ./internal/pollednotifier/plugin
+package main
+
+import (
+	"github.com/leophys/userz/internal/pollednotifier"
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+var Provider notifier.Notifier
+
+func init() {
+	// the polled notifier only reads its configuration in Init, so this
+	// cannot fail
+	Provider, _ = pollednotifier.NewNotifier(nil)
+}
+
+func main() {}
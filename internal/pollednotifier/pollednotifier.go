@@ -1,103 +1,119 @@
-package main
+// Package pollednotifier implements a notifier that keeps the notifications
+// in a buffer and exposes them to be polled via HTTP. It is registered as
+// "polled".
+package pollednotifier
 
 import (
-	"container/ring"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 
-	"github.com/leophys/userz/internal/httputils"
 	"github.com/leophys/userz/pkg/notifier"
 )
 
 const (
+	name         = "polled"
 	defaultPort  = 8000
 	defaultSize  = 10000
 	defaultRoute = "/notifications"
 )
 
+const defaultFsyncInterval = time.Second
+
 var (
-	envPort = "NOTIFIER_PORT"
-	envSize = "NOTIFIER_BUFFER_SIZE"
+	envPort          = "NOTIFIER_PORT"
+	envSize          = "NOTIFIER_BUFFER_SIZE"
+	envDir           = "NOTIFIER_DIR"
+	envFsync         = "NOTIFIER_FSYNC"
+	envFsyncInterval = "NOTIFIER_FSYNC_INTERVAL"
+	envSegmentSize   = "NOTIFIER_SEGMENT_SIZE"
 )
 
-var Provider notifier.Notifier = &polledNotifier{}
+func init() {
+	notifier.Register(name, NewNotifier)
+}
+
+// NewNotifier returns a polled notifier. The accepted configuration keys are
+// "port" and "size"; when missing, they are taken from the NOTIFIER_PORT and
+// NOTIFIER_BUFFER_SIZE environment variables, or from the defaults.
+//
+// By default the buffer lives only in memory. Setting "dir" (or NOTIFIER_DIR)
+// makes it durable, backed by a segment log in that directory which is
+// recovered at startup. The log is tuned by "fsync" (always, interval or
+// never, defaults to interval), "fsync_interval" (defaults to 1s) and
+// "segment_size" (in bytes, defaults to 16MiB), or by the corresponding
+// NOTIFIER_FSYNC, NOTIFIER_FSYNC_INTERVAL and NOTIFIER_SEGMENT_SIZE.
+func NewNotifier(config map[string]string) (notifier.Notifier, error) {
+	return &polledNotifier{
+		config: config,
+	}, nil
+}
 
 type notification struct {
+	Seq      uint64                     `json:"seq"`
 	Event    notifier.NotificationEvent `json:"event"`
 	Metadata map[string]string          `json:"metadata,omitempty"`
 }
 
 type polledNotifier struct {
+	config map[string]string
 	notify chan *notification
-	buf    *ring.Ring
+	// flushes are served by listen, to drain notify
+	flushes chan chan struct{}
+	buf     *buffer
+	log     *segmentLog
+	// done ends the long polls and the streams, when the notifier stops
+	// or is flushed
+	done        <-chan struct{}
+	stopServing context.CancelFunc
+	server      *http.Server
 
 	mu sync.Mutex
+	// snapshots counts the snapshots taken, under mu
+	snapshots uint64
+
+	// persistMu orders the writes of the snapshots, outside of mu
+	persistMu sync.Mutex
+	persisted uint64
+}
+
+// snapshot is the state of the buffer to persist.
+type snapshot struct {
+	version  uint64
+	state    *logState
+	firstSeq uint64
 }
 
 func (n *polledNotifier) Init(ctx context.Context) error {
 	logger := zerolog.Ctx(ctx)
 
-	port := defaultPort
-	size := defaultSize
-
-	if envPortStr := os.Getenv(envPort); envPortStr != "" {
-		envPort, err := strconv.Atoi(envPortStr)
-		if err != nil {
-			return err
-		}
-		port = envPort
-	}
-
-	if envSizeStr := os.Getenv(envSize); envSizeStr != "" {
-		envSize, err := strconv.Atoi(envSizeStr)
-		if err != nil {
-			return err
-		}
-		size = envSize
+	port, err := n.configInt("port", envPort, defaultPort)
+	if err != nil {
+		return err
 	}
 
-	router := chi.NewRouter()
-	if logger != nil {
-		router.Use(httputils.LoggerMiddleware(*logger))
+	size, err := n.configInt("size", envSize, defaultSize)
+	if err != nil {
+		return err
 	}
 
-	router.Get(defaultRoute, func(w http.ResponseWriter, r *http.Request) {
-		n.mu.Lock()
-		defer n.mu.Unlock()
-
-		resp := []*notification{}
-
-		logger := zerolog.Ctx(r.Context()).
-			With().
-			Str("Handler", "Notifier").
-			Logger()
-
-		n.buf.Do(func(item any) {
-			if item != nil {
-				resp = append(resp, item.(*notification))
-			}
-		})
-
-		enc := json.NewEncoder(w)
-		if err := enc.Encode(resp); err != nil {
-			logger.Err(err).Msg("Failed to serialize notifications")
-			httputils.ServerError(w, "Failed to serialize notifications")
-			return
-		}
+	n.notify = make(chan *notification, size)
+	n.flushes = make(chan chan struct{})
+	n.buf = newBuffer(size)
 
-		n.buf = ring.New(size)
+	if err := n.openLog(logger); err != nil {
+		return err
+	}
 
-		logger.Info().Msg("Notification buffer flushed by polling")
-	})
+	router := n.router(logger)
 
 	addr := fmt.Sprintf(":%d", port)
 
@@ -110,18 +126,35 @@ func (n *polledNotifier) Init(ctx context.Context) error {
 		Int("size", size).
 		Msgf("Serving polled notifier on '%s'", addr)
 
-	n.notify = make(chan *notification, size)
-	n.buf = ring.New(size)
+	n.done = ctx.Done()
 
 	go n.listen(ctx)
 
+	n.serve(ctx, listener, router)
+
+	return nil
+}
+
+// serve serves the handler on the listener until Flush, or until the
+// context is done.
+func (n *polledNotifier) serve(ctx context.Context, listener net.Listener, handler http.Handler) {
+	logger := zerolog.Ctx(ctx)
+
+	serving, stopServing := context.WithCancel(ctx)
+	n.done = serving.Done()
+	n.stopServing = stopServing
+	n.server = &http.Server{Handler: handler, ConnContext: withConn}
+
 	go func() {
-		if err := http.Serve(listener, router); err != nil {
+		if err := n.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Err(err).Msg("Failed to serve polled notifier handler")
 		}
 	}()
 
-	return nil
+	go func() {
+		<-ctx.Done()
+		n.server.Close()
+	}()
 }
 
 func (n *polledNotifier) Notify(ctx context.Context, event notifier.NotificationEvent, metadata map[string]string) error {
@@ -139,16 +172,239 @@ func (n *polledNotifier) listen(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			if n.log != nil {
+				if err := n.log.close(); err != nil {
+					logger.Err(err).Msg("Failed to close the notification log")
+				}
+			}
 			return
 		case notification := <-n.notify:
-			logger.Debug().
-				Str("notificationType", notification.Event.String()).
-				Msg("Notification received")
-
-			n.mu.Lock()
-			n.buf.Value = notification
-			n.buf = n.buf.Next()
-			n.mu.Unlock()
+			n.receive(logger, notification)
+		case done := <-n.flushes:
+			n.drain(logger)
+			close(done)
+		}
+	}
+}
+
+// Flush waits for the notifications already sent to be in the buffer, and
+// synced to the log if durable, or for the context to be done. The server
+// is then shut down, ending the long polls and the streams.
+func (n *polledNotifier) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case n.flushes <- done:
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return n.shutdown(ctx)
+}
+
+// shutdown stops the server, if serving, after ending the long polls and
+// the streams, which would otherwise hold it up to their wait.
+func (n *polledNotifier) shutdown(ctx context.Context) error {
+	if n.server == nil {
+		return nil
+	}
+
+	n.stopServing()
+	if err := n.server.Shutdown(ctx); err != nil {
+		n.server.Close()
+		return err
+	}
+
+	return nil
+}
+
+// drain receives the notifications in the channel, until it is empty, and
+// syncs the log.
+func (n *polledNotifier) drain(logger *zerolog.Logger) {
+	for {
+		select {
+		case notification := <-n.notify:
+			n.receive(logger, notification)
+		default:
+			if n.log != nil {
+				if err := n.log.sync(); err != nil {
+					logger.Err(err).Msg("Failed to sync the notification log")
+				}
+			}
+			return
 		}
 	}
 }
+
+func (n *polledNotifier) receive(logger *zerolog.Logger, notification *notification) {
+	logger.Debug().
+		Str("notificationType", notification.Event.String()).
+		Msg("Notification received")
+
+	// logged first, for the readers never to see a notification lost by a
+	// crash; only listen appends, so the next sequence number holds
+	if n.log != nil {
+		n.mu.Lock()
+		notification.Seq = n.buf.nextSeq()
+		n.mu.Unlock()
+
+		if err := n.log.append(notification); err != nil {
+			logger.Err(err).
+				Uint64("seq", notification.Seq).
+				Msg("Failed to persist notification")
+		}
+	}
+
+	n.mu.Lock()
+	overflow := n.buf.append(notification)
+	var snap *snapshot
+	if overflow && n.log != nil && n.log.compactable(n.buf.firstSeq()) {
+		// the evictions are saved before their segments are removed
+		snap = n.snapshot()
+	}
+	n.mu.Unlock()
+
+	persistErr := n.persist(snap)
+
+	if overflow {
+		logger.Warn().
+			Uint64("seq", notification.Seq).
+			Msg("Notification buffer full, evicted the oldest notification")
+	}
+
+	if persistErr != nil {
+		logger.Err(persistErr).Msg("Failed to compact the notification log")
+	}
+}
+
+// openLog opens the segment log, if configured, and restores its content in
+// the buffer.
+func (n *polledNotifier) openLog(logger *zerolog.Logger) error {
+	dir := n.configString("dir", envDir, "")
+	if dir == "" {
+		return nil
+	}
+
+	policy, err := parseFsyncPolicy(n.configString("fsync", envFsync, ""))
+	if err != nil {
+		return err
+	}
+
+	interval, err := n.configDuration("fsync_interval", envFsyncInterval, defaultFsyncInterval)
+	if err != nil {
+		return err
+	}
+
+	segmentSize, err := n.configInt("segment_size", envSegmentSize, defaultSegmentSize)
+	if err != nil {
+		return err
+	}
+
+	log, entries, state, err := openSegmentLog(dir, policy, interval, int64(segmentSize))
+	if err != nil {
+		return fmt.Errorf("failed to open the notification log: %w", err)
+	}
+
+	n.log = log
+	n.buf.restore(entries, state)
+
+	logger.Info().
+		Str("dir", dir).
+		Str("fsync", string(policy)).
+		Int("recovered", len(n.buf.entries)).
+		Uint64("lastSeq", n.buf.lastSeq).
+		Msg("Notification log recovered")
+
+	return nil
+}
+
+// snapshot returns the state of the buffer to persist, or nil if the buffer
+// is not durable. It must be called holding the lock.
+func (n *polledNotifier) snapshot() *snapshot {
+	if n.log == nil {
+		return nil
+	}
+
+	n.snapshots++
+
+	return &snapshot{
+		version:  n.snapshots,
+		state:    n.buf.state(),
+		firstSeq: n.buf.firstSeq(),
+	}
+}
+
+// persist saves the snapshot and compacts the log, unless a later snapshot
+// is saved already. It must be called without holding the lock, not to
+// stall the notifications and the reads on the disk.
+func (n *polledNotifier) persist(snap *snapshot) error {
+	if snap == nil {
+		return nil
+	}
+
+	n.persistMu.Lock()
+	defer n.persistMu.Unlock()
+
+	if snap.version <= n.persisted {
+		return nil
+	}
+
+	if err := n.log.saveState(snap.state); err != nil {
+		return err
+	}
+	n.persisted = snap.version
+
+	return n.log.compact(snap.firstSeq)
+}
+
+// configString looks for a value first in the configuration, then in the
+// environment, and falls back to the given default.
+func (n *polledNotifier) configString(key, env, fallback string) string {
+	if value := n.config[key]; value != "" {
+		return value
+	}
+
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// configDuration is like configString, for durations.
+func (n *polledNotifier) configDuration(key, env string, fallback time.Duration) (time.Duration, error) {
+	str := n.configString(key, env, "")
+	if str == "" {
+		return fallback, nil
+	}
+
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s for the %s notifier: %w", key, name, err)
+	}
+
+	return value, nil
+}
+
+// configInt is like configString, for integers.
+func (n *polledNotifier) configInt(key, env string, fallback int) (int, error) {
+	str := n.configString(key, env, "")
+	if str == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s for the %s notifier: %w", key, name, err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,152 @@
+package pollednotifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	streamBatch       = 100
+	heartbeatInterval = 15 * time.Second
+)
+
+// streamWriteTimeout bounds every write to a stream, for the clients not
+// reading anymore not to hold their connection forever.
+var streamWriteTimeout = 10 * time.Second
+
+type connKey struct{}
+
+// withConn is the ConnContext of the server, keeping the connection in the
+// context of its requests, for the streams to set the write deadlines.
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// extendWriteDeadline moves the write deadline of the connection of the
+// request, if known, streamWriteTimeout from now.
+func extendWriteDeadline(ctx context.Context) {
+	if conn, ok := ctx.Value(connKey{}).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	}
+}
+
+// handleStream pushes the notifications as Server-Sent Events. The stream
+// starts after the sequence number in the Last-Event-ID header, in the after
+// query parameter or, if both are missing, at the offset of the given
+// consumer group. Every event carries the sequence number as id, so that a
+// reconnecting client resumes where it left off.
+//
+// Clients are served from the shared buffer and never block the producer: a
+// client falling behind the capacity of the buffer receives an overflow
+// event before the first notification still available. Clients not reading
+// are dropped after streamWriteTimeout.
+func (n *polledNotifier) handleStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("Handler", "NotifierStream").
+		Logger()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error().Msg("Streaming not supported by the response writer")
+		httputils.ServerError(w, r, "Streaming not supported")
+		return
+	}
+
+	query := r.URL.Query()
+
+	var after uint64
+	afterStr := r.Header.Get("Last-Event-ID")
+	if afterStr == "" {
+		afterStr = query.Get("after")
+	}
+	if afterStr != "" {
+		var err error
+		after, err = strconv.ParseUint(afterStr, 10, 64)
+		if err != nil {
+			logger.Debug().Err(err).Msg("The starting point must be a non negative integer")
+			httputils.BadRequest(w, r, "Last-Event-ID and after must be non negative integers")
+			return
+		}
+	} else if group := query.Get("group"); group != "" {
+		n.mu.Lock()
+		after = n.buf.join(group)
+		n.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	extendWriteDeadline(ctx)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logger.Debug().Uint64("after", after).Msg("Streaming notifications")
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		n.mu.Lock()
+		result := n.buf.read(after, streamBatch)
+		changed := n.buf.changed()
+		n.mu.Unlock()
+
+		extendWriteDeadline(ctx)
+
+		if result.Overflow {
+			logger.Warn().Uint64("after", after).Msg("Stream fell behind the buffer")
+			if _, err := fmt.Fprintf(w, "event: overflow\ndata: {\"after\":%d}\n\n", after); err != nil {
+				logger.Debug().Err(err).Msg("Stream closed")
+				return
+			}
+		}
+
+		for _, notification := range result.Notifications {
+			data, err := json.Marshal(notification)
+			if err != nil {
+				logger.Err(err).Msg("Failed to serialize notification")
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", notification.Seq, notification.Event, data); err != nil {
+				logger.Debug().Err(err).Msg("Stream closed")
+				return
+			}
+
+			after = notification.Seq
+		}
+		flusher.Flush()
+
+		if len(result.Notifications) == streamBatch {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			extendWriteDeadline(ctx)
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				logger.Debug().Err(err).Msg("Stream closed")
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			logger.Debug().Msg("Stream closed by the client")
+			return
+		case <-n.done:
+			logger.Debug().Msg("Stream closed by shutdown")
+			return
+		}
+	}
+}
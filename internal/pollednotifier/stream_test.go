@@ -0,0 +1,272 @@
+package pollednotifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+func startNotifier(ctx context.Context, size int) *polledNotifier {
+	n := &polledNotifier{
+		buf:     newBuffer(size),
+		notify:  make(chan *notification, size),
+		flushes: make(chan chan struct{}),
+		done:    ctx.Done(),
+	}
+	go n.listen(ctx)
+
+	return n
+}
+
+func TestLongPolling(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := startNotifier(ctx, 10)
+	server := httptest.NewServer(n.router(nil))
+	defer server.Close()
+
+	// nothing arrives: the request returns empty after the wait
+	start := time.Now()
+	resp, err := http.Get(server.URL + defaultRoute + "?wait=100ms")
+	require.NoError(err)
+	var result readResult
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Empty(result.Notifications)
+	assert.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+
+	// a notification arrives while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		n.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{"id": "1"})
+	}()
+
+	start = time.Now()
+	resp, err = http.Get(server.URL + defaultRoute + "?wait=10s")
+	require.NoError(err)
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Equal([]uint64{1}, seqs(result.Notifications))
+	assert.Less(time.Since(start), 5*time.Second)
+
+	resp, err = http.Get(server.URL + defaultRoute + "?wait=forever")
+	require.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func readEvent(scanner *bufio.Scanner) (sseEvent, error) {
+	var ev sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if ev.event != "" {
+				return ev, nil
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	return ev, scanner.Err()
+}
+
+func TestStream(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := startNotifier(ctx, 10)
+	server := httptest.NewServer(n.router(nil))
+	defer server.Close()
+
+	n.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{"id": "1"})
+
+	reqCtx, reqCancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+defaultRoute+"/stream", nil)
+	require.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(err)
+	assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	ev, err := readEvent(scanner)
+	require.NoError(err)
+	assert.Equal("1", ev.id)
+	assert.Equal("CREATED", ev.event)
+
+	// pushed live
+	n.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "1"})
+	ev, err = readEvent(scanner)
+	require.NoError(err)
+	assert.Equal("2", ev.id)
+	assert.Equal("UPDATED", ev.event)
+
+	var notif notification
+	require.NoError(json.Unmarshal([]byte(ev.data), &notif))
+	assert.Equal(notifier.NotifyAccountUpdated, notif.Event)
+
+	reqCancel()
+	resp.Body.Close()
+
+	// resume with Last-Event-ID
+	n.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "1"})
+
+	reqCtx, reqCancel = context.WithCancel(ctx)
+	defer reqCancel()
+	req, err = http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+defaultRoute+"/stream", nil)
+	require.NoError(err)
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	ev, err = readEvent(bufio.NewScanner(resp.Body))
+	require.NoError(err)
+	assert.Equal("3", ev.id)
+	assert.Equal("REMOVED", ev.event)
+}
+
+func TestStreamStalledClient(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defer func(timeout time.Duration) { streamWriteTimeout = timeout }(streamWriteTimeout)
+	streamWriteTimeout = 100 * time.Millisecond
+
+	n := startNotifier(ctx, 1000)
+
+	closed := make(chan struct{})
+	server := httptest.NewUnstartedServer(n.router(nil))
+	server.Config.ConnContext = withConn
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			close(closed)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// more than the buffers of the sockets
+	metadata := map[string]string{"padding": strings.Repeat("x", 64<<10)}
+	for i := 0; i < 500; i++ {
+		n.Notify(ctx, notifier.NotifyAccountUpdated, metadata)
+	}
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(err)
+	defer conn.Close()
+	require.NoError(conn.(*net.TCPConn).SetReadBuffer(4096))
+
+	// the client never reads
+	_, err = fmt.Fprintf(conn, "GET %s/stream HTTP/1.1\r\nHost: localhost\r\n\r\n", defaultRoute)
+	require.NoError(err)
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled client was not dropped")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := startNotifier(ctx, 10)
+	for i := 0; i < 3; i++ {
+		require.NoError(n.Notify(ctx, notifier.NotifyAccountCreated, nil))
+	}
+
+	require.NoError(n.Flush(ctx))
+
+	n.mu.Lock()
+	assert.Equal([]uint64{1, 2, 3}, seqs(n.buf.entries))
+	n.mu.Unlock()
+
+	// nothing to flush once stopped
+	cancel()
+	assert.NoError(n.Flush(context.Background()))
+}
+
+func TestFlushShutdown(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := startNotifier(ctx, 10)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	n.serve(ctx, listener, n.router(nil))
+
+	url := "http://" + listener.Addr().String() + defaultRoute
+
+	// a long poll is waiting
+	polled := make(chan error)
+	go func() {
+		resp, err := http.Get(url + "?wait=1m")
+		if err == nil {
+			resp.Body.Close()
+		}
+		polled <- err
+	}()
+	assert.Eventually(func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	require.NoError(n.Flush(ctx))
+	assert.Less(time.Since(start), 5*time.Second)
+
+	select {
+	case err := <-polled:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the long poll was not ended")
+	}
+
+	// nothing is served anymore
+	_, err = http.Get(url)
+	assert.Error(err)
+}
@@ -0,0 +1,225 @@
+// Package ratelimit limits the load of the clients of the APIs, with a token
+// bucket for every client and class of operation, and the whole service,
+// with a cap on the requests in flight.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sweepInterval is how often the buckets of the idle clients are dropped.
+const sweepInterval = time.Minute
+
+// Class groups the operations with the same limits.
+type Class string
+
+const (
+	ClassRead  Class = "read"
+	ClassWrite Class = "write"
+	// ClassAuthFailure counts the failed authentications of an address.
+	ClassAuthFailure Class = "auth_failure"
+)
+
+// Rate is the sustained rate of requests of a client, with bursts of up to
+// Burst requests. A zero PerSecond means no limit.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+type Config struct {
+	Read  Rate
+	Write Rate
+	// AuthFailures is the rate of the failed authentications of every
+	// address, beyond which all of its requests are refused.
+	AuthFailures Rate
+	// MaxInFlight is the maximum number of requests being served at once,
+	// no limit if zero.
+	MaxInFlight int
+	// MaxStreams is the maximum number of streaming responses (see
+	// Streaming) being served at once, counted apart from MaxInFlight; no
+	// limit if zero.
+	MaxStreams int
+}
+
+type key struct {
+	client string
+	class  Class
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket and takes a token from it, if any, or else returns
+// how long until the next one.
+func (b *bucket) take(rate Rate, now time.Time) (bool, time.Duration) {
+	if wait := b.peek(rate, now); wait > 0 {
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// peek refills the bucket and returns how long until the next token, zero
+// if there is one.
+func (b *bucket) peek(rate Rate, now time.Time) time.Duration {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+elapsed*rate.PerSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	wait := (1 - b.tokens) / rate.PerSecond
+	return time.Duration(wait * float64(time.Second))
+}
+
+// full tells whether the bucket would be full by now, i.e. it is the same
+// as a new one.
+func (b *bucket) full(rate Rate, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond >= float64(rate.Burst)
+}
+
+// Limiter holds the state of the limits. It is safe for concurrent use, and
+// meant to be shared by the HTTP and gRPC APIs, so that every client has
+// the same budget on both.
+type Limiter struct {
+	rates    map[Class]Rate
+	inFlight chan struct{}
+	streams  chan struct{}
+
+	mu        sync.Mutex
+	buckets   map[key]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(config Config) *Limiter {
+	l := &Limiter{
+		rates:   make(map[Class]Rate),
+		buckets: make(map[key]*bucket),
+		now:     time.Now,
+	}
+
+	for class, rate := range map[Class]Rate{
+		ClassRead:        config.Read,
+		ClassWrite:       config.Write,
+		ClassAuthFailure: config.AuthFailures,
+	} {
+		if rate.PerSecond <= 0 {
+			continue
+		}
+		if rate.Burst < 1 {
+			rate.Burst = int(math.Max(1, math.Ceil(rate.PerSecond)))
+		}
+		l.rates[class] = rate
+	}
+
+	if config.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, config.MaxInFlight)
+	}
+
+	if config.MaxStreams > 0 {
+		l.streams = make(chan struct{}, config.MaxStreams)
+	}
+
+	return l
+}
+
+// Allow takes a token for the client and class of operation. If there is
+// none left, it returns how long the client should wait before retrying.
+func (l *Limiter) Allow(client string, class Class) (bool, time.Duration) {
+	rate, ok := l.rates[class]
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	k := key{client: client, class: class}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		l.buckets[k] = b
+		clientsGauge.Set(float64(len(l.buckets)))
+	}
+
+	return b.take(rate, now)
+}
+
+// Exhausted returns how long the client should wait for a token of the
+// class, without taking it, or zero if there is one.
+func (l *Limiter) Exhausted(client string, class Class) time.Duration {
+	rate, ok := l.rates[class]
+	if !ok {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key{client: client, class: class}]
+	if !ok {
+		return 0
+	}
+
+	return b.peek(rate, l.now())
+}
+
+// Acquire reserves a slot for a request in flight, to be released when
+// done. It fails if all of them are taken.
+func (l *Limiter) Acquire() (release func(), ok bool) {
+	return acquire(l.inFlight, inFlightGauge)
+}
+
+// AcquireStream is the same as Acquire, for a streaming response.
+func (l *Limiter) AcquireStream() (release func(), ok bool) {
+	return acquire(l.streams, streamsGauge)
+}
+
+func acquire(slots chan struct{}, gauge prometheus.Gauge) (func(), bool) {
+	if slots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		gauge.Inc()
+		return func() {
+			<-slots
+			gauge.Dec()
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// sweep drops the buckets that refilled completely, so that the state does
+// not grow with every client ever seen. It must be called with the lock
+// held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for k, b := range l.buckets {
+		if b.full(l.rates[k.class], now) {
+			delete(l.buckets, k)
+		}
+	}
+
+	clientsGauge.Set(float64(len(l.buckets)))
+}
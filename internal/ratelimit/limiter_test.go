@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(config Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 11, 20, 12, 0, 0, 0, time.UTC)}
+	l := New(config)
+	l.now = clock.Now
+
+	return l, clock
+}
+
+func TestAllow(t *testing.T) {
+	assert := assert.New(t)
+
+	l, clock := newTestLimiter(Config{
+		Read:  Rate{PerSecond: 2, Burst: 3},
+		Write: Rate{PerSecond: 0.5},
+	})
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("client", ClassRead)
+		assert.True(ok, "request %d", i)
+	}
+
+	ok, wait := l.Allow("client", ClassRead)
+	assert.False(ok)
+	assert.Equal(500*time.Millisecond, wait)
+
+	// the other clients and classes have their own buckets
+	ok, _ = l.Allow("other", ClassRead)
+	assert.True(ok)
+	ok, _ = l.Allow("client", ClassWrite)
+	assert.True(ok)
+
+	ok, wait = l.Allow("client", ClassWrite)
+	assert.False(ok)
+	assert.Equal(2*time.Second, wait)
+
+	clock.Advance(500 * time.Millisecond)
+	ok, _ = l.Allow("client", ClassRead)
+	assert.True(ok)
+	ok, _ = l.Allow("client", ClassRead)
+	assert.False(ok)
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l, _ := newTestLimiter(Config{})
+
+	for i := 0; i < 1000; i++ {
+		ok, _ := l.Allow("client", ClassWrite)
+		require.True(t, ok)
+	}
+	assert.Empty(t, l.buckets)
+}
+
+func TestSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	l, clock := newTestLimiter(Config{Read: Rate{PerSecond: 1, Burst: 2}})
+
+	l.Allow("idle", ClassRead)
+	l.Allow("busy", ClassRead)
+	l.Allow("busy", ClassRead)
+
+	clock.Advance(sweepInterval)
+	l.Allow("busy", ClassRead)
+
+	assert.Len(l.buckets, 1)
+	assert.Contains(l.buckets, key{client: "busy", class: ClassRead})
+}
+
+func TestAcquire(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{MaxInFlight: 2})
+
+	first, ok := l.Acquire()
+	assert.True(ok)
+	_, ok = l.Acquire()
+	assert.True(ok)
+
+	_, ok = l.Acquire()
+	assert.False(ok)
+
+	first()
+	_, ok = l.Acquire()
+	assert.True(ok)
+}
+
+func TestAcquireStream(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{MaxInFlight: 1, MaxStreams: 1})
+
+	// the streams do not take the slots of the requests in flight
+	stream, ok := l.AcquireStream()
+	assert.True(ok)
+	_, ok = l.Acquire()
+	assert.True(ok)
+
+	_, ok = l.AcquireStream()
+	assert.False(ok)
+
+	stream()
+	_, ok = l.AcquireStream()
+	assert.True(ok)
+}
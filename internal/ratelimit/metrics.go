@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	subsystem = "userz" // the same of the other metrics
+
+	rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "ratelimit_rejected_total",
+	}, []string{"api", "class", "reason"})
+	inFlightGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "ratelimit_in_flight",
+	})
+	streamsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "ratelimit_streams",
+	})
+	clientsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "ratelimit_tracked_clients",
+	})
+)
+
+const (
+	reasonRate     = "rate"
+	reasonInFlight = "in_flight"
+	reasonStreams  = "streams"
+)
+
+func init() {
+	prometheus.MustRegister(rejected)
+	prometheus.MustRegister(inFlightGauge)
+	prometheus.MustRegister(streamsGauge)
+	prometheus.MustRegister(clientsGauge)
+}
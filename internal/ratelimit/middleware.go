@@ -0,0 +1,349 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz/internal/auth"
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/internal/httputils"
+)
+
+const (
+	// healthService is never limited, for the probes.
+	healthService = "/grpc.health.v1.Health/"
+	// retryAfterOverload is the delay suggested when shedding load.
+	retryAfterOverload = time.Second
+)
+
+var (
+	// writeMethods are the gRPC methods in the write class, by name.
+	writeMethods = map[string]bool{"Add": true, "Update": true, "Remove": true}
+	// longLivedMethods are the gRPC streams lasting as long as the client
+	// wants, which are not counted as in flight.
+	longLivedMethods = map[string]bool{"Watch": true}
+)
+
+// client identifies the client: by the authenticated principal, if any, by
+// the mTLS identity or else by the address.
+func client(ctx context.Context, addr string) string {
+	if principal := auth.PrincipalFrom(ctx); principal != nil {
+		return "principal:" + principal.ID
+	}
+
+	if id := grpcutils.Identity(ctx); id != "" {
+		return "mtls:" + id
+	}
+
+	return addrClient(addr)
+}
+
+// addrClient identifies the client by its address only.
+func addrClient(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return "ip:" + addr
+}
+
+// retryAfter returns the seconds to wait, rounded up.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+func httpClass(r *http.Request) Class {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ClassRead
+	default:
+		return ClassWrite
+	}
+}
+
+type slotKey struct{}
+
+// slot is the one in flight of a request, released at most once: by
+// Streaming, as the response starts streaming, or else as the request is
+// served.
+type slot struct {
+	limiter *Limiter
+	release func()
+	once    sync.Once
+}
+
+func (s *slot) done() {
+	s.once.Do(s.release)
+}
+
+// Middleware limits the HTTP requests, refusing with 429 and a Retry-After
+// header those exceeding the rate of their client or the requests in
+// flight. Reads (GET) and writes have separate limits.
+func Middleware(l *Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			class := httpClass(r)
+			id := client(ctx, r.RemoteAddr)
+
+			if ok, wait := l.Allow(id, class); !ok {
+				zerolog.Ctx(ctx).Info().Str("client", id).Str("class", string(class)).Msg("Rate limited")
+				rejected.WithLabelValues("http", string(class), reasonRate).Inc()
+
+				w.Header().Set("Retry-After", retryAfter(wait))
+				httputils.TooManyRequests(w, r, "rate limit exceeded")
+				return
+			}
+
+			release, ok := l.Acquire()
+			if !ok {
+				zerolog.Ctx(ctx).Warn().Str("client", id).Msg("Too many requests in flight")
+				rejected.WithLabelValues("http", string(class), reasonInFlight).Inc()
+
+				w.Header().Set("Retry-After", retryAfter(retryAfterOverload))
+				httputils.TooManyRequests(w, r, "server overloaded")
+				return
+			}
+			s := &slot{limiter: l, release: release}
+			defer s.done()
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, slotKey{}, s)))
+		})
+	}
+}
+
+// Streaming moves the requests to the handler, e.g. an export, from the cap
+// of the requests in flight to the one of the streams, for the long-lived
+// responses not to exhaust the former, refusing with 429 and a Retry-After
+// header those exceeding the latter. It goes after Middleware, without which
+// the requests are not limited.
+func Streaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		s, ok := ctx.Value(slotKey{}).(*slot)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		release, ok := s.limiter.AcquireStream()
+		if !ok {
+			class := httpClass(r)
+			zerolog.Ctx(ctx).Warn().Str("client", client(ctx, r.RemoteAddr)).Msg("Too many streams")
+			rejected.WithLabelValues("http", string(class), reasonStreams).Inc()
+
+			w.Header().Set("Retry-After", retryAfter(retryAfterOverload))
+			httputils.TooManyRequests(w, r, "too many streams")
+			return
+		}
+		defer release()
+
+		s.done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthFailuresMiddleware counts the requests failing the authentication
+// (401) of every address, and refuses with 429 and a Retry-After header all
+// the requests of the addresses exceeding their rate of failures. It goes in
+// front of the authentication, which Middleware follows instead.
+func AuthFailuresMiddleware(l *Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			id := addrClient(r.RemoteAddr)
+
+			if wait := l.Exhausted(id, ClassAuthFailure); wait > 0 {
+				zerolog.Ctx(ctx).Info().Str("client", id).Msg("Too many failed authentications")
+				rejected.WithLabelValues("http", string(ClassAuthFailure), reasonRate).Inc()
+
+				w.Header().Set("Retry-After", retryAfter(wait))
+				httputils.TooManyRequests(w, r, "too many failed authentications")
+				return
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status == http.StatusUnauthorized {
+				l.Allow(id, ClassAuthFailure)
+			}
+		})
+	}
+}
+
+// statusRecorder keeps the status of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func grpcClass(method string) Class {
+	if writeMethods[path.Base(method)] {
+		return ClassWrite
+	}
+
+	return ClassRead
+}
+
+// limitGRPC applies the limits as in HTTP, returning the release of the
+// slot in flight (if taken) or a ResourceExhausted status.
+func (l *Limiter) limitGRPC(ctx context.Context, method string, inFlight bool) (func(), error) {
+	if strings.HasPrefix(method, healthService) {
+		return func() {}, nil
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+
+	class := grpcClass(method)
+	id := client(ctx, addr)
+
+	if ok, wait := l.Allow(id, class); !ok {
+		zerolog.Ctx(ctx).Info().Str("client", id).Str("class", string(class)).Msg("Rate limited")
+		rejected.WithLabelValues("grpc", string(class), reasonRate).Inc()
+
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		return nil, status.Error(codes.ResourceExhausted, "userz: rate limit exceeded")
+	}
+
+	if !inFlight {
+		return func() {}, nil
+	}
+
+	release, ok := l.Acquire()
+	if !ok {
+		zerolog.Ctx(ctx).Warn().Str("client", id).Msg("Too many requests in flight")
+		rejected.WithLabelValues("grpc", string(class), reasonInFlight).Inc()
+
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(retryAfterOverload)))
+		return nil, status.Error(codes.ResourceExhausted, "userz: server overloaded")
+	}
+
+	return release, nil
+}
+
+// UnaryInterceptor limits the gRPC requests as Middleware does, refusing
+// with ResourceExhausted and a retry-after header. Add, Update and Remove
+// are writes, everything else reads. The health service is not limited.
+func UnaryInterceptor(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := l.limitGRPC(ctx, info.FullMethod, true)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor is the same as UnaryInterceptor, for streams. Watch
+// streams are limited only at their start, and not counted as in flight.
+func StreamInterceptor(l *Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		inFlight := !longLivedMethods[path.Base(info.FullMethod)]
+
+		release, err := l.limitGRPC(ss.Context(), info.FullMethod, inFlight)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return handler(srv, ss)
+	}
+}
+
+// checkAuthFailures refuses with ResourceExhausted the requests of the
+// addresses exceeding their rate of failed authentications.
+func (l *Limiter) checkAuthFailures(ctx context.Context, method string) (string, error) {
+	if strings.HasPrefix(method, healthService) {
+		return "", nil
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	id := addrClient(addr)
+
+	if wait := l.Exhausted(id, ClassAuthFailure); wait > 0 {
+		zerolog.Ctx(ctx).Info().Str("client", id).Msg("Too many failed authentications")
+		rejected.WithLabelValues("grpc", string(ClassAuthFailure), reasonRate).Inc()
+
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		return "", status.Error(codes.ResourceExhausted, "userz: too many failed authentications")
+	}
+
+	return id, nil
+}
+
+// countAuthFailure counts the error against the address, if Unauthenticated.
+func (l *Limiter) countAuthFailure(id string, err error) {
+	if id != "" && status.Code(err) == codes.Unauthenticated {
+		l.Allow(id, ClassAuthFailure)
+	}
+}
+
+// UnaryAuthFailures is the same as AuthFailuresMiddleware, for the gRPC
+// requests failing with Unauthenticated. It goes in front of the
+// authentication.
+func UnaryAuthFailures(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id, err := l.checkAuthFailures(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+		l.countAuthFailure(id, err)
+
+		return resp, err
+	}
+}
+
+// StreamAuthFailures is the same as UnaryAuthFailures, for streams.
+func StreamAuthFailures(l *Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id, err := l.checkAuthFailures(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		err = handler(srv, ss)
+		l.countAuthFailure(id, err)
+
+		return err
+	}
+}
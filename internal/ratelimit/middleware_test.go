@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz/internal/auth"
+)
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{
+		Read:  Rate{PerSecond: 1},
+		Write: Rate{PerSecond: 1},
+	})
+	handler := Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, addr string, principal *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api", nil)
+		req.RemoteAddr = addr
+		if principal != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(http.StatusOK, serve(http.MethodGet, "10.0.0.1:1234", nil).Code)
+	// the same address, from another port
+	w := serve(http.MethodGet, "10.0.0.1:4321", nil)
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+
+	// writes are limited apart
+	assert.Equal(http.StatusOK, serve(http.MethodPut, "10.0.0.1:1234", nil).Code)
+
+	// authenticated clients are limited by principal
+	backoffice := &auth.Principal{ID: "backoffice"}
+	assert.Equal(http.StatusOK, serve(http.MethodGet, "10.0.0.1:1234", backoffice).Code)
+	assert.Equal(http.StatusTooManyRequests, serve(http.MethodGet, "10.0.0.2:1234", backoffice).Code)
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{MaxInFlight: 1})
+
+	var inner *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner == nil {
+			inner = httptest.NewRecorder()
+			handler.ServeHTTP(inner, httptest.NewRequest(http.MethodGet, "/api", nil))
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(http.StatusTooManyRequests, inner.Code)
+	assert.NotEmpty(inner.Header().Get("Retry-After"))
+
+	// the slot has been released
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestStreaming(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{MaxInFlight: 1, MaxStreams: 1})
+
+	var inner []int
+	var handler, streaming http.Handler
+	// a stream serves a request in flight, and another stream
+	streaming = Middleware(l)(Streaming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner != nil {
+			return
+		}
+
+		for _, h := range []http.Handler{handler, streaming} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+			inner = append(inner, w.Code)
+		}
+	})))
+	handler = Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	streaming.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal([]int{http.StatusOK, http.StatusTooManyRequests}, inner)
+
+	// both the slots have been released
+	_, ok := l.Acquire()
+	assert.True(ok)
+	_, ok = l.AcquireStream()
+	assert.True(ok)
+}
+
+func TestAuthFailuresMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	l, clock := newTestLimiter(Config{AuthFailures: Rate{PerSecond: 1, Burst: 2}})
+	handler := AuthFailuresMiddleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	serve := func(addr string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = addr
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// the successes are not counted
+	for i := 0; i < 5; i++ {
+		assert.Equal(http.StatusOK, serve("10.0.0.1:1234", true).Code)
+	}
+
+	assert.Equal(http.StatusUnauthorized, serve("10.0.0.1:1234", false).Code)
+	assert.Equal(http.StatusUnauthorized, serve("10.0.0.1:1234", false).Code)
+
+	// beyond the failures allowed, even the valid credentials are refused
+	w := serve("10.0.0.1:4321", true)
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+
+	// the other addresses are not affected
+	assert.Equal(http.StatusUnauthorized, serve("10.0.0.2:1234", false).Code)
+
+	clock.Advance(time.Second)
+	assert.Equal(http.StatusOK, serve("10.0.0.1:1234", true).Code)
+}
+
+func TestUnaryAuthFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{AuthFailures: Rate{PerSecond: 1}})
+	interceptor := UnaryAuthFailures(l)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unauthenticated, "userz: authentication required")
+	}
+	call := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.Equal(codes.Unauthenticated, status.Code(call("/userz.Userz/Page")))
+	assert.Equal(codes.ResourceExhausted, status.Code(call("/userz.Userz/Page")))
+
+	// the probes are never limited
+	assert.Equal(codes.Unauthenticated, status.Code(call("/grpc.health.v1.Health/Check")))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{
+		Read:  Rate{PerSecond: 1},
+		Write: Rate{PerSecond: 1},
+	})
+	interceptor := UnaryInterceptor(l)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.NoError(call("/userz.Userz/Add"))
+	assert.Equal(codes.ResourceExhausted, status.Code(call("/userz.v2.Userz/Update")))
+	assert.NoError(call("/userz.Userz/Page"))
+	assert.Equal(codes.ResourceExhausted, status.Code(call("/userz.Userz/Page")))
+
+	// the probes are never limited
+	assert.NoError(call("/grpc.health.v1.Health/Check"))
+	assert.NoError(call("/grpc.health.v1.Health/Check"))
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+}
+
+func (s *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestStreamInterceptorWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(Config{MaxInFlight: 1})
+	interceptor := StreamInterceptor(l)
+
+	var inner error
+	err := interceptor(nil, &fakeStream{}, &grpc.StreamServerInfo{FullMethod: "/userz.Userz/Watch"}, func(srv interface{}, ss grpc.ServerStream) error {
+		// a watch does not take the slot
+		inner = interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/userz.Userz/List"}, func(srv interface{}, ss grpc.ServerStream) error {
+			return nil
+		})
+		return nil
+	})
+	assert.NoError(err)
+	assert.NoError(inner)
+}
@@ -0,0 +1,185 @@
+package tlsutils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz/internal"
+)
+
+// Config describes the TLS of an endpoint.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, is a PEM bundle of the CAs the certificates of
+	// the clients are required to be signed by (mTLS).
+	ClientCAFile string
+	// Default serves the embedded self-signed certificate, in place of
+	// CertFile and KeyFile.
+	Default bool
+}
+
+// Reloader serves the TLS configured with files, loading them anew when
+// they change, e.g. when the certificates are rotated.
+type Reloader struct {
+	config  Config
+	current atomic.Pointer[tls.Config]
+
+	mu sync.Mutex
+	// stamps are the last modification times and sizes of the files loaded
+	// or tried
+	stamps []string
+}
+
+// NewReloader loads the files of the config, which need both a certificate
+// and its key, or Default.
+func NewReloader(config Config) (*Reloader, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("both the certificate and the key are needed")
+	}
+	if config.CertFile == "" && !config.Default {
+		return nil, errors.New("no certificate")
+	}
+
+	r := &Reloader{config: config}
+	r.stamps = r.stat()
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// stat returns the modification time and the size of every file, empty for
+// those missing.
+func (r *Reloader) stat() []string {
+	files := r.files()
+	stamps := make([]string, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[i] = fmt.Sprintf("%s %d", info.ModTime(), info.Size())
+		}
+	}
+
+	return stamps
+}
+
+func (r *Reloader) load() error {
+	var cert tls.Certificate
+	var err error
+	if r.config.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	} else {
+		cert, err = internal.GetDefaultCertificate()
+	}
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate in %s", r.config.ClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(config)
+
+	return nil
+}
+
+// Reload loads the files anew if any of them changed since the last time,
+// keeping the current ones if they cannot be loaded. It tells whether they
+// were reloaded.
+func (r *Reloader) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps := r.stat()
+
+	changed := false
+	for i := range stamps {
+		changed = changed || stamps[i] != r.stamps[i]
+	}
+	if !changed {
+		return false, nil
+	}
+
+	// not to try again until they change once more, e.g. when the
+	// certificate is written but not yet its key
+	r.stamps = stamps
+
+	if err := r.load(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Watch reloads the files every interval, until the context is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	logger := zerolog.Ctx(ctx).With().Strs("files", r.files()).Logger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				logger.Err(err).Msg("Failed to reload the TLS files, keeping the current ones")
+			} else if reloaded {
+				logger.Info().Msg("TLS files reloaded")
+			}
+		}
+	}
+}
+
+// TLSConfig returns the config serving the files currently loaded,
+// negotiating the given application protocols (ALPN).
+func (r *Reloader) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := r.current.Load().Clone()
+			config.NextProtos = nextProtos
+
+			return config, nil
+		},
+	}
+}
@@ -0,0 +1,181 @@
+package tlsutils_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/internal/tlsutils"
+)
+
+// certificate issues a certificate from the given template, signed by the
+// parent (self-signed if nil).
+func certificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	issuer, signer := template, any(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+// write writes the certificate and its key as PEM, changing their
+// modification time to mtime.
+func write(t *testing.T, cert tls.Certificate, certFile, keyFile string, mtime time.Time) {
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, mtime, mtime))
+	require.NoError(t, os.Chtimes(keyFile, mtime, mtime))
+}
+
+// handshake connects a client with the given config to the server, and
+// returns the certificate of the server.
+func handshake(server, client *tls.Config) (*x509.Certificate, error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	go func() {
+		conn := tls.Server(serverConn, server)
+		if conn.Handshake() == nil {
+			conn.Write([]byte{0})
+		}
+		conn.Close()
+	}()
+
+	conn := tls.Client(clientConn, client)
+	// the server verifies the client after the handshake of the client, and
+	// writes only if successful
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestReloader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	ca := certificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	require.NoError(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600))
+
+	server := func(name string) tls.Certificate {
+		return certificate(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			DNSNames:    []string{"localhost"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, &ca)
+	}
+	clientCert := certificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	now := time.Now()
+	write(t, server("first"), certFile, keyFile, now)
+
+	reloader, err := tlsutils.NewReloader(tlsutils.Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	require.NoError(err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	client := &tls.Config{
+		ServerName:   "localhost",
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}
+
+	serverConfig := reloader.TLSConfig("h2")
+	cert, err := handshake(serverConfig, client)
+	require.NoError(err)
+	assert.Equal("first", cert.Subject.CommonName)
+
+	// the clients without a certificate are refused
+	_, err = handshake(serverConfig, &tls.Config{ServerName: "localhost", RootCAs: roots})
+	assert.Error(err)
+
+	// nothing changed
+	reloaded, err := reloader.Reload()
+	require.NoError(err)
+	assert.False(reloaded)
+
+	// rotated
+	write(t, server("second"), certFile, keyFile, now.Add(time.Minute))
+	reloaded, err = reloader.Reload()
+	require.NoError(err)
+	assert.True(reloaded)
+
+	cert, err = handshake(serverConfig, client)
+	require.NoError(err)
+	assert.Equal("second", cert.Subject.CommonName)
+
+	// broken, the current ones are kept
+	require.NoError(os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = reloader.Reload()
+	assert.Error(err)
+
+	cert, err = handshake(serverConfig, client)
+	require.NoError(err)
+	assert.Equal("second", cert.Subject.CommonName)
+}
+
+func TestNewReloader(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := tlsutils.NewReloader(tlsutils.Config{})
+	assert.Error(err)
+
+	_, err = tlsutils.NewReloader(tlsutils.Config{CertFile: "tls.crt"})
+	assert.Error(err)
+
+	_, err = tlsutils.NewReloader(tlsutils.Config{CertFile: "missing.crt", KeyFile: "missing.key"})
+	assert.Error(err)
+
+	// the embedded certificate only if asked
+	_, err = tlsutils.NewReloader(tlsutils.Config{Default: true})
+	assert.NoError(err)
+}
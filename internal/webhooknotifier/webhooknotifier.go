@@ -0,0 +1,187 @@
+// Package webhooknotifier implements a notifier that POSTs every notification
+// as JSON to a configured URL. It is registered as "webhook".
+package webhooknotifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+const (
+	name           = "webhook"
+	defaultTimeout = 5 * time.Second
+	defaultQueue   = 1000
+)
+
+func init() {
+	notifier.Register(name, NewNotifier)
+}
+
+type notification struct {
+	Event    notifier.NotificationEvent `json:"event"`
+	Metadata map[string]string          `json:"metadata,omitempty"`
+}
+
+type webhookNotifier struct {
+	url     string
+	timeout time.Duration
+	queue   chan *notification
+	flushes chan chan struct{}
+	client  *http.Client
+}
+
+// NewNotifier returns a webhook notifier. The accepted configuration keys
+// are "url" (mandatory), "timeout" (a duration, defaults to 5s) and "queue"
+// (the number of notifications to buffer, defaults to 1000). Notifications
+// are delivered asynchronously and dropped if the queue is full.
+func NewNotifier(config map[string]string) (notifier.Notifier, error) {
+	url := config["url"]
+	if url == "" {
+		return nil, fmt.Errorf("the %s notifier needs a url", name)
+	}
+
+	timeout := defaultTimeout
+	if timeoutStr := config["timeout"]; timeoutStr != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for the %s notifier: %w", name, err)
+		}
+	}
+
+	queue := defaultQueue
+	if queueStr := config["queue"]; queueStr != "" {
+		var err error
+		queue, err = strconv.Atoi(queueStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue for the %s notifier: %w", name, err)
+		}
+	}
+
+	return &webhookNotifier{
+		url:     url,
+		timeout: timeout,
+		queue:   make(chan *notification, queue),
+		flushes: make(chan chan struct{}),
+		client:  &http.Client{},
+	}, nil
+}
+
+func (n *webhookNotifier) Init(ctx context.Context) error {
+	zerolog.Ctx(ctx).Info().Msgf("Sending notifications to '%s'", n.url)
+
+	go n.deliver(ctx)
+
+	return nil
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, event notifier.NotificationEvent, metadata map[string]string) error {
+	select {
+	case n.queue <- &notification{Event: event, Metadata: metadata}:
+	default:
+		zerolog.Ctx(ctx).Warn().
+			Str("notificationType", event.String()).
+			Msg("Webhook queue full, dropping notification")
+	}
+
+	return nil
+}
+
+// Check fails while the queue is full, as notifications are being dropped.
+func (n *webhookNotifier) Check(ctx context.Context) error {
+	if len(n.queue) == cap(n.queue) {
+		return fmt.Errorf("the %s queue is full, notifications are being dropped", name)
+	}
+
+	return nil
+}
+
+// Flush waits for the notifications already queued to be delivered, or for
+// the context to be done.
+func (n *webhookNotifier) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case n.flushes <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *webhookNotifier) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-n.queue:
+			n.send(ctx, notification)
+		case done := <-n.flushes:
+			n.drain(ctx)
+			close(done)
+		}
+	}
+}
+
+// drain delivers the notifications in the queue, until it is empty.
+func (n *webhookNotifier) drain(ctx context.Context) {
+	for {
+		select {
+		case notification := <-n.queue:
+			n.send(ctx, notification)
+		default:
+			return
+		}
+	}
+}
+
+func (n *webhookNotifier) send(ctx context.Context, notification *notification) {
+	if err := n.post(ctx, notification); err != nil {
+		zerolog.Ctx(ctx).Err(err).
+			Str("notificationType", notification.Event.String()).
+			Msg("Failed to deliver notification")
+	}
+}
+
+func (n *webhookNotifier) post(ctx context.Context, notification *notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	expiring, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(expiring, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status from webhook: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -1,12 +1,87 @@
 package userz
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The formats of the password hashes. Bcrypt is the one of NewPassword,
+// the others are recognised to take the users of legacy systems over.
+const (
+	// HashBcrypt is the modular crypt format of bcrypt, e.g. $2a$10$...
+	HashBcrypt = "bcrypt"
+	// HashPBKDF2SHA256 is pbkdf2_sha256$<iterations>$<salt>$<base64 hash>.
+	HashPBKDF2SHA256 = "pbkdf2_sha256"
+	// HashSaltedSHA1 is sha1$<salt>$<hex hash>, the hash being the SHA-1 of
+	// the salt followed by the password.
+	HashSaltedSHA1 = "sha1"
+)
+
+// The limits of the PBKDF2-SHA256 hashes, whose cost is paid at every
+// verification: the iterations and the length of the hash, which takes as
+// many more iterations as the blocks of SHA-256 it spans.
+const (
+	maxPBKDF2Iterations = 2_000_000
+	maxPBKDF2HashSize   = 2 * sha256.Size
 )
 
+// ErrUnknownPasswordHash is returned for the password hashes in none of the
+// recognised formats.
+var ErrUnknownPasswordHash = errors.New("the password hash is not in a recognised format")
+
 // Password represents a secret to be stored safely at rest.
 type Password []byte
 
+var (
+	decoyOnce sync.Once
+	decoy     Password
+)
+
+// CompareDecoy compares plaintext with a decoy password, taking as long as
+// checking a real one, so that the unknown users cannot be told apart by
+// timing.
+func CompareDecoy(plaintext string) {
+	decoyOnce.Do(func() { decoy, _ = NewPassword("decoy") })
+	decoy.Matches(plaintext)
+}
+
+// ParsePasswordHash returns the password already hashed in one of the
+// recognised formats.
+func ParsePasswordHash(hash string) (Password, error) {
+	password := Password(hash)
+
+	var err error
+	switch password.Format() {
+	case HashBcrypt:
+		_, err = bcrypt.Cost(password)
+	case HashPBKDF2SHA256:
+		_, _, _, err = password.pbkdf2()
+	case HashSaltedSHA1:
+		_, _, err = password.saltedSHA1()
+	default:
+		err = errors.New("unknown format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPasswordHash, err)
+	}
+
+	return password, nil
+}
+
 func NewPassword(plaintext string) (Password, error) {
 	return newPassword([]byte(plaintext))
 }
@@ -24,4 +99,183 @@ func (p Password) String() string {
 	return string(p)
 }
 
+// Format returns the format of the hash, or the empty string if none of the
+// recognised ones.
+func (p Password) Format() string {
+	switch {
+	case strings.HasPrefix(string(p), "$2a$"), strings.HasPrefix(string(p), "$2b$"), strings.HasPrefix(string(p), "$2y$"):
+		return HashBcrypt
+	case strings.HasPrefix(string(p), HashPBKDF2SHA256+"$"):
+		return HashPBKDF2SHA256
+	case strings.HasPrefix(string(p), HashSaltedSHA1+"$"):
+		return HashSaltedSHA1
+	default:
+		return ""
+	}
+}
+
+// Legacy tells whether the hash is in a format other than the one of
+// NewPassword, to be hashed anew.
+func (p Password) Legacy() bool {
+	return p.Format() != HashBcrypt
+}
+
+// Matches tells whether plaintext is the password hashed, in any of the
+// recognised formats.
+func (p Password) Matches(plaintext string) (bool, error) {
+	switch p.Format() {
+	case HashBcrypt:
+		err := bcrypt.CompareHashAndPassword(p, []byte(plaintext))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case HashPBKDF2SHA256:
+		iterations, salt, hash, err := p.pbkdf2()
+		if err != nil {
+			return false, err
+		}
+		key := pbkdf2.Key([]byte(plaintext), []byte(salt), iterations, len(hash), sha256.New)
+		return subtle.ConstantTimeCompare(key, hash) == 1, nil
+	case HashSaltedSHA1:
+		salt, hash, err := p.saltedSHA1()
+		if err != nil {
+			return false, err
+		}
+		sum := sha1.Sum([]byte(salt + plaintext))
+		return subtle.ConstantTimeCompare(sum[:], hash) == 1, nil
+	default:
+		return false, ErrUnknownPasswordHash
+	}
+}
+
+func (p Password) pbkdf2() (iterations int, salt string, hash []byte, err error) {
+	parts := strings.Split(string(p), "$")
+	if len(parts) != 4 {
+		return 0, "", nil, errors.New("expected pbkdf2_sha256$<iterations>$<salt>$<hash>")
+	}
+
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, "", nil, errors.New("the iterations must be a positive integer")
+	}
+	if iterations > maxPBKDF2Iterations {
+		return 0, "", nil, fmt.Errorf("the iterations must be at most %d", maxPBKDF2Iterations)
+	}
+
+	if parts[2] == "" {
+		return 0, "", nil, errors.New("missing salt")
+	}
+
+	hash, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(hash) == 0 {
+		return 0, "", nil, errors.New("the hash must be base64 encoded")
+	}
+	if len(hash) > maxPBKDF2HashSize {
+		return 0, "", nil, fmt.Errorf("the hash must be at most %d bytes", maxPBKDF2HashSize)
+	}
+
+	return iterations, parts[2], hash, nil
+}
+
+func (p Password) saltedSHA1() (salt string, hash []byte, err error) {
+	parts := strings.Split(string(p), "$")
+	if len(parts) != 3 {
+		return "", nil, errors.New("expected sha1$<salt>$<hash>")
+	}
+
+	hash, err = hex.DecodeString(parts[2])
+	if err != nil || len(hash) != sha1.Size {
+		return "", nil, errors.New("the hash must be hex encoded")
+	}
+
+	return parts[1], hash, nil
+}
+
 type Passworder func(string) (Password, error)
+
+// HashPasswords hashes all the plaintexts with the hasher, spreading the
+// work across the available cores. It stops at the first failure.
+func HashPasswords(ctx context.Context, hasher Passworder, plaintexts []string) ([]Password, error) {
+	hashed := make([]Password, len(plaintexts))
+
+	workers := runtime.NumCPU()
+	if workers > len(plaintexts) {
+		workers = len(plaintexts)
+	}
+
+	var next int64 = -1
+	var once sync.Once
+	var failure error
+	fail := func(err error) {
+		once.Do(func() { failure = err })
+		// the other workers find nothing left to hash
+		atomic.StoreInt64(&next, int64(len(plaintexts)))
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(plaintexts) {
+					return
+				}
+
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+
+				password, err := hasher(plaintexts[i])
+				if err != nil {
+					fail(err)
+					return
+				}
+				hashed[i] = password
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failure != nil {
+		return nil, failure
+	}
+
+	return hashed, nil
+}
+
+// UserPasswords returns the passwords to store for the users: the hashes
+// given, if any, or the plaintexts hashed in parallel (see HashPasswords).
+func UserPasswords(ctx context.Context, hasher Passworder, users []*UserData) ([]Password, error) {
+	passwords := make([]Password, len(users))
+
+	var plaintexts []string
+	var indexes []int
+	for i, user := range users {
+		if user.PasswordHash == "" {
+			plaintexts = append(plaintexts, user.Password)
+			indexes = append(indexes, i)
+			continue
+		}
+
+		password, err := ParsePasswordHash(user.PasswordHash)
+		if err != nil {
+			return nil, err
+		}
+		passwords[i] = password
+	}
+
+	hashed, err := HashPasswords(ctx, hasher, plaintexts)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		passwords[i] = hashed[j]
+	}
+
+	return passwords, nil
+}
@@ -2,8 +2,12 @@ package userz
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +45,121 @@ func TestPassword(t *testing.T) {
 	err = bcrypt.CompareHashAndPassword([]byte(newVessel.Password), []byte(testPass))
 	assert.NoError(err)
 }
+
+func TestHashPasswords(t *testing.T) {
+	assert := assert.New(t)
+
+	var plaintexts []string
+	for i := 0; i < 100; i++ {
+		plaintexts = append(plaintexts, fmt.Sprintf("password%d", i))
+	}
+
+	reversed := func(plaintext string) (Password, error) {
+		hashed := []byte(plaintext)
+		for i, j := 0, len(hashed)-1; i < j; i, j = i+1, j-1 {
+			hashed[i], hashed[j] = hashed[j], hashed[i]
+		}
+		return hashed, nil
+	}
+
+	hashed, err := HashPasswords(context.Background(), reversed, plaintexts)
+	assert.NoError(err)
+	assert.Len(hashed, len(plaintexts))
+	for i, plaintext := range plaintexts {
+		expected, _ := reversed(plaintext)
+		assert.Equal(expected, hashed[i])
+	}
+
+	hashed, err = HashPasswords(context.Background(), reversed, nil)
+	assert.NoError(err)
+	assert.Empty(hashed)
+
+	failure := errors.New("failure")
+	_, err = HashPasswords(context.Background(), func(plaintext string) (Password, error) {
+		if plaintext == "password42" {
+			return nil, failure
+		}
+		return reversed(plaintext)
+	}, plaintexts)
+	assert.ErrorIs(err, failure)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = HashPasswords(ctx, reversed, plaintexts)
+	assert.ErrorIs(err, context.Canceled)
+}
+
+const (
+	testPBKDF2 = "pbkdf2_sha256$1000$s4lt$WQ1kL6mYQ2WTkAW9zjlKYtt+uptLhbwZEY4unYaXvDA="
+	testSHA1   = "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"
+)
+
+func TestPasswordFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	bcrypted, err := NewPassword("secret")
+	assert.NoError(err)
+
+	cases := []struct {
+		hash   string
+		format string
+		legacy bool
+	}{
+		{string(bcrypted), HashBcrypt, false},
+		{testPBKDF2, HashPBKDF2SHA256, true},
+		{testSHA1, HashSaltedSHA1, true},
+	}
+
+	for _, c := range cases {
+		password, err := ParsePasswordHash(c.hash)
+		if !assert.NoError(err, c.hash) {
+			continue
+		}
+		assert.Equal(c.format, password.Format())
+		assert.Equal(c.legacy, password.Legacy())
+
+		ok, err := password.Matches("secret")
+		assert.NoError(err)
+		assert.True(ok, c.format)
+
+		ok, err = password.Matches("wrong")
+		assert.NoError(err)
+		assert.False(ok, c.format)
+	}
+}
+
+func TestParsePasswordHashInvalid(t *testing.T) {
+	for _, hash := range []string{
+		"secret",
+		"$2a$10$short",
+		"pbkdf2_sha256$many$s4lt$WQ1k",
+		"pbkdf2_sha256$1000$$WQ1k",
+		"pbkdf2_sha256$2000001$s4lt$WQ1kL6mYQ2WTkAW9zjlKYtt+uptLhbwZEY4unYaXvDA=",
+		"pbkdf2_sha256$1000$s4lt$" + strings.Repeat("WQ1k", 33),
+		"pbkdf2_sha256$1000$s4lt$not base64",
+		"sha1$s4lt$29acd6",
+		"sha1$s4lt",
+	} {
+		_, err := ParsePasswordHash(hash)
+		assert.ErrorIs(t, err, ErrUnknownPasswordHash, hash)
+	}
+}
+
+func TestUserPasswords(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := func(plaintext string) (Password, error) {
+		return Password(plaintext), nil
+	}
+
+	passwords, err := UserPasswords(context.Background(), plain, []*UserData{
+		{Password: "first"},
+		{PasswordHash: testSHA1},
+		{Password: "third"},
+	})
+	assert.NoError(err)
+	assert.Equal([]Password{Password("first"), Password(testSHA1), Password("third")}, passwords)
+
+	_, err = UserPasswords(context.Background(), plain, []*UserData{{PasswordHash: "unknown"}})
+	assert.ErrorIs(err, ErrUnknownPasswordHash)
+}
@@ -0,0 +1,220 @@
+package notifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrSlowConsumer is the reason a subscription gets closed when its
+	// consumer does not keep up with the notifications.
+	ErrSlowConsumer = errors.New("notifier: subscriber too slow, notifications dropped")
+	// ErrHistoryExpired is returned when resuming from a sequence number that
+	// is not in the history anymore.
+	ErrHistoryExpired = errors.New("notifier: the requested sequence number is not in the history anymore")
+	// ErrClosed is the reason the subscriptions get closed when the
+	// Broadcaster is, e.g. on shutdown.
+	ErrClosed = errors.New("notifier: broadcaster closed")
+)
+
+// Event is a notification as delivered to the subscribers of a Broadcaster.
+type Event struct {
+	Seq      uint64
+	Event    NotificationEvent
+	Metadata map[string]string
+}
+
+var _ Notifier = &Broadcaster{}
+
+// Broadcaster is an in-process Notifier that fans out every notification,
+// numbered with a monotonically increasing sequence number, to its
+// subscribers. It keeps a bounded history, so that subscribers can resume
+// after a disconnection. The sequence numbers are meaningful only within
+// the epoch of the Broadcaster, random and different for every instance.
+type Broadcaster struct {
+	epoch       string
+	historySize int
+	bufferSize  int
+
+	history []*Event
+	lastSeq uint64
+	subs    map[*Subscription]struct{}
+	closed  bool
+
+	mu sync.Mutex
+}
+
+// NewBroadcaster returns a Broadcaster keeping the last historySize events
+// and buffering up to bufferSize events for every subscriber.
+func NewBroadcaster(historySize, bufferSize int) *Broadcaster {
+	return &Broadcaster{
+		epoch:       newEpoch(),
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subs:        make(map[*Subscription]struct{}),
+	}
+}
+
+func newEpoch() string {
+	var epoch [8]byte
+	if _, err := rand.Read(epoch[:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(epoch[:])
+}
+
+// Epoch returns the epoch of the sequence numbers, to tell them apart from
+// those of other instances, or of the same one before a restart.
+func (b *Broadcaster) Epoch() string {
+	return b.epoch
+}
+
+func (b *Broadcaster) Init(ctx context.Context) error {
+	return nil
+}
+
+// Notify never blocks: subscribers whose buffer is full get disconnected
+// with ErrSlowConsumer.
+func (b *Broadcaster) Notify(ctx context.Context, event NotificationEvent, metadata map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastSeq++
+	ev := &Event{
+		Seq:      b.lastSeq,
+		Event:    event,
+		Metadata: metadata,
+	}
+
+	if b.historySize > 0 {
+		if len(b.history) >= b.historySize {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, ev)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- ev:
+		default:
+			b.drop(sub, ErrSlowConsumer)
+		}
+	}
+
+	return nil
+}
+
+// LastSeq returns the sequence number of the last notification.
+func (b *Broadcaster) LastSeq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lastSeq
+}
+
+// Subscribe returns a subscription receiving the notifications from now on,
+// and the sequence number of the last notification before it started.
+func (b *Broadcaster) Subscribe() (*Subscription, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(nil), b.lastSeq
+}
+
+// Resume returns a subscription receiving the notifications following the
+// given sequence number, replayed from the history, and then the live ones.
+func (b *Broadcaster) Resume(after uint64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if after > b.lastSeq {
+		return nil, ErrHistoryExpired
+	}
+
+	var replay []*Event
+	if after < b.lastSeq {
+		if len(b.history) == 0 || b.history[0].Seq > after+1 {
+			return nil, ErrHistoryExpired
+		}
+
+		replay = b.history[after+1-b.history[0].Seq:]
+	}
+
+	return b.subscribe(replay), nil
+}
+
+func (b *Broadcaster) subscribe(replay []*Event) *Subscription {
+	sub := &Subscription{
+		c:           make(chan *Event, b.bufferSize+len(replay)),
+		broadcaster: b,
+	}
+
+	for _, ev := range replay {
+		sub.c <- ev
+	}
+
+	b.subs[sub] = struct{}{}
+	if b.closed {
+		b.drop(sub, ErrClosed)
+	}
+
+	return sub
+}
+
+// Close ends every subscription, current and future, with ErrClosed, for
+// the subscribers to resume elsewhere. The notifications are still numbered
+// and kept in the history.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub, ErrClosed)
+	}
+}
+
+// drop must be called holding the lock.
+func (b *Broadcaster) drop(sub *Subscription, reason error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+
+	delete(b.subs, sub)
+	sub.err = reason
+	close(sub.c)
+}
+
+// Subscription receives the notifications of a Broadcaster.
+type Subscription struct {
+	c           chan *Event
+	err         error
+	broadcaster *Broadcaster
+}
+
+// C returns the channel of the notifications. It is closed when the
+// subscription ends; Err then tells why.
+func (s *Subscription) C() <-chan *Event {
+	return s.c
+}
+
+// Err returns the reason the subscription ended, or nil if it was closed by
+// the subscriber.
+func (s *Subscription) Err() error {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+
+	s.broadcaster.drop(s, nil)
+}
@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(sub *Subscription, n int) []uint64 {
+	var seqs []uint64
+	for i := 0; i < n; i++ {
+		ev, ok := <-sub.C()
+		if !ok {
+			break
+		}
+		seqs = append(seqs, ev.Seq)
+	}
+	return seqs
+}
+
+func TestBroadcaster(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	b := NewBroadcaster(3, 2)
+	assert.NotEqual(NewBroadcaster(3, 2).Epoch(), b.Epoch())
+
+	live, start := b.Subscribe()
+	assert.Equal(uint64(0), start)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(b.Notify(ctx, NotifyAccountCreated, map[string]string{"id": "1"}))
+	}
+	assert.Equal([]uint64{1, 2}, receive(live, 2))
+
+	require.NoError(b.Notify(ctx, NotifyAccountUpdated, nil))
+	require.NoError(b.Notify(ctx, NotifyAccountRemoved, nil))
+	assert.Equal(uint64(4), b.LastSeq())
+
+	// resume from the history
+	resumed, err := b.Resume(2)
+	require.NoError(err)
+	assert.Equal([]uint64{3, 4}, receive(resumed, 2))
+	resumed.Close()
+	_, ok := <-resumed.C()
+	assert.False(ok)
+	assert.NoError(resumed.Err())
+
+	// 1 is not in the history anymore
+	_, err = b.Resume(0)
+	assert.ErrorIs(err, ErrHistoryExpired)
+	_, err = b.Resume(5)
+	assert.ErrorIs(err, ErrHistoryExpired)
+
+	// resuming from the last one is fine
+	upToDate, err := b.Resume(4)
+	require.NoError(err)
+	defer upToDate.Close()
+
+	// live did not consume 3 and 4, the next one overflows its buffer
+	require.NoError(b.Notify(ctx, NotifyAccountCreated, nil))
+	assert.Equal([]uint64{3, 4}, receive(live, 3))
+	assert.ErrorIs(live.Err(), ErrSlowConsumer)
+
+	assert.Equal([]uint64{5}, receive(upToDate, 1))
+}
+
+func TestBroadcasterClose(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	b := NewBroadcaster(3, 2)
+
+	sub, _ := b.Subscribe()
+	require.NoError(b.Notify(ctx, NotifyAccountCreated, nil))
+
+	b.Close()
+	// the pending notifications are delivered first
+	assert.Equal([]uint64{1}, receive(sub, 2))
+	assert.ErrorIs(sub.Err(), ErrClosed)
+
+	late, _ := b.Subscribe()
+	_, ok := <-late.C()
+	assert.False(ok)
+	assert.ErrorIs(late.Err(), ErrClosed)
+}
@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	_ Notifier = &Multi{}
+	_ Checker  = &Multi{}
+	_ Flusher  = &Multi{}
+)
+
+// Multi fans out every notification to a list of notifiers.
+type Multi struct {
+	notifiers []Notifier
+}
+
+// NewMulti returns a Notifier that forwards to all the given notifiers, in
+// order.
+func NewMulti(notifiers ...Notifier) *Multi {
+	return &Multi{
+		notifiers: notifiers,
+	}
+}
+
+// Init initializes all the wrapped notifiers, stopping at the first failure.
+func (m *Multi) Init(ctx context.Context) error {
+	for i, n := range m.notifiers {
+		if err := n.Init(ctx); err != nil {
+			return fmt.Errorf("failed to initialize notifier #%d (%T): %w", i, n, err)
+		}
+	}
+
+	return nil
+}
+
+// Notify sends the notification to every wrapped notifier, even if some of
+// them fail. The first error encountered is returned.
+func (m *Multi) Notify(ctx context.Context, event NotificationEvent, metadata map[string]string) error {
+	var firstErr error
+
+	for i, n := range m.notifiers {
+		if err := n.Notify(ctx, event, metadata); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("notifier #%d (%T) failed: %w", i, n, err)
+		}
+	}
+
+	return firstErr
+}
+
+// Check reports the first failure among the wrapped notifiers implementing
+// Checker.
+func (m *Multi) Check(ctx context.Context) error {
+	for i, n := range m.notifiers {
+		if err := Check(ctx, n); err != nil {
+			return fmt.Errorf("notifier #%d (%T) is unhealthy: %w", i, n, err)
+		}
+	}
+
+	return nil
+}
+
+// Flush flushes every wrapped notifier implementing Flusher, even if some of
+// them fail. The first error encountered is returned.
+func (m *Multi) Flush(ctx context.Context) error {
+	var firstErr error
+
+	for i, n := range m.notifiers {
+		if err := Flush(ctx, n); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to flush notifier #%d (%T): %w", i, n, err)
+		}
+	}
+
+	return firstErr
+}
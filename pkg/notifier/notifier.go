@@ -1,16 +1,22 @@
 /*
 The notifier package
 
-	This is the interface a plugin has to implement to be usable by this
-	project as notification provider. The plugin has to expose an already
-	initialized symbol called Provider that implements the Notifier interface
-	here defined.
+	This is the interface a notifier has to implement to be usable by this
+	project as notification provider. Implementations register themselves by
+	name in the registry (see Register), usually from the init() of their
+	package, and get selected at runtime via configuration.
+
+	Notifiers may also be shipped as plugins: the plugin has to expose an
+	already initialized symbol called Provider that implements the Notifier
+	interface here defined. Plugins are loaded by the notifier registered as
+	"plugin".
 */
 package notifier
 
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 )
 
 type Notifier interface {
@@ -22,12 +28,52 @@ type Notifier interface {
 	Notify(ctx context.Context, event NotificationEvent, metadata map[string]string) error
 }
 
+// Checker is optionally implemented by the notifiers able to report their
+// health.
+type Checker interface {
+	// Check returns an error if the notifier is not able to deliver
+	// notifications.
+	Check(ctx context.Context) error
+}
+
+// Check reports the health of the given notifier, if it implements Checker,
+// and nil otherwise.
+func Check(ctx context.Context, n Notifier) error {
+	if checker, ok := n.(Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
+
+// Flusher is optionally implemented by the notifiers delivering the
+// notifications asynchronously.
+type Flusher interface {
+	// Flush delivers the notifications still pending, waiting at most until
+	// the context is done. It is meant to be called on shutdown, after the
+	// last notification.
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes the given notifier, if it implements Flusher, and returns
+// nil otherwise.
+func Flush(ctx context.Context, n Notifier) error {
+	if flusher, ok := n.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
+
 type NotificationEvent int
 
 const (
 	NotifyAccountCreated NotificationEvent = iota
 	NotifyAccountUpdated
 	NotifyAccountRemoved
+	// NotifyAccountsImported is sent once for many users added at once,
+	// with their count instead of their id.
+	NotifyAccountsImported
 )
 
 func (n NotificationEvent) String() string {
@@ -38,6 +84,8 @@ func (n NotificationEvent) String() string {
 		return "UPDATED"
 	case NotifyAccountRemoved:
 		return "REMOVED"
+	case NotifyAccountsImported:
+		return "IMPORTED"
 	default:
 		return "UNKNOWN"
 	}
@@ -46,3 +94,35 @@ func (n NotificationEvent) String() string {
 func (n NotificationEvent) MarshalJSON() ([]byte, error) {
 	return json.Marshal(n.String())
 }
+
+// ParseNotificationEvent is the inverse of NotificationEvent.String.
+func ParseNotificationEvent(s string) (NotificationEvent, error) {
+	switch s {
+	case "CREATED":
+		return NotifyAccountCreated, nil
+	case "UPDATED":
+		return NotifyAccountUpdated, nil
+	case "REMOVED":
+		return NotifyAccountRemoved, nil
+	case "IMPORTED":
+		return NotifyAccountsImported, nil
+	default:
+		return 0, fmt.Errorf("unknown notification event: %s", s)
+	}
+}
+
+func (n *NotificationEvent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	event, err := ParseNotificationEvent(s)
+	if err != nil {
+		return err
+	}
+
+	*n = event
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package notifier
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory builds a Notifier out of its configuration. The returned Notifier
+// still has to be initialized with Init before use.
+type Factory func(config map[string]string) (Notifier, error)
+
+var (
+	registry   = make(map[string]Factory)
+	registryMu sync.RWMutex
+)
+
+// Register makes a notifier available under the given name. It is meant to be
+// called from the init() of the package implementing the notifier, and it
+// panics if the name is empty or already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("notifier: cannot register a notifier without a name")
+	}
+
+	if factory == nil {
+		panic(fmt.Sprintf("notifier: nil factory for %s", name))
+	}
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("notifier: %s registered twice", name))
+	}
+
+	registry[name] = factory
+}
+
+// Registered returns the sorted names of the registered notifiers.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New builds the notifier registered under the given name.
+func New(name string, config map[string]string) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("notifier: unknown notifier %q (available: %v)", name, Registered())
+	}
+
+	n, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("notifier: failed to build %s: %w", name, err)
+	}
+
+	return n, nil
+}
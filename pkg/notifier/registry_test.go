@@ -0,0 +1,124 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	config map[string]string
+	inited bool
+	events []NotificationEvent
+	err    error
+}
+
+func (n *recordingNotifier) Init(ctx context.Context) error {
+	n.inited = true
+	return nil
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event NotificationEvent, metadata map[string]string) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	Register("test-recording", func(config map[string]string) (Notifier, error) {
+		return &recordingNotifier{config: config}, nil
+	})
+	Register("test-failing", func(config map[string]string) (Notifier, error) {
+		return nil, errors.New("boom")
+	})
+
+	assert.Contains(Registered(), "test-recording")
+	assert.Contains(Registered(), "test-failing")
+
+	assert.Panics(func() {
+		Register("test-recording", func(map[string]string) (Notifier, error) { return nil, nil })
+	})
+
+	n, err := New("test-recording", map[string]string{"key": "value"})
+	require.NoError(err)
+	assert.Equal("value", n.(*recordingNotifier).config["key"])
+
+	_, err = New("test-failing", nil)
+	assert.Error(err)
+
+	_, err = New("test-missing", nil)
+	assert.Error(err)
+}
+
+func TestMulti(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	first := &recordingNotifier{err: errors.New("boom")}
+	second := &recordingNotifier{}
+	multi := NewMulti(first, second)
+
+	require.NoError(multi.Init(ctx))
+	assert.True(first.inited)
+	assert.True(second.inited)
+
+	err := multi.Notify(ctx, NotifyAccountCreated, nil)
+	assert.Error(err)
+	assert.Equal([]NotificationEvent{NotifyAccountCreated}, first.events)
+	assert.Equal([]NotificationEvent{NotifyAccountCreated}, second.events)
+}
+
+type checkingNotifier struct {
+	recordingNotifier
+	healthErr error
+}
+
+func (n *checkingNotifier) Check(ctx context.Context) error {
+	return n.healthErr
+}
+
+func TestMultiCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	healthy := &checkingNotifier{}
+	unhealthy := &checkingNotifier{healthErr: errors.New("boom")}
+
+	assert.NoError(Check(ctx, &recordingNotifier{}))
+	assert.NoError(Check(ctx, NewMulti(&recordingNotifier{}, healthy)))
+	assert.ErrorIs(Check(ctx, NewMulti(healthy, unhealthy)), unhealthy.healthErr)
+}
+
+type flushingNotifier struct {
+	recordingNotifier
+	flushed  bool
+	flushErr error
+}
+
+func (n *flushingNotifier) Flush(ctx context.Context) error {
+	n.flushed = true
+	return n.flushErr
+}
+
+func TestMultiFlush(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	failing := &flushingNotifier{flushErr: errors.New("boom")}
+	flushing := &flushingNotifier{}
+
+	assert.NoError(Flush(ctx, &recordingNotifier{}))
+	assert.ErrorIs(Flush(ctx, NewMulti(failing, &recordingNotifier{}, flushing)), failing.flushErr)
+	// the others are flushed anyway
+	assert.True(failing.flushed)
+	assert.True(flushing.flushed)
+}
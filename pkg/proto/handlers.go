@@ -0,0 +1,108 @@
+package proto
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/leophys/userz"
+)
+
+// The helpers below are shared by the handlers of all the versions of the
+// API, which differ only in the conversion of the messages.
+
+// Request is a request to any version of the API.
+type Request interface {
+	protobuf.Message
+	GetServiceOrigin() string
+}
+
+// PageQuery is a Page request of any version of the API.
+type PageQuery interface {
+	GetFilter() map[string]string
+	GetPageSize() uint64
+	GetOffset() uint64
+	GetOrderBy() string
+	GetOrderDir() string
+}
+
+// RequestLogger returns the logger of the handler of the method (such as
+// "gRPC-Add"), carrying the origin of the request, after logging the
+// redacted request.
+func RequestLogger(ctx context.Context, api, method string, req Request) (zerolog.Logger, error) {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("origin", Origin(ctx, req.GetServiceOrigin())).
+		Str("handler", api+"-"+method).
+		Logger()
+
+	raw, err := redactedJSON(req)
+	if err != nil {
+		logger.Err(err).Msg("Cannot serialize request")
+		return logger, ErrInternal
+	}
+	logger.Debug().
+		RawJSON("request", raw).
+		Msg(method + " request via gRPC")
+
+	return logger, nil
+}
+
+// CheckUser maps the outcome of an operation of the store on a single user
+// to the status to return, if any: the error of the store or ErrNoUserFound
+// when there is no user.
+func CheckUser(logger zerolog.Logger, user *userz.User, err error) error {
+	if err != nil {
+		logger.Err(err).Msg("Error with the store")
+		return StoreError(err)
+	}
+	if user == nil {
+		logger.Debug().Msg("No user found")
+		return ErrNoUserFound
+	}
+
+	return nil
+}
+
+// FetchPage validates the query and fetches the page from the store, or
+// returns the status to return.
+func FetchPage(ctx context.Context, logger zerolog.Logger, store userz.Store, req PageQuery) (*ListPage, error) {
+	if req.GetPageSize() == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "userz: page_size must be a positive integer")
+	}
+
+	order, err := userz.ParseOrder(req.GetOrderBy(), req.GetOrderDir())
+	if err != nil {
+		logger.Info().Err(err).Msg("Unacceptable order")
+		return nil, status.Errorf(codes.InvalidArgument, "userz: %s", err)
+	}
+
+	filter, err := userz.ParseFilter(req.GetFilter())
+	if err != nil {
+		logger.Err(err).Msg("Failed to parse filter")
+		return nil, status.Errorf(codes.InvalidArgument, "userz: malformed filter")
+	}
+
+	users, pagination, err := store.Page(ctx, filter, &userz.PageParams{
+		Size:   uint(req.GetPageSize()),
+		Offset: uint(req.GetOffset()),
+		Order:  order,
+	})
+	if err != nil {
+		logger.Err(err).Msg("Error with the store")
+		return nil, StoreError(err)
+	}
+	if users == nil {
+		logger.Debug().Msg("No users found")
+		return nil, ErrNoMorePages
+	}
+
+	return &ListPage{
+		Users:      users,
+		Pagination: pagination,
+		Index:      uint(req.GetOffset() / req.GetPageSize()),
+	}, nil
+}
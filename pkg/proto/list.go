@@ -0,0 +1,183 @@
+package proto
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz"
+)
+
+// ListPage is a page of users, of a List stream or of a Page request.
+type ListPage struct {
+	Users      []*userz.User
+	Pagination userz.PaginationData
+	// Index is the index of the page, starting from 0.
+	Index uint
+	// ResumeToken allows to resume the stream after this page.
+	ResumeToken string
+}
+
+// resumeToken tells where a List stream was left.
+type resumeToken struct {
+	// CreatedAt and Id are the ones of the last user sent, to continue after
+	// it, in the order of List, even if the users before it changed.
+	CreatedAt time.Time `json:"c"`
+	Id        string    `json:"u"`
+	// Index is the index of the next page.
+	Index uint `json:"i"`
+	// Request is the fingerprint of the filter and of the page size, as the
+	// token is valid only for the same request.
+	Request string `json:"r"`
+}
+
+func (t *resumeToken) encode() (string, error) {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeResumeToken(token, request string) (*resumeToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed resume_token: %w", err)
+	}
+
+	var t resumeToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, fmt.Errorf("malformed resume_token: %w", err)
+	}
+
+	if t.Request != request {
+		return nil, fmt.Errorf("the resume_token belongs to a different request")
+	}
+
+	return &t, nil
+}
+
+// requestFingerprint identifies the filter and the page size of a request.
+func requestFingerprint(filter map[string]string, pageSize uint) (string, error) {
+	raw, err := json.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:", pageSize)
+	hash.Write(raw)
+
+	return hex.EncodeToString(hash.Sum(nil)[:8]), nil
+}
+
+// StreamList sends to send, one page at a time, the users matching the
+// filter, starting after the given resume token, if not empty. The returned
+// errors are gRPC statuses: the failures of the store become Internal and
+// the cancellation of the context Canceled or DeadlineExceeded.
+func StreamList(ctx context.Context, store userz.Store, filterMap map[string]string, pageSize uint, token string, send func(*ListPage) error) error {
+	logger := zerolog.Ctx(ctx)
+
+	filter, err := userz.ParseFilter(filterMap)
+	if err != nil {
+		logger.Err(err).Msg("Failed to parse filter")
+		return status.Errorf(codes.InvalidArgument, "userz: malformed filter")
+	}
+
+	request, err := requestFingerprint(filterMap, pageSize)
+	if err != nil {
+		logger.Err(err).Msg("Cannot fingerprint request")
+		return ErrInternal
+	}
+
+	next := &resumeToken{Request: request}
+	resuming := token != ""
+	if resuming {
+		next, err = decodeResumeToken(token, request)
+		if err != nil {
+			logger.Info().Err(err).Msg("Unacceptable resume token")
+			return status.Errorf(codes.InvalidArgument, "userz: %s", err)
+		}
+	}
+
+	iterator, err := store.List(ctx, filter, pageSize)
+	if err != nil {
+		logger.Err(err).Msg("Error with the store")
+		return StoreError(err)
+	}
+
+	// the users up to the last one sent are to be skipped here, if the
+	// iterator cannot seek
+	if seeker, ok := iterator.(userz.Seeker); ok && resuming {
+		if err := seeker.SeekAfter(next.CreatedAt, next.Id); err == nil {
+			resuming = false
+		} else if err != userz.ErrSeekUnsupported {
+			logger.Err(err).Msg("Error with the store")
+			return StoreError(err)
+		}
+	}
+
+	for {
+		users, err := iterator.Next(ctx)
+		if err == userz.ErrNoMorePages {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if err != nil {
+			logger.Err(err).Msg("Error with the store")
+			return StoreError(err)
+		}
+
+		if resuming {
+			users = usersAfter(users, next.CreatedAt, next.Id)
+			if len(users) == 0 {
+				continue
+			}
+			resuming = false
+		}
+
+		page := &ListPage{
+			Users:      users,
+			Pagination: iterator.Len(),
+			Index:      next.Index,
+		}
+
+		last := users[len(users)-1]
+		next.CreatedAt, next.Id = last.CreatedAt, last.Id
+		next.Index++
+
+		page.ResumeToken, err = next.encode()
+		if err != nil {
+			logger.Err(err).Msg("Cannot encode resume token")
+			return ErrInternal
+		}
+
+		if err := send(page); err != nil {
+			logger.Err(err).Msg("Error sending the users' page")
+			return err
+		}
+	}
+}
+
+// usersAfter returns the users coming after the one with the given creation
+// time and id.
+func usersAfter(users []*userz.User, createdAt time.Time, id string) []*userz.User {
+	for i, user := range users {
+		if user.After(createdAt, id) {
+			return users[i:]
+		}
+	}
+
+	return nil
+}
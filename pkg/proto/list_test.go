@@ -0,0 +1,151 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// receiveAll collects the pages of a List stream up to its end, returning
+// the error ending it, if any.
+func receiveAll(stream Userz_ListClient) ([]*ListResponse, error) {
+	var pages []*ListResponse
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return pages, nil
+		}
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, resp)
+	}
+}
+
+func TestListResume(t *testing.T) {
+	for _, seekable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("seekable=%v", seekable), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx := context.Background()
+			store := newPopulatedStore(5)
+			store.seekable = seekable
+			client := startServer(t, NewUserzServiceServer(store))
+
+			stream, err := client.List(ctx, &ListRequest{PageSize: 2})
+			require.NoError(err)
+
+			// the client stops after the first page
+			first, err := stream.Recv()
+			require.NoError(err)
+			require.NotEmpty(first.ResumeToken)
+
+			stream, err = client.List(ctx, &ListRequest{PageSize: 2, ResumeToken: first.ResumeToken})
+			require.NoError(err)
+
+			pages, err := receiveAll(stream)
+			require.NoError(err)
+			require.Len(pages, 2)
+			assert.Equal("2", pages[0].Users[0].Id)
+			assert.Equal("3", pages[0].Users[1].Id)
+			assert.Equal(uint64(1), pages[0].Pagination.PageIndex)
+			assert.Equal("4", pages[1].Users[0].Id)
+			assert.Equal(uint64(2), pages[1].Pagination.PageIndex)
+
+			// resuming from the last page yields nothing more
+			stream, err = client.List(ctx, &ListRequest{PageSize: 2, ResumeToken: pages[1].ResumeToken})
+			require.NoError(err)
+
+			pages, err = receiveAll(stream)
+			require.NoError(err)
+			assert.Empty(pages)
+		})
+	}
+}
+
+func TestListResumeAfterChanges(t *testing.T) {
+	for _, seekable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("seekable=%v", seekable), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ctx := context.Background()
+			store := newPopulatedStore(5)
+			store.seekable = seekable
+			client := startServer(t, NewUserzServiceServer(store))
+
+			stream, err := client.List(ctx, &ListRequest{PageSize: 2})
+			require.NoError(err)
+			first, err := stream.Recv()
+			require.NoError(err)
+
+			// the users already sent, the last one included, change before
+			// the stream is resumed: none of the others is skipped
+			store.drop("0")
+			store.drop("1")
+
+			stream, err = client.List(ctx, &ListRequest{PageSize: 2, ResumeToken: first.ResumeToken})
+			require.NoError(err)
+
+			pages, err := receiveAll(stream)
+			require.NoError(err)
+			var ids []string
+			for _, page := range pages {
+				for _, user := range page.Users {
+					ids = append(ids, user.Id)
+				}
+			}
+			assert.Equal([]string{"2", "3", "4"}, ids)
+		})
+	}
+}
+
+func TestListResumeTokenMismatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	client := startServer(t, NewUserzServiceServer(newPopulatedStore(5)))
+
+	stream, err := client.List(ctx, &ListRequest{PageSize: 2})
+	require.NoError(err)
+	first, err := stream.Recv()
+	require.NoError(err)
+
+	for _, req := range []*ListRequest{
+		{PageSize: 3, ResumeToken: first.ResumeToken},
+		{PageSize: 2, ResumeToken: first.ResumeToken, Filter: map[string]string{"id": "1"}},
+		{PageSize: 2, ResumeToken: "garbage"},
+	} {
+		stream, err := client.List(ctx, req)
+		require.NoError(err)
+
+		_, err = receiveAll(stream)
+		assert.Equal(codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestListStoreError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	store := newPopulatedStore(3)
+	store.nextErr = errors.New("boom")
+	client := startServer(t, NewUserzServiceServer(store))
+
+	stream, err := client.List(ctx, &ListRequest{PageSize: 2})
+	require.NoError(err)
+
+	pages, err := receiveAll(stream)
+	assert.Len(pages, 2)
+	assert.Equal(codes.Internal, status.Code(err))
+}
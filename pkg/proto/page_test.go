@@ -0,0 +1,85 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz"
+)
+
+func newPopulatedStore(n int) *mockStore {
+	store := &mockStore{}
+	for i := 0; i < n; i++ {
+		store.put(&userz.User{
+			Id:        fmt.Sprintf("%d", i),
+			NickName:  fmt.Sprintf("user%d", i),
+			CreatedAt: time.Unix(int64(i), 0),
+		})
+	}
+	return store
+}
+
+func TestPage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	client := startServer(t, NewUserzServiceServer(newPopulatedStore(5)))
+
+	resp, err := client.Page(ctx, &PageRequest{PageSize: 2, Offset: 3})
+	require.NoError(err)
+	require.Len(resp.Users, 2)
+	assert.Equal("3", resp.Users[0].Id)
+	assert.Equal("4", resp.Users[1].Id)
+	assert.Equal(uint64(5), resp.Pagination.TotalElements)
+	assert.Equal(uint64(3), resp.Pagination.TotalPages)
+	assert.Equal(uint64(2), resp.Pagination.PageSize)
+	assert.Equal(uint64(1), resp.Pagination.PageIndex)
+
+	_, err = client.Page(ctx, &PageRequest{PageSize: 2, Offset: 5})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	_, err = client.Page(ctx, &PageRequest{})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Page(ctx, &PageRequest{PageSize: 2, OrderBy: "nope"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestListPagination(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	client := startServer(t, NewUserzServiceServer(newPopulatedStore(5)))
+
+	stream, err := client.List(ctx, &ListRequest{PageSize: 2})
+	require.NoError(err)
+
+	var pages []*ListResponse
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(err)
+		pages = append(pages, resp)
+	}
+
+	require.Len(pages, 3)
+	for i, page := range pages {
+		assert.Equal(uint64(5), page.Pagination.TotalElements)
+		assert.Equal(uint64(3), page.Pagination.TotalPages)
+		assert.Equal(uint64(2), page.Pagination.PageSize)
+		assert.Equal(uint64(i), page.Pagination.PageIndex)
+	}
+	assert.Len(pages[2].Users, 1)
+}
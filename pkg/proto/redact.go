@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redacted replaces the secrets in the redacted messages.
+const Redacted = "[REDACTED]"
+
+// sensitiveFields are the names of the fields never to be logged, in any
+// message: the passwords, in plaintext or hashed, and the credentials.
+var sensitiveFields = map[protoreflect.Name]bool{
+	"password":      true,
+	"password_hash": true,
+	"api_key":       true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"secret":        true,
+}
+
+// Redact returns a copy of the message with all the sensitive fields,
+// at any depth, replaced by Redacted (or cleared, if not strings). The
+// original message is left untouched.
+func Redact(msg protobuf.Message) protobuf.Message {
+	if msg == nil {
+		return nil
+	}
+
+	clone := protobuf.Clone(msg)
+	redact(clone.ProtoReflect())
+
+	return clone
+}
+
+func redact(msg protoreflect.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if sensitiveFields[fd.Name()] {
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				msg.Set(fd, protoreflect.ValueOfString(Redacted))
+			} else {
+				msg.Clear(fd)
+			}
+			return true
+		}
+
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				redact(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				redact(v.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			redact(value.Message())
+		}
+
+		return true
+	})
+}
+
+// redactedJSON serializes the redacted message, to be logged, with the
+// names of the fields in the protobuf definition.
+func redactedJSON(msg protobuf.Message) ([]byte, error) {
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(Redact(msg))
+}
@@ -0,0 +1,141 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const secret = "s3cr3tPassw0rd"
+
+func TestRedact(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &AddRequest{
+		ServiceOrigin: "test",
+		Data: &UserData{
+			NickName: "nick",
+			Email:    "nick@example.com",
+			Password: secret,
+		},
+	}
+
+	redacted := Redact(req).(*AddRequest)
+	assert.Equal(Redacted, redacted.Data.Password)
+	assert.Equal("nick", redacted.Data.NickName)
+	assert.Equal(secret, req.Data.Password, "the original must be untouched")
+
+	raw, err := redactedJSON(&UpdateRequest{Id: "1", Data: req.Data})
+	assert.NoError(err)
+	assert.NotContains(string(raw), secret)
+	assert.Contains(string(raw), `"nick_name"`)
+
+	assert.Nil(Redact(nil))
+}
+
+func TestRedactCredentials(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	names := []string{"login", "password_hash", "api_key", "token"}
+	var fields []*descriptorpb.FieldDescriptorProto
+	for i, name := range names {
+		fields = append(fields, &descriptorpb.FieldDescriptorProto{
+			Name:   protobuf.String(name),
+			Number: protobuf.Int32(int32(i + 1)),
+			Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		})
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        protobuf.String("credentials.proto"),
+		Package:     protobuf.String("test"),
+		Syntax:      protobuf.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: protobuf.String("Credentials"), Field: fields}},
+	}, nil)
+	require.NoError(err)
+
+	msg := dynamicpb.NewMessage(file.Messages().Get(0))
+	for _, name := range names {
+		msg.Set(msg.Descriptor().Fields().ByName(protoreflect.Name(name)), protoreflect.ValueOfString(secret))
+	}
+
+	raw, err := redactedJSON(msg)
+	require.NoError(err)
+	assert.Equal(1, bytes.Count(raw, []byte(secret)), "only the login is kept")
+	assert.Equal(3, bytes.Count(raw, []byte(Redacted)))
+}
+
+func TestNoSecretsLeave(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs).Level(zerolog.DebugLevel)
+	withLogger := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(logger.WithContext(ctx), req)
+	}
+
+	ctx := context.Background()
+	store := &mockStore{}
+	client := startServer(t, NewUserzServiceServer(store), grpc.UnaryInterceptor(withLogger))
+
+	added, err := client.Add(ctx, &AddRequest{
+		Data: &UserData{
+			NickName: "nick",
+			Email:    "nick@example.com",
+			Password: secret,
+		},
+	})
+	require.NoError(err)
+
+	hash := store.users[0].Password.String()
+	require.NotEmpty(hash)
+
+	updated, err := client.Update(ctx, &UpdateRequest{
+		Id:   added.Id,
+		Data: &UserData{NickName: "nick", Password: secret},
+	})
+	require.NoError(err)
+
+	removed, err := client.Remove(ctx, &RemoveRequest{Id: added.Id})
+	require.NoError(err)
+
+	stream, err := client.List(ctx, &ListRequest{PageSize: 10})
+	require.NoError(err)
+
+	var responses []protobuf.Message
+	responses = append(responses, added, updated, removed)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(err)
+		responses = append(responses, resp)
+	}
+
+	for _, resp := range responses {
+		raw, err := protobuf.Marshal(resp)
+		require.NoError(err)
+		assert.NotContains(string(raw), hash)
+		assert.NotContains(string(raw), secret)
+	}
+
+	require.NotEmpty(logs.String())
+	assert.NotContains(logs.String(), secret)
+	assert.NotContains(logs.String(), hash)
+	assert.Contains(logs.String(), Redacted)
+}
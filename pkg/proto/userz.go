@@ -2,57 +2,62 @@ package proto
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"time"
 
-	"github.com/rs/zerolog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/auth"
+	"github.com/leophys/userz/internal/grpcutils"
+	"github.com/leophys/userz/pkg/notifier"
 )
 
 var (
 	ErrNoUserFound = status.Error(codes.NotFound, "userz: no user found with given criteria")
 	ErrInternal    = status.Error(codes.Internal, "userz: there has been an internal error")
+	ErrNoMorePages = status.Error(codes.NotFound, "userz: no more pages")
 )
 
 type Service struct {
-	store userz.Store
+	store  userz.Store
+	events *notifier.Broadcaster
 
 	UnimplementedUserzServer
 }
 
-func NewUserzServiceServer(store userz.Store) UserzServer {
-	return &Service{
+// ServiceOption customizes the Service.
+type ServiceOption func(*Service)
+
+// WithEvents enables the Watch RPC, fed by the given broadcaster.
+func WithEvents(events *notifier.Broadcaster) ServiceOption {
+	return func(s *Service) {
+		s.events = events
+	}
+}
+
+func NewUserzServiceServer(store userz.Store, opts ...ServiceOption) UserzServer {
+	s := &Service{
 		store: store,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 func (s *Service) Add(ctx context.Context, req *AddRequest) (*AddResponse, error) {
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("origin", req.ServiceOrigin).
-		Str("handler", "gRPC-Add").
-		Logger()
-
-	raw, err := json.Marshal(req)
+	logger, err := RequestLogger(ctx, "gRPC", "Add", req)
 	if err != nil {
-		logger.Err(err).Msg("Cannot serialize request")
-		return nil, ErrInternal
+		return nil, err
 	}
-	logger.Debug().
-		RawJSON("request", raw).
-		Msg("Add request via gRPC")
 
 	user, err := s.store.Add(ctx, req.Data.Into())
-	if err != nil {
-		logger.Err(err).Msg("Error with the store")
-		return nil, ErrInternal
-	}
-	if user == nil {
-		logger.Debug().Msg("No user found")
-		return nil, ErrNoUserFound
+	if err := CheckUser(logger, user, err); err != nil {
+		return nil, err
 	}
 
 	return &AddResponse{
@@ -61,29 +66,14 @@ func (s *Service) Add(ctx context.Context, req *AddRequest) (*AddResponse, error
 }
 
 func (s *Service) Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error) {
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("origin", req.ServiceOrigin).
-		Str("handler", "gRPC-Update").
-		Logger()
-
-	raw, err := json.Marshal(req)
+	logger, err := RequestLogger(ctx, "gRPC", "Update", req)
 	if err != nil {
-		logger.Err(err).Msg("Cannot serialize request")
-		return nil, ErrInternal
+		return nil, err
 	}
-	logger.Debug().
-		RawJSON("request", raw).
-		Msg("Update request via gRPC")
 
 	user, err := s.store.Update(ctx, req.Id, req.Data.Into())
-	if err != nil {
-		logger.Err(err).Msg("Error with the store")
-		return nil, ErrInternal
-	}
-	if user == nil {
-		logger.Debug().Msg("No user found")
-		return nil, ErrNoUserFound
+	if err := CheckUser(logger, user, err); err != nil {
+		return nil, err
 	}
 
 	return &UpdateResponse{
@@ -92,29 +82,14 @@ func (s *Service) Update(ctx context.Context, req *UpdateRequest) (*UpdateRespon
 }
 
 func (s *Service) Remove(ctx context.Context, req *RemoveRequest) (*RemoveResponse, error) {
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("origin", req.ServiceOrigin).
-		Str("handler", "gRPC-Remove").
-		Logger()
-
-	raw, err := json.Marshal(req)
+	logger, err := RequestLogger(ctx, "gRPC", "Remove", req)
 	if err != nil {
-		logger.Err(err).Msg("Cannot serialize request")
-		return nil, ErrInternal
+		return nil, err
 	}
-	logger.Debug().
-		RawJSON("request", raw).
-		Msg("Remove request via gRPC")
 
 	user, err := s.store.Remove(ctx, req.Id)
-	if err != nil {
-		logger.Err(err).Msg("Error with the store")
-		return nil, ErrInternal
-	}
-	if user == nil {
-		logger.Debug().Msg("No user found")
-		return nil, ErrNoUserFound
+	if err := CheckUser(logger, user, err); err != nil {
+		return nil, err
 	}
 
 	return &RemoveResponse{
@@ -124,56 +99,91 @@ func (s *Service) Remove(ctx context.Context, req *RemoveRequest) (*RemoveRespon
 
 func (s *Service) List(req *ListRequest, server Userz_ListServer) error {
 	ctx := server.Context()
-	logger := zerolog.Ctx(ctx).
-		With().
-		Str("origin", req.ServiceOrigin).
-		Str("handler", "gRPC-List").
-		Logger()
-
-	raw, err := json.Marshal(req)
+	logger, err := RequestLogger(ctx, "gRPC", "List", req)
 	if err != nil {
-		logger.Err(err).Msg("Cannot serialize request")
-		return ErrInternal
+		return err
 	}
-	logger.Debug().
-		RawJSON("request", raw).
-		Msg("List request via gRPC")
 
 	if req.PageSize < 0 {
 		return status.Errorf(codes.InvalidArgument, "userz: page_size must be a positive integer")
 	}
 	pageSize := uint(req.PageSize)
 
-	filter, err := userz.ParseFilter(req.Filter)
+	return StreamList(logger.WithContext(ctx), s.store, req.Filter, pageSize, req.ResumeToken, func(page *ListPage) error {
+		var users []*User
+		for _, user := range page.Users {
+			users = append(users, FromUser(user))
+		}
+
+		return server.Send(&ListResponse{
+			Users:       users,
+			Pagination:  FromPaginationData(page.Pagination, page.Index),
+			ResumeToken: page.ResumeToken,
+		})
+	})
+}
+
+func (s *Service) Page(ctx context.Context, req *PageRequest) (*PageResponse, error) {
+	logger, err := RequestLogger(ctx, "gRPC", "Page", req)
 	if err != nil {
-		logger.Err(err).Msg("Failed to parse filter")
-		return status.Errorf(codes.InvalidArgument, "userz: malformed filter")
+		return nil, err
 	}
 
-	iterator, err := s.store.List(ctx, filter, pageSize)
+	page, err := FetchPage(ctx, logger, s.store, req)
 	if err != nil {
-		logger.Err(err).Msg("Error with the store")
-		return ErrInternal
+		return nil, err
 	}
 
-	for {
-		users, err := iterator.Next(ctx)
-		if err == userz.ErrNoMorePages {
-			break
-		}
+	resp := &PageResponse{
+		Pagination: FromPaginationData(page.Pagination, page.Index),
+	}
+	for _, user := range page.Users {
+		resp.Users = append(resp.Users, FromUser(user))
+	}
 
-		var respUsers []*User
-		for _, user := range users {
-			respUsers = append(respUsers, FromUser(user))
-		}
+	return resp, nil
+}
 
-		if err := server.Send(&ListResponse{Users: respUsers}); err != nil {
-			logger.Err(err).Msg("Error sending the users' page")
-			return err
-		}
+// StoreError converts an error of the store to a status: PermissionDenied
+// if the operation is forbidden to the caller, NotFound for an unknown user,
+// InvalidArgument for a malformed id, AlreadyExists for a duplicate nickname
+// or email, Internal otherwise.
+func StoreError(err error) error {
+	switch {
+	case errors.Is(err, userz.ErrForbidden):
+		return status.Error(codes.PermissionDenied, "userz: the operation is not allowed")
+	case errors.Is(err, userz.ErrNotFound):
+		return ErrNoUserFound
+	case errors.Is(err, userz.ErrInvalidId):
+		return status.Error(codes.InvalidArgument, "userz: invalid user id")
+	case errors.Is(err, userz.ErrConflict):
+		return status.Error(codes.AlreadyExists, "userz: a user with the same nickname or email already exists")
 	}
 
-	return nil
+	return ErrInternal
+}
+
+// Origin returns the authenticated principal or identity of the client, if
+// any, or else the self-declared service origin.
+func Origin(ctx context.Context, declared string) string {
+	if principal := auth.PrincipalFrom(ctx); principal != nil {
+		return principal.ID
+	}
+
+	if id := grpcutils.Identity(ctx); id != "" {
+		return id
+	}
+
+	return declared
+}
+
+func FromPaginationData(data userz.PaginationData, pageIndex uint) *PaginationData {
+	return &PaginationData{
+		TotalElements: uint64(data.TotalElements),
+		TotalPages:    uint64(data.TotalPages),
+		PageSize:      uint64(data.PageSize),
+		PageIndex:     uint64(pageIndex),
+	}
 }
 
 func FromUserData(user *userz.UserData) *UserData {
@@ -255,7 +265,6 @@ func FromUser(user *userz.User) *User {
 		LastName:  lastName,
 		NickName:  user.NickName,
 		Email:     user.Email,
-		Password:  user.Password.String(),
 		Country:   country,
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
@@ -26,6 +26,8 @@ type UserzClient interface {
 	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
 	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (Userz_ListClient, error)
+	Page(ctx context.Context, in *PageRequest, opts ...grpc.CallOption) (*PageResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Userz_WatchClient, error)
 }
 
 type userzClient struct {
@@ -95,6 +97,47 @@ func (x *userzListClient) Recv() (*ListResponse, error) {
 	return m, nil
 }
 
+func (c *userzClient) Page(ctx context.Context, in *PageRequest, opts ...grpc.CallOption) (*PageResponse, error) {
+	out := new(PageResponse)
+	err := c.cc.Invoke(ctx, "/proto.Userz/Page", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userzClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Userz_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Userz_ServiceDesc.Streams[1], "/proto.Userz/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &userzWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Userz_WatchClient interface {
+	Recv() (*UserEvent, error)
+	grpc.ClientStream
+}
+
+type userzWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *userzWatchClient) Recv() (*UserEvent, error) {
+	m := new(UserEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // UserzServer is the server API for Userz service.
 // All implementations must embed UnimplementedUserzServer
 // for forward compatibility
@@ -103,6 +146,8 @@ type UserzServer interface {
 	Update(context.Context, *UpdateRequest) (*UpdateResponse, error)
 	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
 	List(*ListRequest, Userz_ListServer) error
+	Page(context.Context, *PageRequest) (*PageResponse, error)
+	Watch(*WatchRequest, Userz_WatchServer) error
 	mustEmbedUnimplementedUserzServer()
 }
 
@@ -122,6 +167,12 @@ func (UnimplementedUserzServer) Remove(context.Context, *RemoveRequest) (*Remove
 func (UnimplementedUserzServer) List(*ListRequest, Userz_ListServer) error {
 	return status.Errorf(codes.Unimplemented, "method List not implemented")
 }
+func (UnimplementedUserzServer) Page(context.Context, *PageRequest) (*PageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Page not implemented")
+}
+func (UnimplementedUserzServer) Watch(*WatchRequest, Userz_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedUserzServer) mustEmbedUnimplementedUserzServer() {}
 
 // UnsafeUserzServer may be embedded to opt out of forward compatibility for this service.
@@ -210,6 +261,45 @@ func (x *userzListServer) Send(m *ListResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Userz_Page_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserzServer).Page(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Userz/Page",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserzServer).Page(ctx, req.(*PageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Userz_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserzServer).Watch(m, &userzWatchServer{stream})
+}
+
+type Userz_WatchServer interface {
+	Send(*UserEvent) error
+	grpc.ServerStream
+}
+
+type userzWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *userzWatchServer) Send(m *UserEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Userz_ServiceDesc is the grpc.ServiceDesc for Userz service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -229,6 +319,10 @@ var Userz_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Remove",
 			Handler:    _Userz_Remove_Handler,
 		},
+		{
+			MethodName: "Page",
+			Handler:    _Userz_Page_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -236,6 +330,11 @@ var Userz_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Userz_List_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Userz_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "userz.proto",
 }
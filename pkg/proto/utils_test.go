@@ -0,0 +1,263 @@
+package proto
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/leophys/userz"
+)
+
+var (
+	_ userz.Store     = &mockStore{}
+	_ userz.BulkAdder = &mockStore{}
+	_ userz.Scoper    = &mockStore{}
+)
+
+// mockStore keeps the users in insertion order, which has to be the one of
+// List, and honours only the Id of the filters.
+type mockStore struct {
+	users []*userz.User
+	delay time.Duration
+	// seekable makes List return an iterator implementing userz.Seeker
+	seekable bool
+	// nextErr is returned by the iterators after the last page, instead of
+	// userz.ErrNoMorePages
+	nextErr error
+	// forbidden makes List and Page fail as not allowed to the caller
+	forbidden bool
+	// own restricts Scope to the user with this id, as a rule limited to
+	// the own user would
+	own string
+	mu  sync.Mutex
+}
+
+func (s *mockStore) put(user *userz.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, u := range s.users {
+		if u.Id == user.Id {
+			s.users[i] = user
+			return
+		}
+	}
+	s.users = append(s.users, user)
+}
+
+// drop removes the user from the store, as if it did not match a filter
+// anymore.
+func (s *mockStore) drop(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, u := range s.users {
+		if u.Id == id {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *mockStore) Add(ctx context.Context, data *userz.UserData) (*userz.User, error) {
+	password, err := userz.NewPassword(data.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &userz.User{
+		Id:       data.NickName,
+		NickName: data.NickName,
+		Email:    data.Email,
+		Password: password,
+	}
+	s.put(user)
+
+	return user, nil
+}
+
+func (s *mockStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	for _, data := range users {
+		if _, err := s.Add(ctx, data); err != nil {
+			return 0, err
+		}
+	}
+
+	return uint(len(users)), nil
+}
+
+func (s *mockStore) Update(ctx context.Context, id string, data *userz.UserData) (*userz.User, error) {
+	users := s.matching(&userz.Filter{Id: id})
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users[0], nil
+}
+
+func (s *mockStore) Remove(ctx context.Context, id string) (*userz.User, error) {
+	return s.Update(ctx, id, nil)
+}
+
+func (s *mockStore) matching(filter *userz.Filter) []*userz.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []*userz.User
+	for _, u := range s.users {
+		if filter == nil || filter.Id == "" || filter.Id == u.Id {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+func (s *mockStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	if s.forbidden {
+		return nil, userz.ErrForbidden
+	}
+
+	users := s.matching(filter)
+
+	var pages [][]*userz.User
+	for len(users) > 0 {
+		n := int(pageSize)
+		if n > len(users) {
+			n = len(users)
+		}
+		pages = append(pages, users[:n])
+		users = users[n:]
+	}
+
+	iterator := &mockIterator{
+		pages: pages,
+		data: userz.PaginationData{
+			TotalElements: uint(len(s.matching(filter))),
+			TotalPages:    uint(len(pages)),
+			PageSize:      pageSize,
+		},
+		err: s.nextErr,
+	}
+
+	if s.seekable {
+		return &seekingIterator{iterator}, nil
+	}
+
+	return iterator, nil
+}
+
+func (s *mockStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
+	time.Sleep(s.delay)
+
+	if s.forbidden {
+		return nil, userz.PaginationData{}, userz.ErrForbidden
+	}
+
+	users := s.matching(filter)
+	pagination := userz.NewPaginationData(uint(len(users)), params.Size)
+	if params.Offset >= uint(len(users)) {
+		return nil, pagination, nil
+	}
+	users = users[params.Offset:]
+	if uint(len(users)) > params.Size {
+		users = users[:params.Size]
+	}
+	return users, pagination, nil
+}
+
+// Scope returns the filter as is, for the users in the events to be matched
+// in memory.
+func (s *mockStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	if s.forbidden {
+		return nil, userz.ErrForbidden
+	}
+
+	if s.own != "" {
+		restricted := userz.Filter{}
+		if filter != nil {
+			restricted = *filter
+		}
+		restricted.Id = s.own
+		return &restricted, nil
+	}
+
+	return filter, nil
+}
+
+type mockIterator struct {
+	pages [][]*userz.User
+	data  userz.PaginationData
+	err   error
+}
+
+func (i *mockIterator) Len() userz.PaginationData {
+	return i.data
+}
+
+func (i *mockIterator) Next(ctx context.Context) ([]*userz.User, error) {
+	if len(i.pages) == 0 {
+		if i.err != nil {
+			return nil, i.err
+		}
+		return nil, userz.ErrNoMorePages
+	}
+	page := i.pages[0]
+	i.pages = i.pages[1:]
+	return page, nil
+}
+
+type seekingIterator struct {
+	*mockIterator
+}
+
+func (i *seekingIterator) SeekAfter(createdAt time.Time, id string) error {
+	var users []*userz.User
+	for _, page := range i.pages {
+		for _, user := range page {
+			if user.After(createdAt, id) {
+				users = append(users, user)
+			}
+		}
+	}
+
+	i.pages = nil
+	for len(users) > 0 {
+		n := int(i.data.PageSize)
+		if n > len(users) {
+			n = len(users)
+		}
+		i.pages = append(i.pages, users[:n])
+		users = users[n:]
+	}
+
+	return nil
+}
+
+// startServer serves the service on an in-memory listener and returns a
+// client connected to it.
+func startServer(t *testing.T, service UserzServer, opts ...grpc.ServerOption) UserzClient {
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(opts...)
+	RegisterUserzServer(s, service)
+
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewUserzClient(conn)
+}
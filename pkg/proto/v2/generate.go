@@ -0,0 +1,6 @@
+// This package holds the v2 gRPC definitions and generated code, which use
+// the well-known types. It is served alongside the v1 one.
+//
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative v2/userz.proto
+//go:generate protoc -I .. --go-grpc_out=.. --go-grpc_opt=paths=source_relative v2/userz.proto
+package protov2
@@ -0,0 +1,254 @@
+package protov2
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/pkg/proto"
+)
+
+var (
+	ErrNoUserFound = proto.ErrNoUserFound
+	ErrInternal    = proto.ErrInternal
+	ErrNoMorePages = proto.ErrNoMorePages
+)
+
+type Service struct {
+	store userz.Store
+
+	UnimplementedUserzServer
+}
+
+func NewUserzServiceServer(store userz.Store) UserzServer {
+	return &Service{
+		store: store,
+	}
+}
+
+func (s *Service) Add(ctx context.Context, req *AddRequest) (*AddResponse, error) {
+	logger, err := proto.RequestLogger(ctx, "gRPCv2", "Add", req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Data == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "userz: missing data")
+	}
+
+	user, err := s.store.Add(ctx, req.Data.Into())
+	if err := proto.CheckUser(logger, user, err); err != nil {
+		return nil, err
+	}
+
+	return &AddResponse{
+		User: FromUser(user),
+	}, nil
+}
+
+func (s *Service) Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error) {
+	logger, err := proto.RequestLogger(ctx, "gRPCv2", "Update", req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := req.into()
+	if err != nil {
+		logger.Info().Err(err).Msg("Unacceptable update")
+		return nil, status.Errorf(codes.InvalidArgument, "userz: %s", err)
+	}
+
+	user, err := s.store.Update(ctx, req.Id, data)
+	if err := proto.CheckUser(logger, user, err); err != nil {
+		return nil, err
+	}
+
+	return &UpdateResponse{
+		User: FromUser(user),
+	}, nil
+}
+
+func (s *Service) Remove(ctx context.Context, req *RemoveRequest) (*RemoveResponse, error) {
+	logger, err := proto.RequestLogger(ctx, "gRPCv2", "Remove", req)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.Remove(ctx, req.Id)
+	if err := proto.CheckUser(logger, user, err); err != nil {
+		return nil, err
+	}
+
+	return &RemoveResponse{
+		User: FromUser(user),
+	}, nil
+}
+
+func (s *Service) List(req *ListRequest, server Userz_ListServer) error {
+	ctx := server.Context()
+	logger, err := proto.RequestLogger(ctx, "gRPCv2", "List", req)
+	if err != nil {
+		return err
+	}
+
+	return proto.StreamList(logger.WithContext(ctx), s.store, req.Filter, uint(req.PageSize), req.ResumeToken, func(page *proto.ListPage) error {
+		var users []*User
+		for _, user := range page.Users {
+			users = append(users, FromUser(user))
+		}
+
+		return server.Send(&ListResponse{
+			Users:       users,
+			Pagination:  FromPaginationData(page.Pagination, page.Index),
+			ResumeToken: page.ResumeToken,
+		})
+	})
+}
+
+func (s *Service) Page(ctx context.Context, req *PageRequest) (*PageResponse, error) {
+	logger, err := proto.RequestLogger(ctx, "gRPCv2", "Page", req)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := proto.FetchPage(ctx, logger, s.store, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &PageResponse{
+		Pagination: FromPaginationData(page.Pagination, page.Index),
+	}
+	for _, user := range page.Users {
+		resp.Users = append(resp.Users, FromUser(user))
+	}
+
+	return resp, nil
+}
+
+func FromPaginationData(data userz.PaginationData, pageIndex uint) *PaginationData {
+	return &PaginationData{
+		TotalElements: uint64(data.TotalElements),
+		TotalPages:    uint64(data.TotalPages),
+		PageSize:      uint64(data.PageSize),
+		PageIndex:     uint64(pageIndex),
+	}
+}
+
+func FromUserData(user *userz.UserData) *UserData {
+	return &UserData{
+		FirstName: wrap(user.FirstName),
+		LastName:  wrap(user.LastName),
+		NickName:  user.NickName,
+		Email:     user.Email,
+		Password:  user.Password,
+		Country:   wrap(user.Country),
+	}
+}
+
+// Into converts the data, treating the absent optional fields as empty.
+func (d *UserData) Into() *userz.UserData {
+	return &userz.UserData{
+		FirstName: d.GetFirstName().GetValue(),
+		LastName:  d.GetLastName().GetValue(),
+		NickName:  d.NickName,
+		Password:  d.Password,
+		Email:     d.Email,
+		Country:   d.GetCountry().GetValue(),
+	}
+}
+
+// into converts the data of the update according to the mask: without one,
+// only the fields present are set; otherwise only the fields in the mask are
+// considered, and the optional ones in the mask but absent (or empty) are
+// cleared.
+func (req *UpdateRequest) into() (*userz.UserData, error) {
+	data := req.Data
+	if data == nil {
+		data = &UserData{}
+	}
+
+	if len(req.UpdateMask.GetPaths()) == 0 {
+		return data.Into(), nil
+	}
+
+	if !req.UpdateMask.IsValid(data) {
+		return nil, fmt.Errorf("invalid update_mask %v", req.UpdateMask.GetPaths())
+	}
+
+	result := &userz.UserData{}
+
+	for _, path := range req.UpdateMask.GetPaths() {
+		switch path {
+		case "first_name":
+			result.FirstName = setOrClear(result, data.GetFirstName(), userz.FieldFirstName)
+		case "last_name":
+			result.LastName = setOrClear(result, data.GetLastName(), userz.FieldLastName)
+		case "country":
+			result.Country = setOrClear(result, data.GetCountry(), userz.FieldCountry)
+		case "nick_name":
+			if data.NickName == "" {
+				return nil, errNotClearable(path)
+			}
+			result.NickName = data.NickName
+		case "email":
+			if data.Email == "" {
+				return nil, errNotClearable(path)
+			}
+			result.Email = data.Email
+		case "password":
+			if data.Password == "" {
+				return nil, errNotClearable(path)
+			}
+			result.Password = data.Password
+		}
+	}
+
+	return result, nil
+}
+
+func errNotClearable(path string) error {
+	return fmt.Errorf("%s cannot be cleared", path)
+}
+
+func setOrClear(data *userz.UserData, value *wrapperspb.StringValue, field userz.Field) string {
+	if value.GetValue() == "" {
+		data.Clear = append(data.Clear, field)
+	}
+
+	return value.GetValue()
+}
+
+func FromUser(user *userz.User) *User {
+	result := &User{
+		Id:        user.Id,
+		FirstName: wrap(user.FirstName),
+		LastName:  wrap(user.LastName),
+		NickName:  user.NickName,
+		Email:     user.Email,
+		Country:   wrap(user.Country),
+	}
+
+	if !user.CreatedAt.IsZero() {
+		result.CreatedAt = timestamppb.New(user.CreatedAt)
+	}
+
+	if !user.UpdatedAt.IsZero() {
+		result.UpdatedAt = timestamppb.New(user.UpdatedAt)
+	}
+
+	return result
+}
+
+func wrap(value string) *wrapperspb.StringValue {
+	if value == "" {
+		return nil
+	}
+
+	return wrapperspb.String(value)
+}
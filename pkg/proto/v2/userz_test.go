@@ -0,0 +1,137 @@
+package protov2
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/leophys/userz/pkg/proto"
+	"github.com/leophys/userz/store/memory"
+)
+
+// startServer serves both the v1 and the v2 services, backed by the same
+// store, on an in-memory listener and returns the connection to it.
+func startServer(t *testing.T) *grpc.ClientConn {
+	store := memory.NewMemoryStore()
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	proto.RegisterUserzServer(s, proto.NewUserzServiceServer(store))
+	RegisterUserzServer(s, NewUserzServiceServer(store))
+
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestUpdateMask(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	client := NewUserzClient(startServer(t))
+
+	added, err := client.Add(ctx, &AddRequest{
+		Data: &UserData{
+			FirstName: wrapperspb.String("John"),
+			LastName:  wrapperspb.String("Doe"),
+			NickName:  "jdoe",
+			Email:     "jdoe@example.com",
+			Password:  "passw0rd",
+			Country:   wrapperspb.String("IT"),
+		},
+	})
+	require.NoError(err)
+	id := added.User.Id
+	require.NotNil(added.User.CreatedAt)
+	assert.WithinDuration(time.Now(), added.User.CreatedAt.AsTime(), time.Second)
+	assert.Nil(added.User.UpdatedAt)
+
+	// without a mask, absent fields are left untouched
+	updated, err := client.Update(ctx, &UpdateRequest{
+		Id:   id,
+		Data: &UserData{FirstName: wrapperspb.String("Jane")},
+	})
+	require.NoError(err)
+	assert.Equal("Jane", updated.User.FirstName.GetValue())
+	assert.Equal("Doe", updated.User.LastName.GetValue())
+	assert.Equal("IT", updated.User.Country.GetValue())
+	require.NotNil(updated.User.UpdatedAt)
+
+	// with a mask, only the fields in it are considered
+	updated, err = client.Update(ctx, &UpdateRequest{
+		Id: id,
+		Data: &UserData{
+			FirstName: wrapperspb.String("ignored"),
+			Email:     "jane@example.com",
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email", "country"}},
+	})
+	require.NoError(err)
+	assert.Equal("Jane", updated.User.FirstName.GetValue())
+	assert.Equal("Doe", updated.User.LastName.GetValue())
+	assert.Equal("jane@example.com", updated.User.Email)
+	assert.Nil(updated.User.Country)
+
+	_, err = client.Update(ctx, &UpdateRequest{
+		Id:         id,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+	})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, &UpdateRequest{
+		Id:         id,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"created_at"}},
+	})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestAlongsideV1(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	conn := startServer(t)
+	v1 := proto.NewUserzClient(conn)
+	v2 := NewUserzClient(conn)
+
+	added, err := v1.Add(ctx, &proto.AddRequest{
+		Data: &proto.UserData{
+			NickName: "jdoe",
+			Email:    "jdoe@example.com",
+			Password: "passw0rd",
+		},
+	})
+	require.NoError(err)
+
+	page, err := v2.Page(ctx, &PageRequest{PageSize: 10})
+	require.NoError(err)
+	require.Len(page.Users, 1)
+	assert.Equal(added.Id, page.Users[0].Id)
+	assert.Equal("jdoe", page.Users[0].NickName)
+	assert.Nil(page.Users[0].FirstName)
+	assert.Equal(uint64(1), page.Pagination.TotalElements)
+	assert.Equal(uint64(1), page.Pagination.TotalPages)
+	assert.Equal(uint64(0), page.Pagination.PageIndex)
+}
@@ -0,0 +1,330 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+const (
+	defaultHeartbeat    = 30 * time.Second
+	snapshotPageSize    = 100
+	defaultWatchTimeout = 30 * time.Second
+)
+
+// Watch streams the changes to the users matching the filter, and visible
+// to the caller, being authorized as a List. Creations and updates carry the
+// current state of the user, and are sent only if it matches the filter.
+// Removals carry only the id, and are sent as well when a user stops
+// matching the filter, for the consumers to keep an accurate view of the
+// matching users. On the streams starting with a snapshot they are sent only
+// for the users already sent on the same stream; on the others, resumed or
+// not, for the users whose state before the change, as carried by the event,
+// was visible to the caller and matched the filter (or, without it, for the
+// users visible to the caller at all). The users imported in bulk are not
+// sent: a resync event tells their number instead, whether matching the
+// filter or not.
+//
+// The users in the events are matched against the filter in memory, if the
+// store can tell which users are visible to the caller (see userz.Scoper),
+// and looked up in the store otherwise.
+//
+// Consumers not keeping up with the changes are disconnected with
+// ResourceExhausted, and may resume from the sequence number of the last
+// event they received, as long as it is still in the history. The sequence
+// numbers are valid only along with their epoch, and only on the instance
+// that sent them: resuming elsewhere, or after a restart, fails with
+// FailedPrecondition, for the consumer to start anew with a snapshot.
+func (s *Service) Watch(req *WatchRequest, server Userz_WatchServer) error {
+	ctx := server.Context()
+	logger, err := RequestLogger(ctx, "gRPC", "Watch", req)
+	if err != nil {
+		return err
+	}
+
+	if s.events == nil {
+		return status.Errorf(codes.Unimplemented, "userz: notifications are disabled")
+	}
+
+	filter, err := userz.ParseFilter(req.Filter)
+	if err != nil {
+		logger.Err(err).Msg("Failed to parse filter")
+		return status.Errorf(codes.InvalidArgument, "userz: malformed filter")
+	}
+
+	// the stream is authorized as a List, which fetches nothing yet
+	if _, err := s.store.List(ctx, filter, snapshotPageSize); err != nil {
+		logger.Err(err).Msg("Error with the store")
+		return StoreError(err)
+	}
+
+	// subscribe before the snapshot, so that no change gets lost in between
+	var sub *notifier.Subscription
+	var seq uint64
+	if req.AfterSeq != nil {
+		seq = *req.AfterSeq
+		if req.Epoch != s.events.Epoch() {
+			return status.Errorf(codes.FailedPrecondition, "userz: cannot resume the events of another epoch")
+		}
+
+		sub, err = s.events.Resume(seq)
+		if errors.Is(err, notifier.ErrHistoryExpired) {
+			return status.Errorf(codes.OutOfRange, "userz: cannot resume after %d", seq)
+		}
+		if err != nil {
+			logger.Err(err).Msg("Failed to subscribe")
+			return ErrInternal
+		}
+	} else {
+		sub, seq = s.events.Subscribe()
+	}
+	defer sub.Close()
+
+	w := &watcher{
+		store:  s.store,
+		filter: filter,
+		epoch:  s.events.Epoch(),
+		server: server,
+		seen:   make(map[string]struct{}),
+	}
+
+	if scoper, ok := s.store.(userz.Scoper); ok {
+		w.scope, err = scoper.Scope(ctx, filter)
+		if err != nil && !errors.Is(err, userz.ErrScopeUnsupported) {
+			logger.Err(err).Msg("Error with the store")
+			return StoreError(err)
+		}
+		w.scoped = err == nil
+	}
+
+	if req.Snapshot {
+		w.snapshotted = true
+		if err := w.snapshot(ctx, seq); err != nil {
+			logger.Err(err).Msg("Failed to send the snapshot")
+			return err
+		}
+	}
+
+	heartbeat := defaultHeartbeat
+	if req.HeartbeatSeconds > 0 {
+		heartbeat = time.Duration(req.HeartbeatSeconds) * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug().Err(ctx.Err()).Msg("Watch ended by the client")
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+			if err := server.Send(&UserEvent{Seq: seq, Epoch: w.epoch, Type: EventType_EVENT_TYPE_HEARTBEAT}); err != nil {
+				logger.Debug().Err(err).Msg("Error sending the heartbeat")
+				return err
+			}
+		case ev, ok := <-sub.C():
+			if !ok {
+				if errors.Is(sub.Err(), notifier.ErrSlowConsumer) {
+					logger.Warn().Uint64("seq", seq).Msg("Watch consumer too slow")
+					return status.Errorf(codes.ResourceExhausted, "userz: consumer too slow, resume after %d", seq)
+				}
+				if errors.Is(sub.Err(), notifier.ErrClosed) {
+					logger.Debug().Uint64("seq", seq).Msg("Watch ended by the shutdown")
+					return status.Errorf(codes.Unavailable, "userz: shutting down, resume after %d", seq)
+				}
+				return nil
+			}
+
+			if err := w.send(ctx, ev); err != nil {
+				logger.Err(err).Uint64("seq", ev.Seq).Msg("Error sending the event")
+				return err
+			}
+			seq = ev.Seq
+		}
+	}
+}
+
+type watcher struct {
+	store  userz.Store
+	filter *userz.Filter
+	// scope is the filter restricted to the users visible to the caller, to
+	// match the users in the events against, if scoped.
+	scope  *userz.Filter
+	scoped bool
+	epoch  string
+	server Userz_WatchServer
+	// seen holds the ids of the users sent on the stream, whose removals are
+	// relevant (and visible) to the consumer: the only ones, if snapshotted.
+	seen        map[string]struct{}
+	snapshotted bool
+}
+
+func (w *watcher) snapshot(ctx context.Context, seq uint64) error {
+	iterator, err := w.store.List(ctx, w.filter, snapshotPageSize)
+	if err != nil {
+		return StoreError(err)
+	}
+
+	for {
+		users, err := iterator.Next(ctx)
+		if errors.Is(err, userz.ErrNoMorePages) {
+			return nil
+		}
+		if err != nil {
+			return StoreError(err)
+		}
+
+		for _, user := range users {
+			if err := w.sendUser(seq, EventType_EVENT_TYPE_SNAPSHOT, user); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *watcher) send(ctx context.Context, ev *notifier.Event) error {
+	if ev.Event == notifier.NotifyAccountsImported {
+		// the users imported are too many to be looked up one by one
+		count, _ := strconv.ParseUint(ev.Metadata["count"], 10, 64)
+
+		return w.server.Send(&UserEvent{
+			Seq:   ev.Seq,
+			Epoch: w.epoch,
+			Type:  EventType_EVENT_TYPE_RESYNC,
+			Count: count,
+		})
+	}
+
+	id := ev.Metadata["id"]
+	if id == "" {
+		return nil
+	}
+
+	if ev.Event == notifier.NotifyAccountRemoved {
+		return w.sendRemoved(ev.Seq, id, ev.Metadata)
+	}
+
+	user, err := w.current(ctx, id, ev.Metadata)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		// either removed in the meanwhile, not matching the filter or not
+		// visible anymore: the consumer has to drop it, if it was visible
+		return w.sendRemoved(ev.Seq, id, ev.Metadata)
+	}
+
+	eventType := EventType_EVENT_TYPE_UPDATED
+	if ev.Event == notifier.NotifyAccountCreated {
+		eventType = EventType_EVENT_TYPE_CREATED
+	}
+
+	return w.sendUser(ev.Seq, eventType, user)
+}
+
+func (w *watcher) sendUser(seq uint64, eventType EventType, user *userz.User) error {
+	w.seen[user.Id] = struct{}{}
+
+	return w.server.Send(&UserEvent{
+		Seq:   seq,
+		Epoch: w.epoch,
+		Type:  eventType,
+		Id:    user.Id,
+		User:  FromUser(user),
+	})
+}
+
+// sendRemoved sends the removal of the user, if already sent or, unless
+// snapshotted, if it was visible before the change.
+func (w *watcher) sendRemoved(seq uint64, id string, metadata map[string]string) error {
+	_, visible := w.seen[id]
+	if !visible && !w.snapshotted {
+		visible = w.wasVisible(id, metadata)
+	}
+	if !visible {
+		return nil
+	}
+	delete(w.seen, id)
+
+	return w.server.Send(&UserEvent{
+		Seq:   seq,
+		Epoch: w.epoch,
+		Type:  EventType_EVENT_TYPE_REMOVED,
+		Id:    id,
+	})
+}
+
+// current returns the state of the user in the event, if it matches the
+// filter and is visible to the caller: it is matched in memory, if the event
+// carries the user, and looked up in the store otherwise.
+func (w *watcher) current(ctx context.Context, id string, metadata map[string]string) (*userz.User, error) {
+	if user, ok := userz.UserFromMetadata(metadata, id, ""); ok && w.scoped {
+		matched, err := w.scope.Match(user)
+		if err == nil {
+			if !matched {
+				return nil, nil
+			}
+			return user, nil
+		}
+	}
+
+	return w.lookup(ctx, id)
+}
+
+// wasVisible tells whether the user was visible to the caller, and matched
+// the filter, before the change: the previous state in the event is matched,
+// if any, or else the user is taken as visible if the caller may see it at
+// all. Nothing is visible if the store cannot tell what the caller sees.
+func (w *watcher) wasVisible(id string, metadata map[string]string) bool {
+	if !w.scoped {
+		return false
+	}
+
+	if previous, ok := userz.UserFromMetadata(metadata, id, userz.MetadataPrevious); ok {
+		matched, err := w.scope.Match(previous)
+		if err == nil {
+			return matched
+		}
+	}
+
+	return w.scope == nil || w.scope.Id == "" || w.scope.Id == id
+}
+
+// lookup returns the current state of the user, if it matches the filter.
+func (w *watcher) lookup(ctx context.Context, id string) (*userz.User, error) {
+	filter := &userz.Filter{}
+	if w.filter != nil {
+		*filter = *w.filter
+	}
+	filter.Id = id
+
+	expiring, cancel := context.WithTimeout(ctx, defaultWatchTimeout)
+	defer cancel()
+
+	users, _, err := w.store.Page(expiring, filter, &userz.PageParams{
+		Size:  1,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	if errors.Is(err, userz.ErrForbidden) {
+		// the user is not visible to the caller
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	for _, user := range users {
+		if user.Id == id {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,414 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/pkg/notifier"
+	"github.com/leophys/userz/store/notifying"
+)
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	store.put(&userz.User{Id: "1", NickName: "one"})
+
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{Snapshot: true})
+	require.NoError(err)
+
+	ev, err := stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_SNAPSHOT, ev.Type)
+	assert.Equal("1", ev.Id)
+	assert.Equal("one", ev.User.NickName)
+
+	store.put(&userz.User{Id: "2", NickName: "two"})
+	events.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{"id": "2"})
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "1"})
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_CREATED, ev.Type)
+	assert.Equal(uint64(1), ev.Seq)
+	assert.Equal(events.Epoch(), ev.Epoch)
+	assert.Equal("two", ev.User.NickName)
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal(uint64(2), ev.Seq)
+	assert.Equal("1", ev.Id)
+	assert.Nil(ev.User)
+
+	// resume
+	after := uint64(1)
+	resumed, err := client.Watch(ctx, &WatchRequest{AfterSeq: &after, Epoch: events.Epoch(), HeartbeatSeconds: 1})
+	require.NoError(err)
+
+	ev, err = resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal(uint64(2), ev.Seq)
+
+	ev, err = resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_HEARTBEAT, ev.Type)
+	assert.Equal(uint64(2), ev.Seq)
+	assert.Equal(events.Epoch(), ev.Epoch)
+
+	// too far in the future
+	after = 10
+	expired, err := client.Watch(ctx, &WatchRequest{AfterSeq: &after, Epoch: events.Epoch()})
+	require.NoError(err)
+	_, err = expired.Recv()
+	assert.Equal(codes.OutOfRange, status.Code(err))
+
+	// the sequence numbers of another instance, or of a previous run
+	after = 1
+	for _, epoch := range []string{"", notifier.NewBroadcaster(10, 10).Epoch()} {
+		elsewhere, err := client.Watch(ctx, &WatchRequest{AfterSeq: &after, Epoch: epoch})
+		require.NoError(err)
+		_, err = elsewhere.Recv()
+		assert.Equal(codes.FailedPrecondition, status.Code(err))
+	}
+}
+
+func TestWatchResumedRemovals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{
+		"id": "1", "previous_nickname": "one", "previous_email": "a@b.c",
+	})
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{
+		"id": "2", "previous_nickname": "two", "previous_email": "x@y.z",
+	})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{
+		"id": "3", "nickname": "three", "email": "x@y.z", "previous_nickname": "three", "previous_email": "a@b.c",
+	})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{
+		"id": "4", "nickname": "four", "email": "x@y.z", "previous_nickname": "four", "previous_email": "x@y.z",
+	})
+
+	// the removals, and the users leaving the filter, are sent only if they
+	// matched the filter before the change
+	after := uint64(0)
+	resumed, err := client.Watch(ctx, &WatchRequest{
+		Filter:           map[string]string{"email": "= a@b.c"},
+		AfterSeq:         &after,
+		Epoch:            events.Epoch(),
+		HeartbeatSeconds: 1,
+	})
+	require.NoError(err)
+
+	ev, err := resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("1", ev.Id)
+	assert.Equal(uint64(1), ev.Seq)
+
+	ev, err = resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("3", ev.Id)
+	assert.Equal(uint64(3), ev.Seq)
+
+	ev, err = resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_HEARTBEAT, ev.Type)
+	assert.Equal(uint64(4), ev.Seq)
+}
+
+func TestWatchResumedRemovalsOwn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{own: "me"}
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	// the users not visible to the caller are never sent, whether their
+	// previous state is known or not
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "someone"})
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "another", "previous_nickname": "another"})
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "me"})
+
+	after := uint64(0)
+	resumed, err := client.Watch(ctx, &WatchRequest{AfterSeq: &after, Epoch: events.Epoch()})
+	require.NoError(err)
+
+	ev, err := resumed.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("me", ev.Id)
+	assert.Equal(uint64(3), ev.Seq)
+}
+
+func TestWatchMatched(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the store has none of the users in the events, which are sent as they
+	// are in the events
+	store := &mockStore{}
+	store.put(&userz.User{Id: "0", Email: "a@b.c"})
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{
+		Filter:   map[string]string{"email": "= a@b.c"},
+		Snapshot: true,
+	})
+	require.NoError(err)
+
+	// the snapshot makes sure the subscription is in place
+	ev, err := stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_SNAPSHOT, ev.Type)
+
+	events.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{"id": "1", "nickname": "one", "email": "a@b.c"})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "2", "nickname": "two", "email": "x@y.z"})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "1", "nickname": "one", "email": "x@y.z"})
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_CREATED, ev.Type)
+	assert.Equal("1", ev.Id)
+	assert.Equal("one", ev.User.NickName)
+	assert.Equal("a@b.c", ev.User.Email)
+
+	// 2 never matched, 1 does not match anymore
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("1", ev.Id)
+	assert.Equal(uint64(3), ev.Seq)
+}
+
+func TestWatchFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	store.put(&userz.User{Id: "0"})
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{
+		Filter:   map[string]string{"email": "= a@b.c"},
+		Snapshot: true,
+	})
+	require.NoError(err)
+
+	ev, err := stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_SNAPSHOT, ev.Type)
+	assert.Equal("0", ev.Id)
+
+	// the mock store matches nothing but the id, so only the users that
+	// exist in the store pass, and only the removals of users already sent
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "unknown"})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "missing"})
+	store.put(&userz.User{Id: "1"})
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "1"})
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "0"})
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_UPDATED, ev.Type)
+	assert.Equal("1", ev.Id)
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("0", ev.Id)
+}
+
+func TestWatchImported(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	store.put(&userz.User{Id: "0"})
+	events := notifier.NewBroadcaster(10, 10)
+	bulk := notifying.NewNotifyingStore(store, events).(userz.BulkAdder)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{Snapshot: true})
+	require.NoError(err)
+
+	ev, err := stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_SNAPSHOT, ev.Type)
+
+	added, err := bulk.AddBulk(ctx, []*userz.UserData{
+		{NickName: "one", Email: "one@example.com", Password: "passw0rd"},
+		{NickName: "two", Email: "two@example.com", Password: "passw0rd"},
+	})
+	require.NoError(err)
+	require.Equal(uint(2), added)
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_RESYNC, ev.Type)
+	assert.Equal(uint64(1), ev.Seq)
+	assert.Equal(uint64(2), ev.Count)
+	assert.Empty(ev.Id)
+	assert.Nil(ev.User)
+}
+
+func TestWatchForbidden(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{forbidden: true}
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{})
+	require.NoError(err)
+
+	_, err = stream.Recv()
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+}
+
+func TestWatchLeavingFilter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	store.put(&userz.User{Id: "0"})
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(store, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{
+		Filter:   map[string]string{"email": "= a@b.c"},
+		Snapshot: true,
+	})
+	require.NoError(err)
+
+	ev, err := stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_SNAPSHOT, ev.Type)
+
+	// 0 is updated and does not match anymore
+	store.drop("0")
+	events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "0"})
+	// already removed from the view
+	events.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "0"})
+	store.put(&userz.User{Id: "1"})
+	events.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{"id": "1"})
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_REMOVED, ev.Type)
+	assert.Equal("0", ev.Id)
+	assert.Equal(uint64(1), ev.Seq)
+
+	ev, err = stream.Recv()
+	require.NoError(err)
+	assert.Equal(EventType_EVENT_TYPE_CREATED, ev.Type)
+	assert.Equal("1", ev.Id)
+}
+
+func TestWatchSlowConsumer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &mockStore{}
+	store.put(&userz.User{Id: "1"})
+	events := notifier.NewBroadcaster(10, 1)
+	service := NewUserzServiceServer(store, WithEvents(events))
+	client := startServer(t, service)
+
+	// every lookup is slow, so the subscription overflows
+	store.delay = 10 * time.Millisecond
+
+	stream, err := client.Watch(ctx, &WatchRequest{Snapshot: true})
+	require.NoError(err)
+
+	// the snapshot makes sure the subscription is in place
+	_, err = stream.Recv()
+	require.NoError(err)
+
+	for i := 0; i < 100; i++ {
+		events.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{"id": "missing"})
+	}
+
+	_, err = stream.Recv()
+	assert.Equal(codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.Watch(ctx, &WatchRequest{})
+	require.NoError(err)
+
+	disabled := startServer(t, NewUserzServiceServer(store))
+	stream, err = disabled.Watch(ctx, &WatchRequest{})
+	require.NoError(err)
+	_, err = stream.Recv()
+	assert.Equal(codes.Unimplemented, status.Code(err))
+}
+
+func TestWatchShutdown(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	events := notifier.NewBroadcaster(10, 10)
+	client := startServer(t, NewUserzServiceServer(&mockStore{}, WithEvents(events)))
+
+	stream, err := client.Watch(ctx, &WatchRequest{HeartbeatSeconds: 1})
+	require.NoError(err)
+
+	// the heartbeat makes sure the subscription is in place
+	_, err = stream.Recv()
+	require.NoError(err)
+
+	events.Close()
+
+	_, err = stream.Recv()
+	assert.Equal(codes.Unavailable, status.Code(err))
+}
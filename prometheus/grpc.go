@@ -0,0 +1,52 @@
+package prometheus
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/leophys/userz/internal/grpcutils"
+)
+
+var grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: subsystem,
+	Name:      "grpc_request_duration_seconds",
+}, []string{"method", "code", "identity"})
+
+func init() {
+	prometheus.MustRegister(grpcDuration)
+}
+
+// UnaryServerInterceptor records the duration of the gRPC requests, by
+// method, status code and authenticated identity of the client.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+		observeGRPC(ctx, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the same as UnaryServerInterceptor, for streams.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+		observeGRPC(ss.Context(), info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func observeGRPC(ctx context.Context, method string, start time.Time, err error) {
+	grpcDuration.
+		WithLabelValues(method, status.Code(err).String(), grpcutils.Identity(ctx)).
+		Observe(time.Since(start).Seconds())
+}
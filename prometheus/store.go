@@ -2,6 +2,7 @@ package prometheus
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -50,6 +51,75 @@ func (s *MetricsStore) Add(ctx context.Context, user *userz.UserData) (*userz.Us
 	return res, err
 }
 
+// AddBulk forwards to the wrapped store, if able to add in bulk.
+func (s *MetricsStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	adder, ok := s.wrapped.(userz.BulkAdder)
+	if !ok {
+		return 0, userz.ErrBulkUnsupported
+	}
+
+	label := "AddBulk"
+	start := time.Now()
+
+	res, err := adder.AddBulk(ctx, users)
+	if err != nil {
+		storeFailures.WithLabelValues(label).Inc()
+	}
+	storeDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
+// Taken forwards to the wrapped store, if able to tell the nicknames and
+// emails taken.
+func (s *MetricsStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	checker, ok := s.wrapped.(userz.TakenChecker)
+	if !ok {
+		return nil, nil, userz.ErrTakenUnsupported
+	}
+
+	label := "Taken"
+	start := time.Now()
+
+	takenNicknames, takenEmails, err := checker.Taken(ctx, nicknames, emails)
+	if err != nil {
+		storeFailures.WithLabelValues(label).Inc()
+	}
+	storeDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+
+	return takenNicknames, takenEmails, err
+}
+
+// Scope forwards to the wrapped store, if able to tell the users visible to
+// the caller. It is not measured, as it does not reach the backend.
+func (s *MetricsStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	scoper, ok := s.wrapped.(userz.Scoper)
+	if !ok {
+		return nil, userz.ErrScopeUnsupported
+	}
+
+	return scoper.Scope(ctx, filter)
+}
+
+// Verify forwards to the wrapped store, if able to verify the credentials.
+func (s *MetricsStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	verifier, ok := s.wrapped.(userz.Verifier)
+	if !ok {
+		return nil, userz.ErrVerifyUnsupported
+	}
+
+	label := "Verify"
+	start := time.Now()
+
+	res, err := verifier.Verify(ctx, login, password)
+	if err != nil && !errors.Is(err, userz.ErrInvalidCredentials) {
+		storeFailures.WithLabelValues(label).Inc()
+	}
+	storeDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
 func (s *MetricsStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
 	label := "Update"
 	start := time.Now()
@@ -88,17 +158,17 @@ func (s *MetricsStore) List(ctx context.Context, filter *userz.Filter, pageSize
 	return &MetricsIterator{iterator}, nil
 }
 
-func (s *MetricsStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, error) {
+func (s *MetricsStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
 	label := "Page"
 	start := time.Now()
 
-	res, err := s.wrapped.Page(ctx, filter, params)
+	res, data, err := s.wrapped.Page(ctx, filter, params)
 	if err != nil {
 		storeFailures.WithLabelValues(label).Inc()
 	}
 	storeDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
 
-	return res, err
+	return res, data, err
 }
 
 type MetricsIterator struct {
@@ -109,6 +179,16 @@ func (it *MetricsIterator) Len() userz.PaginationData {
 	return it.wrapped.Len()
 }
 
+// SeekAfter forwards to the wrapped iterator, if able to seek.
+func (it *MetricsIterator) SeekAfter(createdAt time.Time, id string) error {
+	seeker, ok := it.wrapped.(userz.Seeker)
+	if !ok {
+		return userz.ErrSeekUnsupported
+	}
+
+	return seeker.SeekAfter(createdAt, id)
+}
+
 func (it *MetricsIterator) Next(ctx context.Context) ([]*userz.User, error) {
 	label := "ListNext"
 	start := time.Now()
@@ -11,8 +11,52 @@ type Store interface {
 	Add(ctx context.Context, user *UserData) (*User, error)
 	Update(ctx context.Context, id string, user *UserData) (*User, error)
 	Remove(ctx context.Context, id string) (*User, error)
+	// List iterates over the users matching the filter, by creation time
+	// and then by id.
 	List(ctx context.Context, filter *Filter, pageSize uint) (Iterator[[]*User], error)
-	Page(ctx context.Context, filter *Filter, params *PageParams) ([]*User, error)
+	// Page returns a page of the users matching the filter, along with the
+	// pagination data of all of them.
+	Page(ctx context.Context, filter *Filter, params *PageParams) ([]*User, PaginationData, error)
+}
+
+// BulkAdder is optionally implemented by the stores able to add many users
+// at once, more efficiently than one Add at a time.
+type BulkAdder interface {
+	// AddBulk adds either all the users or none of them, returning how many
+	// were added. It returns ErrConflict if any of them clashes with an
+	// existing user, and ErrBulkUnsupported if the store cannot add in bulk
+	// after all.
+	AddBulk(ctx context.Context, users []*UserData) (uint, error)
+}
+
+// TakenChecker is optionally implemented by the stores able to tell which
+// nicknames and emails are already taken, to check many users at once before
+// adding them.
+type TakenChecker interface {
+	// Taken returns those of the given nicknames and emails belonging to
+	// existing users. It returns ErrTakenUnsupported if the store cannot
+	// tell after all.
+	Taken(ctx context.Context, nicknames, emails []string) (takenNicknames, takenEmails []string, err error)
+}
+
+// Scoper is optionally implemented by the stores able to tell which users
+// List and Page return to the caller, for the users to be matched in memory
+// (see Filter.Match) instead of being queried anew.
+type Scoper interface {
+	// Scope returns the filter restricted to the users visible to the
+	// caller, as List and Page would restrict it, or ErrForbidden. It
+	// returns ErrScopeUnsupported if the store cannot tell after all.
+	Scope(ctx context.Context, filter *Filter) (*Filter, error)
+}
+
+// Verifier is optionally implemented by the stores able to check the
+// credentials of the users.
+type Verifier interface {
+	// Verify returns the user whose nickname or email is login, if password
+	// is theirs, and ErrInvalidCredentials otherwise. A password hashed in a
+	// legacy format is hashed anew on success. It returns
+	// ErrVerifyUnsupported if the store cannot verify after all.
+	Verify(ctx context.Context, login, password string) (*User, error)
 }
 
 // UserData represents the data needed to create or alter a user.
@@ -23,6 +67,52 @@ type UserData struct {
 	Password  string `json:"password,omitempty"`
 	Email     string `json:"email,omitempty"`
 	Country   string `json:"country,omitempty"`
+	// PasswordHash is the password already hashed in one of the recognised
+	// formats (see ParsePasswordHash), taken over from a legacy system. It
+	// is used in place of Password.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Clear lists the optional fields that Update has to empty. They
+	// take precedence over the values above.
+	Clear []Field `json:"-"`
+}
+
+// SetsPassword tells whether the data sets the password, either in
+// plaintext or already hashed.
+func (d *UserData) SetsPassword() bool {
+	return d.Password != "" || d.PasswordHash != ""
+}
+
+// NewPassword returns the password to store: the hash given, if any, or the
+// plaintext hashed with hasher.
+func (d *UserData) NewPassword(hasher Passworder) (Password, error) {
+	if d.PasswordHash != "" {
+		return ParsePasswordHash(d.PasswordHash)
+	}
+
+	return hasher(d.Password)
+}
+
+// Field identifies an optional field of a user, by its JSON name.
+type Field string
+
+const (
+	FieldFirstName Field = "first_name"
+	FieldLastName  Field = "last_name"
+	FieldCountry   Field = "country"
+)
+
+// OptionalFields are the fields that can be cleared.
+var OptionalFields = []Field{FieldFirstName, FieldLastName, FieldCountry}
+
+// Clears tells whether the given field has to be emptied on update.
+func (d *UserData) Clears(field Field) bool {
+	for _, f := range d.Clear {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
 }
 
 // PageParams conveys the information needed to specify a page for the Page
@@ -67,6 +157,16 @@ type Iterator[T any] interface {
 	Next(ctx context.Context) (T, error)
 }
 
+// Seeker is optionally implemented by the iterators of List able to skip
+// users without fetching them, to resume an iteration.
+type Seeker interface {
+	// SeekAfter moves the iterator after the user with the given creation
+	// time and id, whether still existing or not, as in User.After. It has
+	// to be called before Next. It returns ErrSeekUnsupported if the
+	// iterator cannot seek after all.
+	SeekAfter(createdAt time.Time, id string) error
+}
+
 // PaginationData regards the global information pertaining the pagination.
 type PaginationData struct {
 	TotalElements uint
@@ -74,4 +174,43 @@ type PaginationData struct {
 	PageSize      uint
 }
 
-var ErrNoMorePages = errors.New("the iterator has been consumed")
+// NewPaginationData returns the pagination data of totalElements, split in
+// pages of pageSize.
+func NewPaginationData(totalElements, pageSize uint) PaginationData {
+	var totalPages uint
+	if pageSize > 0 {
+		totalPages = (totalElements + pageSize - 1) / pageSize
+	}
+
+	return PaginationData{
+		TotalElements: totalElements,
+		TotalPages:    totalPages,
+		PageSize:      pageSize,
+	}
+}
+
+var (
+	ErrNoMorePages       = errors.New("the iterator has been consumed")
+	ErrSeekUnsupported   = errors.New("the iterator cannot seek")
+	ErrBulkUnsupported   = errors.New("the store cannot add users in bulk")
+	ErrVerifyUnsupported = errors.New("the store cannot verify credentials")
+	ErrTakenUnsupported  = errors.New("the store cannot tell the nicknames and emails taken")
+	ErrScopeUnsupported  = errors.New("the store cannot tell the users visible to the caller")
+	// ErrMatchUnsupported is returned by Filter.Match for the conditions
+	// not implementing Matcher.
+	ErrMatchUnsupported = errors.New("the filter cannot be matched in memory")
+	// ErrConflict is returned by the stores refusing a user with the same
+	// nickname or email of another one.
+	ErrConflict = errors.New("a user with the same nickname or email already exists")
+	// ErrNotFound is returned by the stores for an unknown user id.
+	ErrNotFound = errors.New("no user found")
+	// ErrInvalidId is returned by the stores for a user id not in their
+	// format.
+	ErrInvalidId = errors.New("invalid user id")
+	// ErrInvalidCredentials is returned by Verify for an unknown login or
+	// a wrong password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrForbidden is returned by the stores refusing an operation to the
+	// caller.
+	ErrForbidden = errors.New("the operation is not allowed")
+)
@@ -0,0 +1,90 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/leophys/userz"
+)
+
+var (
+	_ userz.Store        = &HashlessStore{}
+	_ userz.BulkAdder    = &HashlessStore{}
+	_ userz.TakenChecker = &HashlessStore{}
+	_ userz.Verifier     = &HashlessStore{}
+	_ userz.Scoper       = &HashlessStore{}
+)
+
+// HashlessStore refuses to set the password hashes, which are for the
+// administrators only, when there is no policy to tell who they are.
+type HashlessStore struct {
+	userz.Store
+}
+
+func NewHashlessStore(wrapped userz.Store) userz.Store {
+	return &HashlessStore{Store: wrapped}
+}
+
+func (s *HashlessStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
+	if user.PasswordHash != "" {
+		return nil, deny(ctx, nil, OpAdd, "password_hash not allowed")
+	}
+
+	return s.Store.Add(ctx, user)
+}
+
+// AddBulk forwards to the wrapped store, if able to add in bulk, provided
+// that no user comes with a password hash.
+func (s *HashlessStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	adder, ok := s.Store.(userz.BulkAdder)
+	if !ok {
+		return 0, userz.ErrBulkUnsupported
+	}
+
+	for _, user := range users {
+		if user.PasswordHash != "" {
+			return 0, deny(ctx, nil, OpAdd, "password_hash not allowed")
+		}
+	}
+
+	return adder.AddBulk(ctx, users)
+}
+
+// Taken forwards to the wrapped store, if able to tell the nicknames and
+// emails taken.
+func (s *HashlessStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	checker, ok := s.Store.(userz.TakenChecker)
+	if !ok {
+		return nil, nil, userz.ErrTakenUnsupported
+	}
+
+	return checker.Taken(ctx, nicknames, emails)
+}
+
+// Scope forwards to the wrapped store, if able to tell the users visible to
+// the caller.
+func (s *HashlessStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	scoper, ok := s.Store.(userz.Scoper)
+	if !ok {
+		return nil, userz.ErrScopeUnsupported
+	}
+
+	return scoper.Scope(ctx, filter)
+}
+
+// Verify forwards to the wrapped store, if able to verify the credentials.
+func (s *HashlessStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	verifier, ok := s.Store.(userz.Verifier)
+	if !ok {
+		return nil, userz.ErrVerifyUnsupported
+	}
+
+	return verifier.Verify(ctx, login, password)
+}
+
+func (s *HashlessStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	if user != nil && user.PasswordHash != "" {
+		return nil, deny(ctx, nil, OpUpdate, "password_hash not allowed")
+	}
+
+	return s.Store.Update(ctx, id, user)
+}
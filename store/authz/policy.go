@@ -0,0 +1,165 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/leophys/userz"
+)
+
+// The operations of the store.
+const (
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpRemove = "remove"
+	OpList   = "list"
+	OpPage   = "page"
+	OpVerify = "verify"
+	// OpAll stands for every operation.
+	OpAll = "*"
+)
+
+// The fields of the users that can be written, by their JSON name.
+var writableFields = []string{"first_name", "last_name", "nickname", "email", "password", "password_hash", "country"}
+
+// Rule is what a role is allowed to do.
+type Rule struct {
+	// Operations are the allowed operations.
+	Operations []string `json:"operations"`
+	// Own restricts the operations to the user whose id is the one of the
+	// principal: update, remove and verify only that user, while list and
+	// page see only that one.
+	Own bool `json:"own,omitempty"`
+	// Fields are the fields that can be set by add and update, all of them
+	// but password_hash if empty. A password_hash is for the administrators
+	// to set, so it has to be listed explicitly.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Policy maps the roles of the principals to their rules.
+type Policy struct {
+	Roles map[string]Rule `json:"roles"`
+}
+
+// LoadPolicy reads a policy from a JSON file, e.g.
+//
+//	{
+//	    "roles": {
+//	        "admin": {"operations": ["*"]},
+//	        "reader": {"operations": ["list", "page"]},
+//	        "self": {"operations": ["update", "page"], "own": true, "fields": ["email", "password"]}
+//	    }
+//	}
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("malformed policy in %s: %w", path, err)
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+func (p *Policy) validate() error {
+	for role, rule := range p.Roles {
+		for _, op := range rule.Operations {
+			switch op {
+			case OpAdd, OpUpdate, OpRemove, OpList, OpPage, OpVerify, OpAll:
+			default:
+				return fmt.Errorf("unknown operation %q for role %q", op, role)
+			}
+		}
+
+		for _, field := range rule.Fields {
+			if !contains(writableFields, field) {
+				return fmt.Errorf("unknown field %q for role %q", field, role)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rules returns the rules of the roles that allow the operation.
+func (p *Policy) rules(roles []string, op string) []Rule {
+	var rules []Rule
+
+	for _, role := range roles {
+		rule, ok := p.Roles[role]
+		if !ok {
+			continue
+		}
+
+		if contains(rule.Operations, op) || contains(rule.Operations, OpAll) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// allows tells whether the rule allows to write the fields of data.
+func (r *Rule) allows(data *userz.UserData) bool {
+	for _, field := range setFields(data) {
+		if len(r.Fields) == 0 && field != "password_hash" {
+			continue
+		}
+
+		if !contains(r.Fields, field) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setFields returns the fields set, or cleared, by data.
+func setFields(data *userz.UserData) []string {
+	if data == nil {
+		return nil
+	}
+
+	values := map[string]string{
+		"first_name":    data.FirstName,
+		"last_name":     data.LastName,
+		"nickname":      data.NickName,
+		"email":         data.Email,
+		"password":      data.Password,
+		"password_hash": data.PasswordHash,
+		"country":       data.Country,
+	}
+
+	var fields []string
+	for _, field := range writableFields {
+		if values[field] != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	for _, field := range data.Clear {
+		if !contains(fields, string(field)) {
+			fields = append(fields, string(field))
+		}
+	}
+
+	return fields
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
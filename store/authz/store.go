@@ -0,0 +1,301 @@
+// Package authz enforces a role-based policy in front of a store.
+package authz
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/auth"
+)
+
+var (
+	_ userz.Store        = &AuthzStore{}
+	_ userz.BulkAdder    = &AuthzStore{}
+	_ userz.Verifier     = &AuthzStore{}
+	_ userz.TakenChecker = &AuthzStore{}
+	_ userz.Scoper       = &AuthzStore{}
+)
+
+// AuthzStore allows the operations to the principal in the context (see
+// the auth package) according to the policy, failing with
+// userz.ErrForbidden otherwise.
+type AuthzStore struct {
+	wrapped userz.Store
+	policy  *Policy
+}
+
+func NewAuthzStore(wrapped userz.Store, policy *Policy) userz.Store {
+	return &AuthzStore{
+		wrapped: wrapped,
+		policy:  policy,
+	}
+}
+
+func (s *AuthzStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
+	principal, rules, err := s.authorize(ctx, OpAdd)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.allows(user) {
+			return s.wrapped.Add(ctx, user)
+		}
+	}
+
+	return nil, deny(ctx, principal, OpAdd, "fields not writable")
+}
+
+// AddBulk forwards to the wrapped store, if able to add in bulk, provided
+// that every user could be added on its own.
+func (s *AuthzStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	adder, ok := s.wrapped.(userz.BulkAdder)
+	if !ok {
+		return 0, userz.ErrBulkUnsupported
+	}
+
+	principal, rules, err := s.authorize(ctx, OpAdd)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		allowed := false
+		for _, rule := range rules {
+			if rule.allows(user) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return 0, deny(ctx, principal, OpAdd, "fields not writable")
+		}
+	}
+
+	return adder.AddBulk(ctx, users)
+}
+
+// Taken forwards to the wrapped store, if able to tell the nicknames and
+// emails taken, to the principals allowed to add users.
+func (s *AuthzStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	checker, ok := s.wrapped.(userz.TakenChecker)
+	if !ok {
+		return nil, nil, userz.ErrTakenUnsupported
+	}
+
+	if _, _, err := s.authorize(ctx, OpAdd); err != nil {
+		return nil, nil, err
+	}
+
+	return checker.Taken(ctx, nicknames, emails)
+}
+
+// Verify forwards to the wrapped store, if able to verify the credentials.
+// The rules restricted to the own user verify only the credentials of the
+// principal: the login is checked to be the one of the principal before the
+// password, which is not even compared otherwise.
+func (s *AuthzStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	verifier, ok := s.wrapped.(userz.Verifier)
+	if !ok {
+		return nil, userz.ErrVerifyUnsupported
+	}
+
+	principal, rules, err := s.authorize(ctx, OpVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if onlyOwn(rules) {
+		owned, err := s.ownsLogin(ctx, principal, login)
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, deny(ctx, principal, OpVerify, "not the owner")
+		}
+	}
+
+	user, err := verifier.Verify(ctx, login, password)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if !rule.Own || user.Id == principal.ID {
+			return user, nil
+		}
+	}
+
+	return nil, deny(ctx, principal, OpVerify, "not the owner")
+}
+
+func (s *AuthzStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	principal, rules, err := s.authorize(ctx, OpUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := "not the owner"
+	for _, rule := range rules {
+		if rule.Own && id != principal.ID {
+			continue
+		}
+
+		if !rule.allows(user) {
+			reason = "fields not writable"
+			continue
+		}
+
+		return s.wrapped.Update(ctx, id, user)
+	}
+
+	return nil, deny(ctx, principal, OpUpdate, reason)
+}
+
+func (s *AuthzStore) Remove(ctx context.Context, id string) (*userz.User, error) {
+	principal, rules, err := s.authorize(ctx, OpRemove)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if !rule.Own || id == principal.ID {
+			return s.wrapped.Remove(ctx, id)
+		}
+	}
+
+	return nil, deny(ctx, principal, OpRemove, "not the owner")
+}
+
+func (s *AuthzStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	principal, rules, err := s.authorize(ctx, OpList)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, ok := restrict(principal, rules, filter)
+	if !ok {
+		return nil, deny(ctx, principal, OpList, "not the owner")
+	}
+
+	return s.wrapped.List(ctx, filter, pageSize)
+}
+
+func (s *AuthzStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
+	principal, rules, err := s.authorize(ctx, OpPage)
+	if err != nil {
+		return nil, userz.PaginationData{}, err
+	}
+
+	filter, ok := restrict(principal, rules, filter)
+	if !ok {
+		return nil, userz.PaginationData{}, deny(ctx, principal, OpPage, "not the owner")
+	}
+
+	return s.wrapped.Page(ctx, filter, params)
+}
+
+// Scope forwards to the wrapped store, if able to tell the users visible to
+// the caller, the filter being restricted as by List.
+func (s *AuthzStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	scoper, ok := s.wrapped.(userz.Scoper)
+	if !ok {
+		return nil, userz.ErrScopeUnsupported
+	}
+
+	principal, rules, err := s.authorize(ctx, OpList)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, ok = restrict(principal, rules, filter)
+	if !ok {
+		return nil, deny(ctx, principal, OpList, "not the owner")
+	}
+
+	return scoper.Scope(ctx, filter)
+}
+
+// ownsLogin tells whether the login is the nickname or the email of the
+// principal.
+func (s *AuthzStore) ownsLogin(ctx context.Context, principal *auth.Principal, login string) (bool, error) {
+	users, _, err := s.wrapped.Page(ctx, &userz.Filter{Id: principal.ID}, &userz.PageParams{
+		Size:  1,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, user := range users {
+		if user.Id == principal.ID && (user.NickName == login || user.Email == login) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// onlyOwn tells whether all the rules are restricted to the own user.
+func onlyOwn(rules []Rule) bool {
+	for _, rule := range rules {
+		if !rule.Own {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorize returns the principal and its rules allowing the operation.
+func (s *AuthzStore) authorize(ctx context.Context, op string) (*auth.Principal, []Rule, error) {
+	principal := auth.PrincipalFrom(ctx)
+	if principal == nil {
+		return nil, nil, deny(ctx, nil, op, "not authenticated")
+	}
+
+	rules := s.policy.rules(principal.Roles, op)
+	if len(rules) == 0 {
+		return nil, nil, deny(ctx, principal, op, "operation not allowed")
+	}
+
+	return principal, rules, nil
+}
+
+// restrict returns the filter limited to the user of the principal, unless
+// a rule allows to see everyone. It fails if the filter asks explicitly for
+// another user.
+func restrict(principal *auth.Principal, rules []Rule, filter *userz.Filter) (*userz.Filter, bool) {
+	for _, rule := range rules {
+		if !rule.Own {
+			return filter, true
+		}
+	}
+
+	var restricted userz.Filter
+	if filter != nil {
+		restricted = *filter
+	}
+
+	if restricted.Id != "" && restricted.Id != principal.ID {
+		return nil, false
+	}
+	restricted.Id = principal.ID
+
+	return &restricted, true
+}
+
+func deny(ctx context.Context, principal *auth.Principal, op, reason string) error {
+	event := zerolog.Ctx(ctx).Warn().
+		Str("operation", op).
+		Str("reason", reason)
+	if principal != nil {
+		event = event.Str("principal", principal.ID).Strs("roles", principal.Roles)
+	}
+	event.Msg("Operation denied")
+
+	return userz.ErrForbidden
+}
@@ -0,0 +1,365 @@
+package authz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz"
+	"github.com/leophys/userz/internal/auth"
+	"github.com/leophys/userz/store/memory"
+)
+
+const testPolicy = `{
+    "roles": {
+        "admin": {"operations": ["*"]},
+        "reader": {"operations": ["list", "page"]},
+        "onboarder": {"operations": ["add"], "fields": ["nickname", "email", "password"]},
+        "migrator": {"operations": ["add", "update"], "fields": ["nickname", "email", "password_hash"]},
+        "self": {"operations": ["update", "page", "verify"], "own": true, "fields": ["email", "password"]},
+        "watcher": {"operations": ["list"], "own": true}
+    }
+}`
+
+var (
+	_ userz.Store     = &recordingStore{}
+	_ userz.BulkAdder = &recordingStore{}
+	_ userz.Verifier  = &recordingStore{}
+	_ userz.Scoper    = &recordingStore{}
+)
+
+// recordingStore records the calls reaching it.
+type recordingStore struct {
+	calls  []string
+	filter *userz.Filter
+}
+
+func (s *recordingStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
+	s.calls = append(s.calls, OpAdd)
+	return &userz.User{Id: "new"}, nil
+}
+
+func (s *recordingStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	s.calls = append(s.calls, OpAdd)
+	return uint(len(users)), nil
+}
+
+func (s *recordingStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	s.calls = append(s.calls, OpVerify)
+	return &userz.User{Id: login}, nil
+}
+
+func (s *recordingStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	s.calls = append(s.calls, OpUpdate)
+	return &userz.User{Id: id}, nil
+}
+
+func (s *recordingStore) Remove(ctx context.Context, id string) (*userz.User, error) {
+	s.calls = append(s.calls, OpRemove)
+	return &userz.User{Id: id}, nil
+}
+
+func (s *recordingStore) List(ctx context.Context, filter *userz.Filter, pageSize uint) (userz.Iterator[[]*userz.User], error) {
+	s.calls = append(s.calls, OpList)
+	s.filter = filter
+	return nil, nil
+}
+
+func (s *recordingStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
+	s.calls = append(s.calls, OpPage)
+	s.filter = filter
+	if filter != nil && filter.Id != "" {
+		// the nickname of the users is their id
+		return []*userz.User{{Id: filter.Id, NickName: filter.Id}}, userz.NewPaginationData(1, 1), nil
+	}
+	return nil, userz.PaginationData{}, nil
+}
+
+func (s *recordingStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	s.filter = filter
+	return filter, nil
+}
+
+func newTestStore(t *testing.T) (*recordingStore, userz.Store) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicy), 0o600))
+
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+
+	wrapped := &recordingStore{}
+	return wrapped, NewAuthzStore(wrapped, policy)
+}
+
+func as(id string, roles ...string) context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{ID: id, Roles: roles})
+}
+
+func TestAuthzStoreAdmin(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	ctx := as("root", "admin")
+
+	_, err := store.Add(ctx, &userz.UserData{NickName: "nick"})
+	assert.NoError(err)
+	_, err = store.Update(ctx, "someone", &userz.UserData{Country: "IT"})
+	assert.NoError(err)
+	_, err = store.Remove(ctx, "someone")
+	assert.NoError(err)
+	_, err = store.List(ctx, nil, 10)
+	assert.NoError(err)
+	_, _, err = store.Page(ctx, nil, &userz.PageParams{Size: 10})
+	assert.NoError(err)
+
+	assert.Equal([]string{OpAdd, OpUpdate, OpRemove, OpList, OpPage}, wrapped.calls)
+	assert.Nil(wrapped.filter)
+}
+
+func TestAuthzStoreReader(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	ctx := as("service", "reader")
+
+	_, err := store.Add(ctx, &userz.UserData{NickName: "nick"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+	_, err = store.Update(ctx, "someone", &userz.UserData{Country: "IT"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+	_, err = store.Remove(ctx, "someone")
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.List(ctx, nil, 10)
+	assert.NoError(err)
+	_, _, err = store.Page(ctx, nil, &userz.PageParams{Size: 10})
+	assert.NoError(err)
+
+	assert.Equal([]string{OpList, OpPage}, wrapped.calls)
+}
+
+func TestAuthzStoreSelf(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	ctx := as("me", "self")
+
+	_, err := store.Update(ctx, "me", &userz.UserData{Email: "me@example.com"})
+	assert.NoError(err)
+
+	_, err = store.Update(ctx, "someone", &userz.UserData{Email: "me@example.com"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Update(ctx, "me", &userz.UserData{NickName: "other"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Update(ctx, "me", &userz.UserData{Clear: []userz.Field{userz.FieldCountry}})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Remove(ctx, "me")
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, _, err = store.Page(ctx, nil, &userz.PageParams{Size: 10})
+	assert.NoError(err)
+	assert.Equal("me", wrapped.filter.Id)
+
+	_, _, err = store.Page(ctx, &userz.Filter{Id: "someone"}, &userz.PageParams{Size: 10})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.List(ctx, nil, 10)
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	assert.Equal([]string{OpUpdate, OpPage}, wrapped.calls)
+}
+
+func TestAuthzStoreScope(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	scoper := store.(userz.Scoper)
+
+	filter := &userz.Filter{NickName: userz.Cond[string]{Op: userz.OpEq, Value: "someone"}}
+	scope, err := scoper.Scope(as("admin", "admin"), filter)
+	assert.NoError(err)
+	assert.Equal(filter, scope)
+
+	// restricted as List
+	scope, err = scoper.Scope(as("me", "watcher"), filter)
+	assert.NoError(err)
+	assert.Equal("me", scope.Id)
+	assert.Equal(filter.NickName, scope.NickName)
+	assert.Equal(scope, wrapped.filter)
+
+	_, err = scoper.Scope(as("me", "watcher"), &userz.Filter{Id: "someone"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = scoper.Scope(as("me", "self"), filter)
+	assert.ErrorIs(err, userz.ErrForbidden)
+}
+
+func TestAuthzStoreMultipleRoles(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	ctx := as("me", "self", "reader")
+
+	_, _, err := store.Page(ctx, nil, &userz.PageParams{Size: 10})
+	assert.NoError(err)
+	assert.Nil(wrapped.filter)
+}
+
+func TestAuthzStoreAddBulk(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	adder := store.(userz.BulkAdder)
+
+	users := []*userz.UserData{
+		{NickName: "nick1", Email: "nick1@example.com", Password: "secret"},
+		{NickName: "nick2", Email: "nick2@example.com", Password: "secret"},
+	}
+
+	added, err := adder.AddBulk(as("bot", "onboarder"), users)
+	assert.NoError(err)
+	assert.Equal(uint(2), added)
+
+	_, err = adder.AddBulk(as("reader", "reader"), users)
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	// a single user with fields not writable spoils the lot
+	users = append(users, &userz.UserData{NickName: "nick3", Email: "nick3@example.com", Password: "secret", Country: "IT"})
+	_, err = adder.AddBulk(as("bot", "onboarder"), users)
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	assert.Equal([]string{OpAdd}, wrapped.calls)
+}
+
+func TestAuthzStoreVerify(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	verifier := store.(userz.Verifier)
+
+	user, err := verifier.Verify(as("me", "self"), "me", "secret")
+	assert.NoError(err)
+	assert.Equal("me", user.Id)
+
+	_, err = verifier.Verify(as("me", "self"), "other", "secret")
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = verifier.Verify(as("reader", "reader"), "me", "secret")
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = verifier.Verify(as("root", "admin"), "other", "secret")
+	assert.NoError(err)
+
+	assert.Equal([]string{OpPage, OpVerify, OpPage, OpVerify}, wrapped.calls)
+}
+
+func TestAuthzStoreVerifyOthersPassword(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(os.WriteFile(path, []byte(testPolicy), 0o600))
+	policy, err := LoadPolicy(path)
+	require.NoError(err)
+
+	wrapped := memory.NewMemoryStore()
+	me, err := wrapped.Add(context.Background(), &userz.UserData{NickName: "me", Email: "me@example.com", Password: "mine"})
+	require.NoError(err)
+	other, err := wrapped.Add(context.Background(), &userz.UserData{NickName: "other", Email: "other@example.com", PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	require.NoError(err)
+
+	verifier := NewAuthzStore(wrapped, policy).(userz.Verifier)
+	ctx := as(me.Id, "self")
+
+	// the right and the wrong password are told apart by nobody
+	_, err = verifier.Verify(ctx, "other", "secret")
+	assert.ErrorIs(err, userz.ErrForbidden)
+	_, err = verifier.Verify(ctx, "other@example.com", "wrong")
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	// and the legacy hash of the other is left alone
+	users, _, err := wrapped.Page(context.Background(), &userz.Filter{Id: other.Id}, &userz.PageParams{Size: 1})
+	require.NoError(err)
+	require.Len(users, 1)
+	assert.True(users[0].Password.Legacy())
+
+	user, err := verifier.Verify(ctx, "me@example.com", "mine")
+	assert.NoError(err)
+	assert.Equal(me.Id, user.Id)
+}
+
+func TestAuthzStorePasswordHash(t *testing.T) {
+	assert := assert.New(t)
+	_, store := newTestStore(t)
+
+	_, err := store.Update(as("me", "self"), "me", &userz.UserData{PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	// not even the roles with all the fields
+	_, err = store.Update(as("root", "admin"), "me", &userz.UserData{PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Update(as("root", "admin"), "me", &userz.UserData{Password: "secret", Country: "IT"})
+	assert.NoError(err)
+
+	_, err = store.Update(as("root", "migrator"), "me", &userz.UserData{PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	assert.NoError(err)
+}
+
+func TestHashlessStore(t *testing.T) {
+	assert := assert.New(t)
+	wrapped := &recordingStore{}
+	store := NewHashlessStore(wrapped)
+	ctx := context.Background()
+
+	_, err := store.Add(ctx, &userz.UserData{NickName: "jd", PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.(userz.BulkAdder).AddBulk(ctx, []*userz.UserData{
+		{NickName: "jd", Password: "secret"},
+		{NickName: "mr", PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"},
+	})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Update(ctx, "me", &userz.UserData{PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479"})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, err = store.Add(ctx, &userz.UserData{NickName: "jd", Password: "secret"})
+	assert.NoError(err)
+
+	_, err = store.Update(ctx, "me", &userz.UserData{Password: "secret"})
+	assert.NoError(err)
+
+	assert.Equal([]string{OpAdd, OpUpdate}, wrapped.calls)
+}
+
+func TestAuthzStoreUnauthenticated(t *testing.T) {
+	assert := assert.New(t)
+	wrapped, store := newTestStore(t)
+	ctx := context.Background()
+
+	_, _, err := store.Page(ctx, nil, &userz.PageParams{Size: 10})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	_, _, err = store.Page(as("nobody", "unknown"), nil, &userz.PageParams{Size: 10})
+	assert.ErrorIs(err, userz.ErrForbidden)
+
+	assert.Empty(wrapped.calls)
+}
+
+func TestLoadPolicyInvalid(t *testing.T) {
+	cases := map[string]string{
+		"malformed":         `{"roles": `,
+		"unknown operation": `{"roles": {"r": {"operations": ["drop"]}}}`,
+		"unknown field":     `{"roles": {"r": {"operations": ["update"], "fields": ["id"]}}}`,
+	}
+
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			_, err := LoadPolicy(path)
+			assert.Error(t, err)
+		})
+	}
+}
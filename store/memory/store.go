@@ -2,6 +2,7 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -10,7 +11,13 @@ import (
 	"github.com/leophys/userz"
 )
 
-var _ userz.Store = &MemoryStore{}
+var (
+	_ userz.Store        = &MemoryStore{}
+	_ userz.BulkAdder    = &MemoryStore{}
+	_ userz.Verifier     = &MemoryStore{}
+	_ userz.TakenChecker = &MemoryStore{}
+	_ userz.Scoper       = &MemoryStore{}
+)
 
 type MemoryStore struct {
 	data map[string]*userz.User
@@ -29,7 +36,7 @@ func (s *MemoryStore) Add(ctx context.Context, user *userz.UserData) (*userz.Use
 
 	id := uuid.New().String()
 
-	password, err := userz.NewPassword(user.Password)
+	password, err := user.NewPassword(userz.NewPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +56,114 @@ func (s *MemoryStore) Add(ctx context.Context, user *userz.UserData) (*userz.Use
 	return newUser, nil
 }
 
+func (s *MemoryStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	passwords, err := userz.UserPasswords(ctx, userz.NewPassword, users)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := make(map[string]struct{})
+	for _, user := range s.data {
+		taken["nickname:"+user.NickName] = struct{}{}
+		taken["email:"+user.Email] = struct{}{}
+	}
+
+	for _, user := range users {
+		for _, key := range []string{"nickname:" + user.NickName, "email:" + user.Email} {
+			if _, ok := taken[key]; ok {
+				return 0, userz.ErrConflict
+			}
+			taken[key] = struct{}{}
+		}
+	}
+
+	createdAt := time.Now()
+	for i, user := range users {
+		id := uuid.New().String()
+		s.data[id] = &userz.User{
+			Id:        id,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			NickName:  user.NickName,
+			Email:     user.Email,
+			Password:  passwords[i],
+			Country:   user.Country,
+			CreatedAt: createdAt,
+		}
+	}
+
+	return uint(len(users)), nil
+}
+
+// Scope returns the filter as is, as every user is visible to everyone.
+func (s *MemoryStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	return filter, nil
+}
+
+func (s *MemoryStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	takenNicknames := make(map[string]struct{})
+	takenEmails := make(map[string]struct{})
+	for _, user := range s.data {
+		takenNicknames[user.NickName] = struct{}{}
+		takenEmails[user.Email] = struct{}{}
+	}
+
+	among := func(values []string, taken map[string]struct{}) []string {
+		var res []string
+		for _, value := range values {
+			if _, ok := taken[value]; ok {
+				res = append(res, value)
+			}
+		}
+		return res
+	}
+
+	return among(nicknames, takenNicknames), among(emails, takenEmails), nil
+}
+
+func (s *MemoryStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the ambiguous logins are refused
+	var users []*userz.User
+	for _, u := range s.data {
+		if u.NickName == login || u.Email == login {
+			users = append(users, u)
+		}
+	}
+
+	if len(users) != 1 {
+		userz.CompareDecoy(password)
+		return nil, userz.ErrInvalidCredentials
+	}
+	user := users[0]
+
+	ok, err := user.Password.Matches(password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, userz.ErrInvalidCredentials
+	}
+
+	if user.Password.Legacy() {
+		upgraded, err := userz.NewPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = upgraded
+	}
+
+	return user, nil
+}
+
 func (s *MemoryStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -58,24 +173,34 @@ func (s *MemoryStore) Update(ctx context.Context, id string, user *userz.UserDat
 		return nil, nil
 	}
 
-	if user.FirstName != "" {
+	if user.Clears(userz.FieldFirstName) {
+		curUser.FirstName = ""
+	} else if user.FirstName != "" {
 		curUser.FirstName = user.FirstName
 	}
 
-	if user.LastName != "" {
+	if user.Clears(userz.FieldLastName) {
+		curUser.LastName = ""
+	} else if user.LastName != "" {
 		curUser.LastName = user.LastName
 	}
 
-	if user.Country != "" {
+	if user.Clears(userz.FieldCountry) {
+		curUser.Country = ""
+	} else if user.Country != "" {
 		curUser.Country = user.Country
 	}
 
+	if user.NickName != "" {
+		curUser.NickName = user.NickName
+	}
+
 	if user.Email != "" {
 		curUser.Email = user.Email
 	}
 
-	if user.Password != "" {
-		newPassword, err := userz.NewPassword(user.Password)
+	if user.SetsPassword() {
+		newPassword, err := user.NewPassword(userz.NewPassword)
 		if err != nil {
 			return nil, err
 		}
@@ -112,9 +237,17 @@ func (s *MemoryStore) List(ctx context.Context, filter *userz.Filter, pageSize u
 	var paginated [][]*userz.User
 	elems := len(s.data)
 
+	users := make([]*userz.User, 0, elems)
+	for _, user := range s.data {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[j].After(users[i].CreatedAt, users[i].Id)
+	})
+
 	var page []*userz.User
 	var counter uint
-	for _, user := range s.data {
+	for _, user := range users {
 		counter++
 		page = append(page, user)
 		if counter == pageSize {
@@ -140,14 +273,19 @@ func (s *MemoryStore) List(ctx context.Context, filter *userz.Filter, pageSize u
 	return iterator, nil
 }
 
-func (s *MemoryStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, error) {
+func (s *MemoryStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	var page []*userz.User
 
+	// NOTE: of the filter, this store honours only the id
 	var counter uint
 	for _, user := range s.data {
+		if filter != nil && filter.Id != "" && user.Id != filter.Id {
+			continue
+		}
+
 		if counter >= params.Offset {
 			page = append(page, user)
 		}
@@ -159,7 +297,7 @@ func (s *MemoryStore) Page(ctx context.Context, filter *userz.Filter, params *us
 		}
 	}
 
-	return page, nil
+	return page, userz.NewPaginationData(uint(len(s.data)), params.Size), nil
 }
 
 type MemoryIterator struct {
@@ -181,3 +319,27 @@ func (i *MemoryIterator) Next(ctx context.Context) ([]*userz.User, error) {
 
 	return resp, nil
 }
+
+// SeekAfter drops the users up to the given one.
+func (i *MemoryIterator) SeekAfter(createdAt time.Time, id string) error {
+	var users []*userz.User
+	for _, page := range i.data {
+		for _, user := range page {
+			if user.After(createdAt, id) {
+				users = append(users, user)
+			}
+		}
+	}
+
+	i.data = nil
+	for len(users) > 0 {
+		size := i.info.PageSize
+		if size == 0 || size > uint(len(users)) {
+			size = uint(len(users))
+		}
+		i.data = append(i.data, users[:size])
+		users = users[size:]
+	}
+
+	return nil
+}
@@ -2,12 +2,19 @@ package notifying
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/leophys/userz"
 	"github.com/leophys/userz/pkg/notifier"
 )
 
-var _ userz.Store = &NotifyingStore{}
+var (
+	_ userz.Store        = &NotifyingStore{}
+	_ userz.BulkAdder    = &NotifyingStore{}
+	_ userz.Verifier     = &NotifyingStore{}
+	_ userz.TakenChecker = &NotifyingStore{}
+	_ userz.Scoper       = &NotifyingStore{}
+)
 
 type NotifyingStore struct {
 	wrapped  userz.Store
@@ -21,12 +28,11 @@ func NewNotifyingStore(wrapped userz.Store, provider notifier.Notifier) userz.St
 	}
 }
 
+// Add notifies the creation with the user added, but the password.
 func (s *NotifyingStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
 	res, err := s.wrapped.Add(ctx, user)
 	if err == nil {
-		if err := s.provider.Notify(ctx, notifier.NotifyAccountCreated, map[string]string{
-			"id": res.Id,
-		}); err != nil {
+		if err := s.provider.Notify(ctx, notifier.NotifyAccountCreated, metadata(res)); err != nil {
 			return nil, err
 		}
 	}
@@ -34,12 +40,73 @@ func (s *NotifyingStore) Add(ctx context.Context, user *userz.UserData) (*userz.
 	return res, err
 }
 
+// AddBulk forwards to the wrapped store, if able to add in bulk, and sends
+// a single notification for all the users added.
+func (s *NotifyingStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	adder, ok := s.wrapped.(userz.BulkAdder)
+	if !ok {
+		return 0, userz.ErrBulkUnsupported
+	}
+
+	res, err := adder.AddBulk(ctx, users)
+	if err == nil && res > 0 {
+		if err := s.provider.Notify(ctx, notifier.NotifyAccountsImported, map[string]string{
+			"count": strconv.FormatUint(uint64(res), 10),
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	return res, err
+}
+
+// Taken forwards to the wrapped store, if able to tell the nicknames and
+// emails taken.
+func (s *NotifyingStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	checker, ok := s.wrapped.(userz.TakenChecker)
+	if !ok {
+		return nil, nil, userz.ErrTakenUnsupported
+	}
+
+	return checker.Taken(ctx, nicknames, emails)
+}
+
+// Scope forwards to the wrapped store, if able to tell the users visible to
+// the caller.
+func (s *NotifyingStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	scoper, ok := s.wrapped.(userz.Scoper)
+	if !ok {
+		return nil, userz.ErrScopeUnsupported
+	}
+
+	return scoper.Scope(ctx, filter)
+}
+
+// Verify forwards to the wrapped store, if able to verify the credentials.
+// Hashing a legacy password anew is not notified, as it changes nothing
+// visible.
+func (s *NotifyingStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	verifier, ok := s.wrapped.(userz.Verifier)
+	if !ok {
+		return nil, userz.ErrVerifyUnsupported
+	}
+
+	return verifier.Verify(ctx, login, password)
+}
+
+// Update notifies the update with the user updated and, as far as it can
+// be read beforehand, the user before the update, but the passwords.
 func (s *NotifyingStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	previous := s.get(ctx, id)
+
 	res, err := s.wrapped.Update(ctx, id, user)
 	if err == nil {
-		if err := s.provider.Notify(ctx, notifier.NotifyAccountUpdated, map[string]string{
-			"id": id,
-		}); err != nil {
+		metadata := metadata(res)
+		if previous != nil {
+			previous.AddMetadata(metadata, userz.MetadataPrevious)
+		}
+
+		if err := s.provider.Notify(ctx, notifier.NotifyAccountUpdated, metadata); err != nil {
 			return nil, err
 		}
 	}
@@ -47,12 +114,17 @@ func (s *NotifyingStore) Update(ctx context.Context, id string, user *userz.User
 	return res, err
 }
 
+// Remove notifies the removal with the user removed, but the password, as
+// the user before the change.
 func (s *NotifyingStore) Remove(ctx context.Context, id string) (*userz.User, error) {
 	res, err := s.wrapped.Remove(ctx, id)
 	if err == nil {
-		if err := s.provider.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{
-			"id": id,
-		}); err != nil {
+		metadata := map[string]string{"id": id}
+		if res != nil {
+			res.AddMetadata(metadata, userz.MetadataPrevious)
+		}
+
+		if err := s.provider.Notify(ctx, notifier.NotifyAccountRemoved, metadata); err != nil {
 			return nil, err
 		}
 	}
@@ -64,6 +136,35 @@ func (s *NotifyingStore) List(ctx context.Context, filter *userz.Filter, pageSiz
 	return s.wrapped.List(ctx, filter, pageSize)
 }
 
-func (s *NotifyingStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, error) {
+func (s *NotifyingStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
 	return s.wrapped.Page(ctx, filter, params)
 }
+
+// get returns the user, or nil if it cannot be read: the notifications go
+// without the previous state then.
+func (s *NotifyingStore) get(ctx context.Context, id string) *userz.User {
+	users, _, err := s.wrapped.Page(ctx, &userz.Filter{Id: id}, &userz.PageParams{
+		Size:  1,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	if err != nil {
+		return nil
+	}
+
+	for _, user := range users {
+		if user.Id == id {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// metadata returns the metadata of the notification of the user, with its
+// fields but the password.
+func metadata(user *userz.User) map[string]string {
+	metadata := map[string]string{"id": user.Id}
+	user.AddMetadata(metadata, "")
+
+	return metadata
+}
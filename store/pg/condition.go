@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/leophys/userz"
 )
 
@@ -13,7 +15,10 @@ const (
 	pgTimeFormat = "2006-01-02 15:04:05-07"
 )
 
-var _ userz.Condition[string] = &PGCondition[string]{}
+var (
+	_ userz.Condition[string] = &PGCondition[string]{}
+	_ userz.Matcher[string]   = &PGCondition[string]{}
+)
 
 type sqlOp[T userz.Conditionable] userz.Op
 
@@ -126,6 +131,10 @@ func (c *PGCondition[T]) Hash(field string) (string, error) {
 	return userz.Hash(fmtStr), nil
 }
 
+func (c *PGCondition[T]) Match(value T) (bool, error) {
+	return userz.Cond[T](*c).Match(value)
+}
+
 // NOTE: the type cast of each Condition[T] to *PGCondition[T] is necessary
 // to override the implementation of Evaluate.
 func formatFilter(filter *userz.Filter) (string, error) {
@@ -135,7 +144,13 @@ func formatFilter(filter *userz.Filter) (string, error) {
 	var statements []string
 
 	if filter.Id != "" {
-		statements = append(statements, fmt.Sprintf("id = '%s'", filter.Id))
+		// ids are UUIDs: anything else cannot match, and must not end up
+		// in the statement
+		if id, err := uuid.Parse(filter.Id); err == nil {
+			statements = append(statements, fmt.Sprintf("id = '%s'", id))
+		} else {
+			statements = append(statements, "false")
+		}
 	}
 
 	if filter.FirstName != nil {
@@ -70,6 +70,18 @@ func TestPGCondition_formatFilter(t *testing.T) {
 				time1Exp, time2Exp,
 			),
 		},
+		{
+			filter: &userz.Filter{
+				Id: "0b1c6e4e-3a4f-4c1e-9d8b-2f1a3c4d5e6f",
+			},
+			expected: "id = '0b1c6e4e-3a4f-4c1e-9d8b-2f1a3c4d5e6f'",
+		},
+		{
+			filter: &userz.Filter{
+				Id: "x' OR '1' = '1",
+			},
+			expected: "false",
+		},
 	}
 
 	for _, tc := range testCases {
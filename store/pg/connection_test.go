@@ -30,6 +30,9 @@ type mockDB struct {
 	transacting bool
 	commits     int
 	rollback    int
+	copies      int
+	copied      [][]any
+	copyErr     error
 }
 
 func (db *mockDB) Prepare(ctx context.Context, name, statement string) (*pgconn.StatementDescription, error) {
@@ -102,7 +105,23 @@ func (db *mockDB) QueryRow(ctx context.Context, sql string, args ...interface{})
 
 func (db *mockDB) BeginFunc(ctx context.Context, f func(pgx.Tx) error) (err error) { return nil }
 func (db *mockDB) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
-	return 0, nil
+	if db.copyErr != nil {
+		return 0, db.copyErr
+	}
+
+	db.copies++
+
+	var count int64
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return 0, err
+		}
+		db.copied = append(db.copied, values)
+		count++
+	}
+
+	return count, nil
 }
 func (db *mockDB) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults { return nil }
 func (db *mockDB) LargeObjects() (lo pgx.LargeObjects)                          { return }
@@ -212,6 +231,32 @@ func (r *userRow) Scan(dest ...interface{}) error {
 	return nil
 }
 
+// errRow is a row failing with err.
+type errRow struct {
+	err error
+}
+
+func (r *errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+// countRow is the row of a count.
+type countRow int64
+
+func (r countRow) Scan(dest ...interface{}) error {
+	*(dest[0].(*int64)) = int64(r)
+	return nil
+}
+
+// noRows are the rows of a query matching nothing.
+type noRows struct {
+	pgx.Rows
+}
+
+func (noRows) Close()     {}
+func (noRows) Err() error { return nil }
+func (noRows) Next() bool { return false }
+
 type userRows struct {
 	err  error
 	cur  int
@@ -2,38 +2,55 @@ package pg
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/leophys/userz"
-	"github.com/leophys/userz/store/pg/postgres"
 )
 
-var _ userz.Iterator[[]*userz.User] = &PGIterator{}
+var (
+	_ userz.Iterator[[]*userz.User] = &PGIterator{}
+	_ userz.Seeker                  = &PGIterator{}
+)
 
 type queryFunc func(ctx context.Context, offset uint) ([]*userz.User, uint, error)
 
+// keysetFunc returns the page of users after the given one, or the first
+// page if nil, along with the total number of users.
+type keysetFunc func(ctx context.Context, after *keyset) ([]*userz.User, uint, error)
+
+// keyset locates a user in the order of List.
+type keyset struct {
+	createdAt time.Time
+	id        string
+}
+
 type PGIterator struct {
 	pageSize  uint
 	totalRows uint
-	dbtx      postgres.DBTX
-	offset    uint
-	query     queryFunc
-	mu        sync.Mutex
+	// after is the last user returned, to continue after it
+	after *keyset
+	query keysetFunc
+	mu    sync.Mutex
 }
 
+// Len returns the pagination data, which are known only after the first
+// call to Next.
 func (i *PGIterator) Len() userz.PaginationData {
-	return userz.PaginationData{
-		TotalElements: i.totalRows,
-		TotalPages:    i.totalRows/i.pageSize + 1,
-		PageSize:      i.pageSize,
-	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return userz.NewPaginationData(i.totalRows, i.pageSize)
 }
 
 func (i *PGIterator) Next(ctx context.Context) ([]*userz.User, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	result, rows, err := i.query(ctx, i.offset)
+	result, rows, err := i.query(ctx, i.after)
 	if err != nil {
 		return nil, err
 	}
@@ -42,8 +59,23 @@ func (i *PGIterator) Next(ctx context.Context) ([]*userz.User, error) {
 		return nil, userz.ErrNoMorePages
 	}
 
-	i.offset += uint(len(result))
+	last := result[len(result)-1]
+	i.after = &keyset{createdAt: last.CreatedAt, id: last.Id}
 	i.totalRows = rows
 
 	return result, nil
 }
+
+// SeekAfter makes the iterator start after the given user.
+func (i *PGIterator) SeekAfter(createdAt time.Time, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("malformed id %q: %w", id, err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.after = &keyset{createdAt: createdAt, id: id}
+
+	return nil
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 
 	"github.com/leophys/userz"
 )
@@ -21,6 +23,42 @@ OFFSET $1
 LIMIT $2
 `
 
+// listAfter lists the users in the order of List, after the given one, if
+// any, counting all the ones matching the filter.
+const listAfter = `-- name: ListAfter :many
+SELECT * FROM (
+    SELECT
+        id, first_name, last_name, nickname, password, email, country, created_at, updated_at,
+        count(*) OVER() AS total_elements
+    FROM users
+    WHERE %s
+) AS matching
+WHERE $1::uuid IS NULL OR (created_at, id) > ($2::timestamptz, $1::uuid)
+ORDER BY created_at, id
+LIMIT $3
+`
+
+const countFilteredQuery = `-- name: CountFiltered :one
+SELECT count(*) FROM users WHERE %s
+`
+
+// countFiltered returns the number of users matching the filter.
+func countFiltered(ctx context.Context, db db, filter string) (uint, error) {
+	var count int64
+	if err := db.QueryRow(ctx, fmt.Sprintf(countFilteredQuery, filter)).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return uint(count), nil
+}
+
+// pageComplete tells whether the page of the given number of rows provably
+// holds all the users matching the filter, i.e. it is the first one, neither
+// empty nor full. Of the other pages, the users are to be counted apart.
+func pageComplete(params *userz.PageParams, rows uint) bool {
+	return params.Offset == 0 && rows > 0 && rows < params.Size
+}
+
 type preparePaginatedParams struct {
 	queryName string
 	filter    string
@@ -55,45 +93,80 @@ func prepareListPaginated(ctx context.Context, db db, params preparePaginatedPar
 		if err != nil {
 			return nil, 0, err
 		}
-		defer rows.Close()
-
-		var totalRows int64
-		var result []*userz.User
-
-		for rows.Next() {
-			var i listPaginatedRow
-			if err := rows.Scan(
-				&i.ID,
-				&i.FirstName,
-				&i.LastName,
-				&i.Nickname,
-				&i.Password,
-				&i.Email,
-				&i.Country,
-				&i.CreatedAt,
-				&i.UpdatedAt,
-				&totalRows,
-			); err != nil {
-				return nil, 0, err
-			}
-
-			result = append(result, &userz.User{
-				Id:        i.ID.String(),
-				FirstName: i.FirstName.String,
-				LastName:  i.LastName.String,
-				NickName:  i.Nickname,
-				Password:  i.Password,
-				Email:     i.Email,
-				Country:   i.Country.String,
-				CreatedAt: i.CreatedAt.Time,
-				UpdatedAt: i.UpdatedAt.Time,
-			})
+
+		return scanListRows(rows)
+	}, nil
+}
+
+// prepareListAfter prepares the query for the pages of List, in the order
+// of creation time and id.
+func prepareListAfter(ctx context.Context, db db, params preparePaginatedParams) (keysetFunc, error) {
+	query := fmt.Sprintf(listAfter, params.filter)
+
+	if _, err := db.Prepare(
+		ctx,
+		"after"+params.queryName,
+		query); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, after *keyset) ([]*userz.User, uint, error) {
+		var id any
+		var createdAt time.Time
+		if after != nil {
+			id, createdAt = after.id, after.createdAt
 		}
 
-		if err := rows.Err(); err != nil {
+		rows, err := db.Query(ctx, query, id, createdAt, params.pageSize)
+		if err != nil {
 			return nil, 0, err
 		}
 
-		return result, uint(totalRows), nil
+		return scanListRows(rows)
 	}, nil
 }
+
+// scanListRows scans the users of a page, along with the total number of
+// users matching the filter.
+func scanListRows(rows pgx.Rows) ([]*userz.User, uint, error) {
+	defer rows.Close()
+
+	var totalRows int64
+	var result []*userz.User
+
+	for rows.Next() {
+		var i listPaginatedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Nickname,
+			&i.Password,
+			&i.Email,
+			&i.Country,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&totalRows,
+		); err != nil {
+			return nil, 0, err
+		}
+
+		result = append(result, &userz.User{
+			Id:        i.ID.String(),
+			FirstName: i.FirstName.String,
+			LastName:  i.LastName.String,
+			NickName:  i.Nickname,
+			Password:  i.Password,
+			Email:     i.Email,
+			Country:   i.Country.String,
+			CreatedAt: i.CreatedAt.Time,
+			UpdatedAt: i.UpdatedAt.Time,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return result, uint(totalRows), nil
+}
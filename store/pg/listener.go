@@ -0,0 +1,217 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+
+	"github.com/leophys/userz/pkg/notifier"
+	"github.com/leophys/userz/store/pg/postgres"
+)
+
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// listenConn is the subset of a dedicated connection needed to LISTEN.
+type listenConn interface {
+	Exec(ctx context.Context, statement string, params ...interface{}) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Release()
+}
+
+type pooledListenConn struct {
+	*pgxpool.Conn
+}
+
+func (c *pooledListenConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	return c.Conn.Conn().WaitForNotification(ctx)
+}
+
+// Listener receives the notifications published by PGNotifier on a channel,
+// from any instance, and forwards them to a sink notifier. This makes every
+// instance able to serve the changes happening across all of them.
+type Listener struct {
+	channel    string
+	acquire    func(ctx context.Context) (listenConn, error)
+	sink       notifier.Notifier
+	fetch      func(ctx context.Context, id uuid.UUID) (postgres.User, error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// ListenerOption customizes a Listener.
+type ListenerOption func(*Listener)
+
+// WithRowFetching makes the listener fetch the row of the notified user and
+// add its fields (but the password) to the metadata forwarded to the sink.
+// Nothing is added if the user does not exist anymore.
+func WithRowFetching(pool *pgxpool.Pool) ListenerOption {
+	q := postgres.New(pool)
+	return func(l *Listener) {
+		l.fetch = q.Get
+	}
+}
+
+// WithBackoff sets the bounds of the exponential backoff between
+// reconnection attempts.
+func WithBackoff(min, max time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.minBackoff = min
+		l.maxBackoff = max
+	}
+}
+
+// NewListener returns a Listener on the given channel, that keeps a
+// dedicated connection out of the pool.
+func NewListener(pool *pgxpool.Pool, channel string, sink notifier.Notifier, opts ...ListenerOption) *Listener {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	l := &Listener{
+		channel: channel,
+		acquire: func(ctx context.Context) (listenConn, error) {
+			conn, err := pool.Acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &pooledListenConn{conn}, nil
+		},
+		sink:       sink,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Run listens until the context is done, reconnecting with an exponential
+// backoff whenever the connection fails. Notifications published while
+// disconnected are lost.
+func (l *Listener) Run(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx).
+		With().
+		Str("channel", l.channel).
+		Logger()
+
+	backoff := l.minBackoff
+
+	for {
+		received, err := l.listen(ctx, &logger)
+		if ctx.Err() != nil {
+			logger.Info().Msg("Stopped listening for notifications")
+			return nil
+		}
+
+		if received {
+			backoff = l.minBackoff
+		}
+
+		logger.Warn().Err(err).Dur("backoff", backoff).Msg("Listening connection lost, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > l.maxBackoff {
+			backoff = l.maxBackoff
+		}
+	}
+}
+
+// listen acquires a connection and forwards the notifications until an error
+// occurs. It reports whether the LISTEN succeeded.
+func (l *Listener) listen(ctx context.Context, logger *zerolog.Logger) (bool, error) {
+	conn, err := l.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return false, err
+	}
+
+	logger.Info().Msg("Listening for notifications")
+
+	for {
+		msg, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		if err := l.forward(ctx, msg.Payload); err != nil {
+			logger.Err(err).Str("payload", msg.Payload).Msg("Failed to forward notification")
+		}
+	}
+}
+
+func (l *Listener) forward(ctx context.Context, data string) error {
+	p, err := decodePayload(data)
+	if err != nil {
+		return err
+	}
+
+	metadata := p.Metadata
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	if l.fetch != nil && p.Event != notifier.NotifyAccountRemoved && metadata["id"] != "" {
+		if err := l.enrich(ctx, metadata); err != nil {
+			return err
+		}
+	}
+
+	return l.sink.Notify(ctx, p.Event, metadata)
+}
+
+func (l *Listener) enrich(ctx context.Context, metadata map[string]string) error {
+	id, err := uuid.Parse(metadata["id"])
+	if err != nil {
+		return err
+	}
+
+	row, err := l.fetch(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata["nickname"] = row.Nickname
+	metadata["email"] = row.Email
+	if row.FirstName.Valid {
+		metadata["first_name"] = row.FirstName.String
+	}
+	if row.LastName.Valid {
+		metadata["last_name"] = row.LastName.String
+	}
+	if row.Country.Valid {
+		metadata["country"] = row.Country.String
+	}
+	if row.CreatedAt.Valid {
+		metadata["created_at"] = row.CreatedAt.Time.Format(time.RFC3339)
+	}
+	if row.UpdatedAt.Valid {
+		metadata["updated_at"] = row.UpdatedAt.Time.Format(time.RFC3339)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/leophys/userz/pkg/notifier"
+	"github.com/leophys/userz/store/pg/postgres"
+)
+
+const (
+	notifierName   = "pg"
+	DefaultChannel = "userz_events"
+	// maxPayload is the maximum size of a NOTIFY payload accepted by
+	// postgres with the default configuration.
+	maxPayload = 7999
+)
+
+func init() {
+	notifier.Register(notifierName, NewNotifier)
+}
+
+type poolKey struct{}
+
+// ContextWithPool returns a context carrying the connection pool, to be used
+// by the notifier registered as "pg" in its Init.
+func ContextWithPool(ctx context.Context, pool *pgxpool.Pool) context.Context {
+	return context.WithValue(ctx, poolKey{}, pool)
+}
+
+func poolFromContext(ctx context.Context) *pgxpool.Pool {
+	pool, _ := ctx.Value(poolKey{}).(*pgxpool.Pool)
+	return pool
+}
+
+// payload is the content of every NOTIFY. To stay within the size limits,
+// only the id of the user is sent if the metadata are too large; the rows
+// can be fetched by the receiving end.
+type payload struct {
+	Event    notifier.NotificationEvent `json:"event"`
+	Metadata map[string]string          `json:"metadata,omitempty"`
+}
+
+func encodePayload(event notifier.NotificationEvent, metadata map[string]string) (string, error) {
+	data, err := json.Marshal(&payload{Event: event, Metadata: metadata})
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > maxPayload {
+		// fall back to the bare id
+		data, err = json.Marshal(&payload{
+			Event:    event,
+			Metadata: map[string]string{"id": metadata["id"]},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if len(data) > maxPayload {
+			return "", fmt.Errorf("notification payload too large: %d bytes", len(data))
+		}
+	}
+
+	return string(data), nil
+}
+
+func decodePayload(data string) (*payload, error) {
+	var p payload
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, fmt.Errorf("malformed notification payload: %w", err)
+	}
+
+	return &p, nil
+}
+
+var (
+	_ notifier.Notifier = &PGNotifier{}
+	_ notifier.Checker  = &PGNotifier{}
+)
+
+// PGNotifier publishes the notifications on a postgres channel via
+// pg_notify, so that every instance listening on the channel (see Listener)
+// receives them. It is registered as "pg".
+type PGNotifier struct {
+	channel string
+	db      postgres.DBTX
+}
+
+// NewNotifier returns a notifier publishing on the channel in the "channel"
+// configuration key (defaults to userz_events). It reuses the connection
+// pool found in the context passed to Init (see ContextWithPool).
+func NewNotifier(config map[string]string) (notifier.Notifier, error) {
+	channel := config["channel"]
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	return &PGNotifier{
+		channel: channel,
+	}, nil
+}
+
+func (n *PGNotifier) Init(ctx context.Context) error {
+	if n.db != nil {
+		return nil
+	}
+
+	pool := poolFromContext(ctx)
+	if pool == nil {
+		return fmt.Errorf("the %s notifier needs a connection pool in the context", notifierName)
+	}
+
+	n.db = &PGPooledConn{pool}
+
+	return nil
+}
+
+// Check verifies that the database is reachable.
+func (n *PGNotifier) Check(ctx context.Context) error {
+	_, err := n.db.Exec(ctx, "SELECT 1")
+	return err
+}
+
+func (n *PGNotifier) Notify(ctx context.Context, event notifier.NotificationEvent, metadata map[string]string) error {
+	data, err := encodePayload(event, metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.db.Exec(ctx, "SELECT pg_notify($1, $2)", n.channel, data)
+
+	return err
+}
@@ -0,0 +1,174 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leophys/userz/pkg/notifier"
+)
+
+func TestPayload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := encodePayload(notifier.NotifyAccountCreated, map[string]string{"id": "1"})
+	require.NoError(err)
+	assert.JSONEq(`{"event":"CREATED","metadata":{"id":"1"}}`, data)
+
+	p, err := decodePayload(data)
+	require.NoError(err)
+	assert.Equal(notifier.NotifyAccountCreated, p.Event)
+	assert.Equal(map[string]string{"id": "1"}, p.Metadata)
+
+	// too large, only the id is kept
+	data, err = encodePayload(notifier.NotifyAccountUpdated, map[string]string{
+		"id":    "1",
+		"extra": strings.Repeat("x", maxPayload),
+	})
+	require.NoError(err)
+	assert.JSONEq(`{"event":"UPDATED","metadata":{"id":"1"}}`, data)
+
+	_, err = decodePayload("nope")
+	assert.Error(err)
+}
+
+type execRecorder struct {
+	mockDB
+	statements []string
+	args       [][]interface{}
+}
+
+func (db *execRecorder) Exec(ctx context.Context, statement string, params ...interface{}) (pgconn.CommandTag, error) {
+	db.statements = append(db.statements, statement)
+	db.args = append(db.args, params)
+	return nil, nil
+}
+
+func TestPGNotifier(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	n, err := NewNotifier(map[string]string{"channel": "test"})
+	require.NoError(err)
+	assert.Error(n.Init(ctx))
+
+	db := &execRecorder{}
+	n.(*PGNotifier).db = db
+	require.NoError(n.Init(ctx))
+
+	require.NoError(n.Notify(ctx, notifier.NotifyAccountRemoved, map[string]string{"id": "1"}))
+	require.Len(db.statements, 1)
+	assert.Equal("SELECT pg_notify($1, $2)", db.statements[0])
+	assert.Equal("test", db.args[0][0])
+	assert.JSONEq(`{"event":"REMOVED","metadata":{"id":"1"}}`, db.args[0][1].(string))
+}
+
+type fakeListenConn struct {
+	notifications chan *pgconn.Notification
+	fail          chan error
+	listened      []string
+}
+
+func (c *fakeListenConn) Exec(ctx context.Context, statement string, params ...interface{}) (pgconn.CommandTag, error) {
+	c.listened = append(c.listened, statement)
+	return nil, nil
+}
+
+func (c *fakeListenConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-c.fail:
+		return nil, err
+	case n := <-c.notifications:
+		return n, nil
+	}
+}
+
+func (c *fakeListenConn) Release() {}
+
+type collectingNotifier struct {
+	mu     sync.Mutex
+	events []notifier.NotificationEvent
+}
+
+func (n *collectingNotifier) Init(context.Context) error { return nil }
+
+func (n *collectingNotifier) Notify(ctx context.Context, event notifier.NotificationEvent, metadata map[string]string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func (n *collectingNotifier) received() []notifier.NotificationEvent {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notifier.NotificationEvent{}, n.events...)
+}
+
+func TestListenerReconnects(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn := &fakeListenConn{
+		notifications: make(chan *pgconn.Notification),
+		fail:          make(chan error),
+	}
+
+	var mu sync.Mutex
+	var acquired int
+	sink := &collectingNotifier{}
+	l := &Listener{
+		channel: "test",
+		acquire: func(context.Context) (listenConn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			acquired++
+			if acquired == 2 {
+				return nil, errors.New("database unavailable")
+			}
+			return conn, nil
+		},
+		sink:       sink,
+		minBackoff: time.Millisecond,
+		maxBackoff: 10 * time.Millisecond,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+
+	conn.notifications <- &pgconn.Notification{Payload: `{"event":"CREATED","metadata":{"id":"1"}}`}
+	conn.fail <- errors.New("connection reset")
+	// after the failure, a failed acquire, and a successful one
+	conn.notifications <- &pgconn.Notification{Payload: `malformed`}
+	conn.notifications <- &pgconn.Notification{Payload: `{"event":"REMOVED","metadata":{"id":"1"}}`}
+
+	assert.Eventually(func() bool {
+		return len(sink.received()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal([]notifier.NotificationEvent{notifier.NotifyAccountCreated, notifier.NotifyAccountRemoved}, sink.received())
+
+	cancel()
+	<-done
+
+	mu.Lock()
+	assert.Equal(3, acquired)
+	mu.Unlock()
+	assert.Equal([]string{`LISTEN "test"`, `LISTEN "test"`}, conn.listened)
+}
@@ -82,6 +82,43 @@ func (q *Queries) Get(ctx context.Context, id uuid.UUID) (User, error) {
 	return i, err
 }
 
+const getByLogin = `-- name: GetByLogin :many
+SELECT id, first_name, last_name, nickname, password, email, country, created_at, updated_at
+FROM users
+WHERE nickname = $1 OR email = $1
+LIMIT 2
+`
+
+func (q *Queries) GetByLogin(ctx context.Context, login string) ([]User, error) {
+	rows, err := q.db.Query(ctx, getByLogin, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Nickname,
+			&i.Password,
+			&i.Email,
+			&i.Country,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const remove = `-- name: Remove :one
 DELETE FROM users
 WHERE
@@ -106,6 +143,42 @@ func (q *Queries) Remove(ctx context.Context, id uuid.UUID) (User, error) {
 	return i, err
 }
 
+const taken = `-- name: Taken :many
+SELECT nickname, email
+FROM users
+WHERE nickname = ANY($1::text[]) OR email = ANY($2::text[])
+`
+
+type TakenParams struct {
+	Nicknames []string
+	Emails    []string
+}
+
+type TakenRow struct {
+	Nickname string
+	Email    string
+}
+
+func (q *Queries) Taken(ctx context.Context, arg TakenParams) ([]TakenRow, error) {
+	rows, err := q.db.Query(ctx, taken, arg.Nicknames, arg.Emails)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TakenRow
+	for rows.Next() {
+		var i TakenRow
+		if err := rows.Scan(&i.Nickname, &i.Email); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const update = `-- name: Update :one
 UPDATE users SET
     first_name = $2,
@@ -154,3 +227,24 @@ func (q *Queries) Update(ctx context.Context, arg UpdateParams) (User, error) {
 	)
 	return i, err
 }
+
+const updatePassword = `-- name: UpdatePassword :execrows
+UPDATE users SET
+    password = $1
+WHERE
+    id = $2 AND password = $3
+`
+
+type UpdatePasswordParams struct {
+	NewPassword []byte
+	ID          uuid.UUID
+	OldPassword []byte
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updatePassword, arg.NewPassword, arg.ID, arg.OldPassword)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
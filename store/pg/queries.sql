@@ -3,6 +3,17 @@ SELECT *
 FROM users
 WHERE id = $1;
 
+-- name: GetByLogin :many
+SELECT *
+FROM users
+WHERE nickname = sqlc.arg(login) OR email = sqlc.arg(login)
+LIMIT 2;
+
+-- name: Taken :many
+SELECT nickname, email
+FROM users
+WHERE nickname = ANY(sqlc.arg(nicknames)::text[]) OR email = ANY(sqlc.arg(emails)::text[]);
+
 -- name: Add :one
 INSERT INTO users (
     first_name,
@@ -34,3 +45,9 @@ DELETE FROM users
 WHERE
     id = $1
 RETURNING *;
+
+-- name: UpdatePassword :execrows
+UPDATE users SET
+    password = sqlc.arg(new_password)
+WHERE
+    id = sqlc.arg(id) AND password = sqlc.arg(old_password);
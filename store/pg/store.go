@@ -3,17 +3,37 @@ package pg
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
 
 	"github.com/leophys/userz"
 	"github.com/leophys/userz/store/pg/postgres"
 )
 
-var _ userz.Store = &PGStore{}
+var (
+	_ userz.Store        = &PGStore{}
+	_ userz.BulkAdder    = &PGStore{}
+	_ userz.TakenChecker = &PGStore{}
+	_ userz.Scoper       = &PGStore{}
+	_ userz.Verifier     = &PGStore{}
+)
+
+const (
+	// copyBatchSize is the number of users loaded by each COPY.
+	copyBatchSize = 1000
+	// uniqueViolation is the error code of postgres for a duplicate key.
+	uniqueViolation = "23505"
+)
+
+// copyColumns are the columns of the users filled by AddBulk.
+var copyColumns = []string{"first_name", "last_name", "nickname", "password", "email", "country", "created_at"}
 
 // PGStore is the implementation of the store with a postgresql backend.
 type PGStore struct {
@@ -23,20 +43,37 @@ type PGStore struct {
 }
 
 func NewPGStore(ctx context.Context, databaseURL string) (userz.Store, error) {
-	pool, err := pgxpool.Connect(ctx, databaseURL)
+	pool, err := Connect(ctx, databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+		return nil, err
 	}
 
+	return NewPGStoreFromPool(pool), nil
+}
+
+// NewPGStoreFromPool returns a store backed by an already established
+// connection pool, to be shared with other components.
+func NewPGStoreFromPool(pool *pgxpool.Pool) userz.Store {
 	return &PGStore{
 		db:     &PGPooledConn{pool},
 		q:      postgres.New(pool),
 		hasher: userz.NewPassword,
-	}, nil
+	}
+}
+
+// Connect creates a connection pool towards the database identified by the
+// given databaseURL.
+func Connect(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.Connect(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	return pool, nil
 }
 
 func (s *PGStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, error) {
-	password, err := s.hasher(user.Password)
+	password, err := user.NewPassword(s.hasher)
 	if err != nil {
 		return nil, err
 	}
@@ -69,9 +106,56 @@ func (s *PGStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, e
 	}
 
 	pgResult, err := s.q.Add(ctx, params)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	result := &userz.User{
+		Id:        pgResult.ID.String(),
+		FirstName: pgResult.FirstName.String,
+		LastName:  pgResult.LastName.String,
+		NickName:  pgResult.Nickname,
+		Password:  pgResult.Password,
+		Email:     pgResult.Email,
+		Country:   pgResult.Country.String,
+		CreatedAt: pgResult.CreatedAt.Time,
+		UpdatedAt: pgResult.UpdatedAt.Time,
+	}
+
+	return result, nil
+}
+
+// Verify checks the password of the user, hashing it anew if stored in a
+// legacy format. The new hash is stored only if the old one is still there,
+// and a failure in storing it does not fail the verification. The logins
+// that are the nickname of a user and the email of another are refused.
+func (s *PGStore) Verify(ctx context.Context, login, password string) (*userz.User, error) {
+	pgResults, err := s.q.GetByLogin(ctx, login)
 	if err != nil {
 		return nil, err
 	}
+	if len(pgResults) != 1 {
+		userz.CompareDecoy(password)
+		return nil, userz.ErrInvalidCredentials
+	}
+	pgResult := pgResults[0]
+
+	stored := userz.Password(pgResult.Password)
+	ok, err := stored.Matches(password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, userz.ErrInvalidCredentials
+	}
+
+	if stored.Legacy() {
+		if upgraded, err := s.upgradePassword(ctx, pgResult.ID, stored, password); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("ID", pgResult.ID.String()).Msg("Failed to upgrade the legacy password hash")
+		} else {
+			pgResult.Password = upgraded
+		}
+	}
 
 	result := &userz.User{
 		Id:        pgResult.ID.String(),
@@ -88,8 +172,162 @@ func (s *PGStore) Add(ctx context.Context, user *userz.UserData) (*userz.User, e
 	return result, nil
 }
 
-func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+func (s *PGStore) upgradePassword(ctx context.Context, id uuid.UUID, old userz.Password, plaintext string) (userz.Password, error) {
+	password, err := s.hasher(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.q.UpdatePassword(ctx, postgres.UpdatePasswordParams{
+		NewPassword: password,
+		ID:          id,
+		OldPassword: old,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, errors.New("the password changed in the meanwhile")
+	}
+
+	return password, nil
+}
+
+// AddBulk adds the users in a single transaction, loading them with COPY in
+// batches, after hashing their passwords in parallel.
+func (s *PGStore) AddBulk(ctx context.Context, users []*userz.UserData) (uint, error) {
+	passwords, err := userz.UserPasswords(ctx, s.hasher, users)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	createdAt := time.Now()
+
+	var added uint
+	for start := 0; start < len(users); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(users) {
+			end = len(users)
+		}
+
+		rows := make([][]any, 0, end-start)
+		for i := start; i < end; i++ {
+			user := users[i]
+			rows = append(rows, []any{
+				nullable(user.FirstName),
+				nullable(user.LastName),
+				user.NickName,
+				[]byte(passwords[i]),
+				user.Email,
+				nullable(user.Country),
+				createdAt,
+			})
+		}
+
+		copied, err := tx.CopyFrom(ctx, pgx.Identifier{"users"}, copyColumns, pgx.CopyFromRows(rows))
+		if err != nil {
+			return 0, storeError(err)
+		}
+		added += uint(copied)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// Taken returns those of the nicknames and emails already taken, in a single
+// query.
+func (s *PGStore) Taken(ctx context.Context, nicknames, emails []string) ([]string, []string, error) {
+	rows, err := s.q.Taken(ctx, postgres.TakenParams{
+		Nicknames: nicknames,
+		Emails:    emails,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	takenNicknames, takenEmails := takenAmong(rows, nicknames, emails)
+
+	return takenNicknames, takenEmails, nil
+}
+
+// Scope returns the filter as is, as every user is visible to everyone.
+func (s *PGStore) Scope(ctx context.Context, filter *userz.Filter) (*userz.Filter, error) {
+	return filter, nil
+}
+
+// takenAmong returns the nicknames and the emails of the rows among the
+// given ones.
+func takenAmong(rows []postgres.TakenRow, nicknames, emails []string) ([]string, []string) {
+	wanted := func(values []string) map[string]bool {
+		set := make(map[string]bool, len(values))
+		for _, value := range values {
+			set[value] = true
+		}
+		return set
+	}
+	wantedNicknames, wantedEmails := wanted(nicknames), wanted(emails)
+
+	var takenNicknames, takenEmails []string
+	for _, row := range rows {
+		if wantedNicknames[row.Nickname] {
+			takenNicknames = append(takenNicknames, row.Nickname)
+		}
+		if wantedEmails[row.Email] {
+			takenEmails = append(takenEmails, row.Email)
+		}
+	}
+
+	return takenNicknames, takenEmails
+}
+
+// parseId parses the id of a user, returning ErrInvalidId if it is not a
+// uuid.
+func parseId(id string) (uuid.UUID, error) {
 	uuidId, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("%w: %s", userz.ErrInvalidId, err)
+	}
+
+	return uuidId, nil
+}
+
+// storeError converts the errors of postgres to the ones of the store:
+// ErrNotFound for a missing row and ErrConflict for a duplicate nickname or
+// email. The others are returned as they are.
+func storeError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return userz.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", userz.ErrConflict, pgErr.Detail)
+	}
+
+	return err
+}
+
+// nullable returns nil for the empty string, to store it as NULL.
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (*userz.User, error) {
+	uuidId, err := parseId(id)
 	if err != nil {
 		return nil, err
 	}
@@ -108,10 +346,12 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 
 	cur, err := q.Get(ctx, uuidId)
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
 
-	if user.FirstName != "" {
+	if user.Clears(userz.FieldFirstName) {
+		params.FirstName = sql.NullString{}
+	} else if user.FirstName != "" {
 		params.FirstName = sql.NullString{
 			String: user.FirstName,
 			Valid:  true,
@@ -120,7 +360,9 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 		params.FirstName = cur.FirstName
 	}
 
-	if user.LastName != "" {
+	if user.Clears(userz.FieldLastName) {
+		params.LastName = sql.NullString{}
+	} else if user.LastName != "" {
 		params.LastName = sql.NullString{
 			String: user.LastName,
 			Valid:  true,
@@ -135,8 +377,8 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 		params.Nickname = cur.Nickname
 	}
 
-	if user.Password != "" {
-		password, err := s.hasher(user.Password)
+	if user.SetsPassword() {
+		password, err := user.NewPassword(s.hasher)
 		if err != nil {
 			return nil, err
 		}
@@ -152,7 +394,9 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 		params.Email = cur.Email
 	}
 
-	if user.Country != "" {
+	if user.Clears(userz.FieldCountry) {
+		params.Country = sql.NullString{}
+	} else if user.Country != "" {
 		params.Country = sql.NullString{
 			String: user.Country,
 			Valid:  true,
@@ -163,7 +407,7 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 
 	pgResult, err := q.Update(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
 
 	result := &userz.User{
@@ -186,14 +430,14 @@ func (s *PGStore) Update(ctx context.Context, id string, user *userz.UserData) (
 }
 
 func (s *PGStore) Remove(ctx context.Context, id string) (*userz.User, error) {
-	uuidId, err := uuid.Parse(id)
+	uuidId, err := parseId(id)
 	if err != nil {
 		return nil, err
 	}
 
 	pgResult, err := s.q.Remove(ctx, uuidId)
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
 
 	result := &userz.User{
@@ -225,31 +469,34 @@ func (s *PGStore) List(ctx context.Context, filter *userz.Filter, pageSize uint)
 		}
 	}
 
-	query, err := prepareListPaginated(ctx, s.db, preparePaginatedParams{
+	query, err := prepareListAfter(ctx, s.db, preparePaginatedParams{
 		queryName: filterHash,
 		filter:    filterStr,
 		pageSize:  pageSize,
-		orderBy:   userz.Order{userz.OrdByCreatedAt, userz.OrdDirAsc},
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &PGIterator{
 		pageSize: pageSize,
-		dbtx:     s.db,
 		query:    query,
 	}, nil
 }
 
-func (s *PGStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, error) {
+func (s *PGStore) Page(ctx context.Context, filter *userz.Filter, params *userz.PageParams) ([]*userz.User, userz.PaginationData, error) {
+	var none userz.PaginationData
+
 	filterStr, err := formatFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize filter into statement: %w", err)
+		return nil, none, fmt.Errorf("failed to serialize filter into statement: %w", err)
 	}
 
 	var filterHash string
 	if filter != nil {
 		filterHash, err = filter.Hash()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get hash of filter: %w", err)
+			return nil, none, fmt.Errorf("failed to get hash of filter: %w", err)
 		}
 	}
 
@@ -260,12 +507,21 @@ func (s *PGStore) Page(ctx context.Context, filter *userz.Filter, params *userz.
 		orderBy:   params.Order,
 	})
 	if err != nil {
-		return nil, err
+		return nil, none, err
 	}
 
 	users, _, err := query(ctx, params.Offset)
 	if err != nil {
-		return nil, err
+		return nil, none, err
+	}
+
+	total := uint(len(users))
+	if !pageComplete(params, total) {
+		total, err = countFiltered(ctx, s.db, filterStr)
+		if err != nil {
+			return nil, none, err
+		}
 	}
-	return users, nil
+
+	return users, userz.NewPaginationData(total, params.Size), nil
 }
@@ -2,9 +2,11 @@ package pg
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -91,9 +93,9 @@ func TestStoreAdd(t *testing.T) {
 	}
 
 	store := &PGStore{
-		db: fakeDB,
-		q:  postgres.New(fakeDB),
-        hasher: dummyHasher,
+		db:     fakeDB,
+		q:      postgres.New(fakeDB),
+		hasher: dummyHasher,
 	}
 
 	res, err := store.Add(context.TODO(), &userz.UserData{
@@ -149,9 +151,9 @@ func TestStoreUpdate(t *testing.T) {
 	}
 
 	store := &PGStore{
-		db: fakeDB,
-		q:  postgres.New(fakeDB),
-        hasher: dummyHasher,
+		db:     fakeDB,
+		q:      postgres.New(fakeDB),
+		hasher: dummyHasher,
 	}
 
 	res, err := store.Update(context.TODO(), id, &userz.UserData{
@@ -201,9 +203,9 @@ func TestStoreRemove(t *testing.T) {
 	}
 
 	store := &PGStore{
-		db: fakeDB,
-		q:  postgres.New(fakeDB),
-        hasher: dummyHasher,
+		db:     fakeDB,
+		q:      postgres.New(fakeDB),
+		hasher: dummyHasher,
 	}
 
 	res, err := store.Remove(context.TODO(), id)
@@ -211,3 +213,152 @@ func TestStoreRemove(t *testing.T) {
 	require.NotNil(res)
 	assert.Equal(user, *res)
 }
+
+func TestStoreAddBulk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var users []*userz.UserData
+	for i := 0; i < copyBatchSize+1; i++ {
+		users = append(users, &userz.UserData{
+			NickName: fmt.Sprintf("nick%d", i),
+			Email:    fmt.Sprintf("nick%d@example.com", i),
+			Password: fmt.Sprintf("password%d", i),
+		})
+	}
+	users[0].FirstName = "John"
+
+	fakeDB := &mockDB{}
+	store := &PGStore{
+		db:     fakeDB,
+		q:      postgres.New(fakeDB),
+		hasher: dummyHasher,
+	}
+
+	added, err := store.AddBulk(context.TODO(), users)
+	require.NoError(err)
+	assert.Equal(uint(len(users)), added)
+	assert.Equal(2, fakeDB.copies)
+	assert.Equal(1, fakeDB.commits)
+	require.Len(fakeDB.copied, len(users))
+
+	first := fakeDB.copied[0]
+	assert.Equal("John", first[0])
+	assert.Nil(first[1])
+	assert.Equal("nick0", first[2])
+	assert.Equal([]byte("password0"), first[3])
+	assert.Equal("nick0@example.com", first[4])
+	assert.Nil(first[5])
+
+	fakeDB = &mockDB{copyErr: &pgconn.PgError{Code: uniqueViolation, Detail: "Key (nickname)=(nick0) already exists."}}
+	store.db = fakeDB
+
+	added, err = store.AddBulk(context.TODO(), users)
+	assert.ErrorIs(err, userz.ErrConflict)
+	assert.Zero(added)
+	assert.Equal(0, fakeDB.commits)
+	assert.Equal(1, fakeDB.rollback)
+}
+
+func TestStoreErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	id := "e3a190a2-e22e-460e-80dc-1af731744031"
+
+	fakeDB := &mockDB{
+		queryRow: map[string]pgx.Row{
+			fmtSql(get, id):    &errRow{pgx.ErrNoRows},
+			fmtSql(remove, id): &errRow{pgx.ErrNoRows},
+		},
+	}
+
+	store := &PGStore{
+		db:     fakeDB,
+		q:      postgres.New(fakeDB),
+		hasher: dummyHasher,
+	}
+
+	_, err := store.Update(context.TODO(), id, &userz.UserData{Country: "US"})
+	assert.ErrorIs(err, userz.ErrNotFound)
+
+	_, err = store.Remove(context.TODO(), id)
+	assert.ErrorIs(err, userz.ErrNotFound)
+
+	_, err = store.Update(context.TODO(), "not-a-uuid", &userz.UserData{Country: "US"})
+	assert.ErrorIs(err, userz.ErrInvalidId)
+
+	_, err = store.Remove(context.TODO(), "not-a-uuid")
+	assert.ErrorIs(err, userz.ErrInvalidId)
+
+	assert.ErrorIs(storeError(&pgconn.PgError{Code: uniqueViolation}), userz.ErrConflict)
+}
+
+func TestPageComplete(t *testing.T) {
+	cases := []struct {
+		name     string
+		offset   uint
+		size     uint
+		rows     uint
+		complete bool
+	}{
+		{"first page not full", 0, 10, 3, true},
+		{"empty first page", 0, 10, 0, false},
+		{"first page full", 0, 10, 10, false},
+		{"zero page size", 0, 0, 0, false},
+		{"later page", 10, 10, 3, false},
+		{"past the last page", 20, 10, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := &userz.PageParams{Offset: c.offset, Size: c.size}
+			assert.Equal(t, c.complete, pageComplete(params, c.rows))
+		})
+	}
+}
+
+func TestStorePageCount(t *testing.T) {
+	order := userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc}
+	list := fmt.Sprintf(listPaginated, "1 = 1", order)
+
+	cases := []struct {
+		name   string
+		offset uint
+		size   uint
+	}{
+		{"zero page size", 0, 0},
+		{"empty first page", 0, 10},
+		{"past the last page", 20, 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// the users match, yet none is in the page
+			fakeDB := &mockDB{
+				query: map[string]pgx.Rows{
+					fmtSql(list, c.offset, c.size): noRows{},
+				},
+				queryRow: map[string]pgx.Row{
+					fmtSql(fmt.Sprintf(countFilteredQuery, "1 = 1")): countRow(5),
+				},
+			}
+
+			store := &PGStore{
+				db:     fakeDB,
+				q:      postgres.New(fakeDB),
+				hasher: dummyHasher,
+			}
+
+			users, pagination, err := store.Page(context.TODO(), nil, &userz.PageParams{
+				Offset: c.offset,
+				Size:   c.size,
+				Order:  order,
+			})
+			assert.NoError(err)
+			assert.Empty(users)
+			assert.Equal(uint(5), pagination.TotalElements)
+		})
+	}
+}
@@ -105,11 +105,7 @@ func TestGRPCService(t *testing.T) {
 
 	assert.Nil(listResp.Users[0].UpdatedAt)
 
-	assert.NoError(
-		bcrypt.CompareHashAndPassword(
-			[]byte(listResp.Users[0].Password),
-			[]byte("passw0rd")),
-	)
+	assertStoredPassword(t, store, listResp.Users[0].Id, "passw0rd")
 
 	listResp, err = list.Recv()
 	require.Error(err)
@@ -173,11 +169,7 @@ func TestGRPCService(t *testing.T) {
 	require.NoError(err)
 	assert.WithinDuration(time.Now(), updatedAt1, 5*time.Second)
 
-	assert.NoError(
-		bcrypt.CompareHashAndPassword(
-			[]byte(listResp.Users[0].Password),
-			[]byte("passw0rd")),
-	)
+	assertStoredPassword(t, store, listResp.Users[0].Id, "passw0rd")
 
 	listResp, err = list.Recv()
 	require.NoError(err)
@@ -197,11 +189,7 @@ func TestGRPCService(t *testing.T) {
 
 	assert.Nil(listResp.Users[0].UpdatedAt)
 
-	assert.NoError(
-		bcrypt.CompareHashAndPassword(
-			[]byte(listResp.Users[0].Password),
-			[]byte("iAmTheOneAndOnly")),
-	)
+	assertStoredPassword(t, store, listResp.Users[0].Id, "iAmTheOneAndOnly")
 
 	listResp, err = list.Recv()
 	require.Error(err)
@@ -244,3 +232,29 @@ func dial(ctx context.Context) (*grpc.ClientConn, proto.UserzClient, error) {
 
 	return conn, proto.NewUserzClient(conn), nil
 }
+
+// assertStoredPassword checks that the password is stored hashed, given that
+// the hash is never returned by the API.
+func assertStoredPassword(t *testing.T, store userz.Store, id, plaintext string) {
+	t.Helper()
+
+	iter, err := store.List(context.TODO(), nil, 100)
+	require.NoError(t, err)
+
+	for {
+		users, err := iter.Next(context.TODO())
+		if err == userz.ErrNoMorePages {
+			break
+		}
+		require.NoError(t, err)
+
+		for _, user := range users {
+			if user.Id == id {
+				assert.NoError(t, bcrypt.CompareHashAndPassword(user.Password, []byte(plaintext)))
+				return
+			}
+		}
+	}
+
+	t.Fatalf("user %s not found in the store", id)
+}
@@ -1,5 +1,5 @@
 #!/bin/sh
 
 mkdir /plugin \
-    && go build -buildmode=plugin -o /plugin/ ./internal/pollednotifier/... \
+    && go build -buildmode=plugin -o /plugin/pollednotifier.so ./internal/pollednotifier/plugin \
     && go test -v -p 1 -timeout 600s ./tests/... -tags=integration
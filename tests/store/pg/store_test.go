@@ -15,6 +15,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/leophys/userz"
 	"github.com/leophys/userz/store/pg"
@@ -194,7 +195,7 @@ func TestPGStore(t *testing.T) {
 	assert.Equal(users[0].CreatedAt, u.CreatedAt)
 	assert.WithinDuration(time.Now(), u.UpdatedAt, time.Second)
 
-	pageResult, err := store.Page(ctx, &userz.Filter{
+	pageResult, pagination, err := store.Page(ctx, &userz.Filter{
 		Country: &pg.PGCondition[string]{
 			Op:    userz.OpEq,
 			Value: "CH",
@@ -214,6 +215,52 @@ func TestPGStore(t *testing.T) {
 	assert.Equal(u.Country, pageResult[0].Country)
 	assert.Equal(u.CreatedAt.String(), pageResult[0].CreatedAt.String())
 	assert.Equal(u.UpdatedAt.String(), pageResult[0].UpdatedAt.String())
+	assert.Equal(userz.NewPaginationData(1, 1), pagination)
+
+	// past the last page, the count is still there
+	pageResult, pagination, err = store.Page(ctx, &userz.Filter{
+		Country: &pg.PGCondition[string]{
+			Op:    userz.OpEq,
+			Value: "CH",
+		},
+	}, &userz.PageParams{
+		Size:   1,
+		Offset: 5,
+		Order:  userz.Order{OrdBy: userz.OrdByUpdatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	assert.NoError(err)
+	assert.Len(pageResult, 0)
+	assert.Equal(userz.NewPaginationData(1, 1), pagination)
+
+	// an empty page still counts the users
+	pageResult, pagination, err = store.Page(ctx, &userz.Filter{
+		Country: &pg.PGCondition[string]{
+			Op:    userz.OpEq,
+			Value: "CH",
+		},
+	}, &userz.PageParams{
+		Size:   0,
+		Offset: 0,
+		Order:  userz.Order{OrdBy: userz.OrdByUpdatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	assert.NoError(err)
+	assert.Len(pageResult, 0)
+	assert.Equal(uint(1), pagination.TotalElements)
+
+	// a full first page counts the users of the next ones too
+	pageResult, pagination, err = store.Page(ctx, &userz.Filter{
+		Country: &pg.PGCondition[string]{
+			Op:    userz.OpEq,
+			Value: country2,
+		},
+	}, &userz.PageParams{
+		Size:   1,
+		Offset: 0,
+		Order:  userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	assert.NoError(err)
+	assert.Len(pageResult, 1)
+	assert.Equal(userz.NewPaginationData(uint(len(usersByCountry[country2])), 1), pagination)
 
 	// Delete a user
 	u, err = store.Remove(ctx, users[0].Id)
@@ -226,7 +273,7 @@ func TestPGStore(t *testing.T) {
 	assert.Equal(users[0].Password, u.Password)
 	assert.Equal(users[0].CreatedAt, u.CreatedAt)
 
-	pageResult, err = store.Page(ctx, &userz.Filter{
+	pageResult, pagination, err = store.Page(ctx, &userz.Filter{
 		Country: &pg.PGCondition[string]{
 			Op:    userz.OpEq,
 			Value: "CH",
@@ -238,6 +285,129 @@ func TestPGStore(t *testing.T) {
 	})
 	assert.NoError(err)
 	require.Len(pageResult, 0)
+	assert.Equal(uint(0), pagination.TotalElements)
+
+	// the removed user is not found anymore
+	_, err = store.Update(ctx, users[0].Id, &userz.UserData{Country: "CH"})
+	assert.ErrorIs(err, userz.ErrNotFound)
+
+	_, err = store.Remove(ctx, users[0].Id)
+	assert.ErrorIs(err, userz.ErrNotFound)
+
+	// the ids must be uuids
+	_, err = store.Update(ctx, "not-a-uuid", &userz.UserData{Country: "CH"})
+	assert.ErrorIs(err, userz.ErrInvalidId)
+
+	_, err = store.Remove(ctx, "not-a-uuid")
+	assert.ErrorIs(err, userz.ErrInvalidId)
+
+	// the nicknames and the emails are unique
+	_, err = store.Add(ctx, &userz.UserData{
+		NickName: users[1].NickName,
+		Email:    "other@band.org",
+		Password: "passw0rd",
+	})
+	assert.ErrorIs(err, userz.ErrConflict)
+
+	_, err = store.Update(ctx, users[1].Id, &userz.UserData{Email: users[2].Email})
+	assert.ErrorIs(err, userz.ErrConflict)
+
+	// Add users in bulk
+	adder, ok := store.(userz.BulkAdder)
+	require.True(ok)
+
+	var bulkUsers []*userz.UserData
+	var bulkNicks []string
+	for i := 0; i < 3; i++ {
+		nick := fmt.Sprintf("bulk%d", i)
+		bulkNicks = append(bulkNicks, nick)
+		bulkUsers = append(bulkUsers, &userz.UserData{
+			NickName: nick,
+			Email:    nick + "@band.org",
+			Password: "passw0rd",
+			Country:  country2,
+		})
+	}
+
+	added, err := adder.AddBulk(ctx, bulkUsers)
+	assert.NoError(err)
+	assert.Equal(uint(3), added)
+
+	bulkFilter := &userz.Filter{NickName: &pg.PGCondition[string]{
+		Op:     userz.OpInside,
+		Values: bulkNicks,
+	}}
+	pageResult, pagination, err = store.Page(ctx, bulkFilter, &userz.PageParams{
+		Size:  10,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	assert.NoError(err)
+	require.Len(pageResult, 3)
+	assert.Equal(country2, pageResult[0].Country)
+	assert.Empty(pageResult[0].FirstName)
+	assert.NoError(bcrypt.CompareHashAndPassword(pageResult[0].Password, []byte("passw0rd")))
+
+	// nothing is added if any clashes
+	bulkUsers = append([]*userz.UserData{{
+		NickName: "bulk3",
+		Email:    "bulk3@band.org",
+		Password: "passw0rd",
+	}}, bulkUsers...)
+
+	added, err = adder.AddBulk(ctx, bulkUsers)
+	assert.ErrorIs(err, userz.ErrConflict)
+	assert.Zero(added)
+
+	pageResult, _, err = store.Page(ctx, &userz.Filter{NickName: &pg.PGCondition[string]{
+		Op:    userz.OpEq,
+		Value: "bulk3",
+	}}, &userz.PageParams{
+		Size:  1,
+		Order: userz.Order{OrdBy: userz.OrdByCreatedAt, OrdDir: userz.OrdDirAsc},
+	})
+	assert.NoError(err)
+	assert.Len(pageResult, 0)
+
+	// Take over a user with a legacy password hash
+	legacy, err := store.Add(ctx, &userz.UserData{
+		NickName:     "legacy",
+		Email:        "legacy@band.org",
+		PasswordHash: "sha1$s4lt$29acd6287bbcbaa53dc5ed18803e514e97f10479",
+	})
+	require.NoError(err)
+	assert.Equal(userz.HashSaltedSHA1, legacy.Password.Format())
+
+	verifier, ok := store.(userz.Verifier)
+	require.True(ok)
+
+	_, err = verifier.Verify(ctx, "legacy", "wrong")
+	assert.ErrorIs(err, userz.ErrInvalidCredentials)
+
+	_, err = verifier.Verify(ctx, "unknown", "secret")
+	assert.ErrorIs(err, userz.ErrInvalidCredentials)
+
+	// the hash is upgraded on the first success
+	verified, err := verifier.Verify(ctx, "legacy@band.org", "secret")
+	require.NoError(err)
+	assert.Equal(legacy.Id, verified.Id)
+	assert.Equal(userz.HashBcrypt, verified.Password.Format())
+
+	verified, err = verifier.Verify(ctx, "legacy", "secret")
+	require.NoError(err)
+	assert.Equal(userz.HashBcrypt, verified.Password.Format())
+	assert.Equal(legacy.UpdatedAt, verified.UpdatedAt)
+
+	// a login that is the nickname of a user and the email of another is
+	// refused
+	_, err = store.Add(ctx, &userz.UserData{
+		NickName: "legacy@band.org",
+		Email:    "impostor@band.org",
+		Password: "secret",
+	})
+	require.NoError(err)
+
+	_, err = verifier.Verify(ctx, "legacy@band.org", "secret")
+	assert.ErrorIs(err, userz.ErrInvalidCredentials)
 }
 
 func newUser(password, nick, country string) *userz.UserData {
@@ -4,6 +4,21 @@ import (
 	"time"
 )
 
+// MetadataPrevious prefixes the keys of the fields of the users before the
+// change, in the metadata of the notifications of updates and removals.
+const MetadataPrevious = "previous_"
+
+// The keys of the fields of the users in the metadata of the notifications.
+const (
+	metadataNickName  = "nickname"
+	metadataEmail     = "email"
+	metadataFirstName = "first_name"
+	metadataLastName  = "last_name"
+	metadataCountry   = "country"
+	metadataCreatedAt = "created_at"
+	metadataUpdatedAt = "updated_at"
+)
+
 // User is the main entity we handle, it contains all the needed information
 type User struct {
 	Id        string    `json:"id"`
@@ -16,3 +31,70 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// After tells whether the user comes after the one with the given creation
+// time and id in the order of List.
+func (u *User) After(createdAt time.Time, id string) bool {
+	if !u.CreatedAt.Equal(createdAt) {
+		return u.CreatedAt.After(createdAt)
+	}
+
+	return u.Id > id
+}
+
+// AddMetadata adds the fields of the user, but the id and the password, to
+// the metadata of a notification, with the keys prefixed. The empty fields
+// are left out.
+func (u *User) AddMetadata(metadata map[string]string, prefix string) {
+	set := func(key, value string) {
+		if value != "" {
+			metadata[prefix+key] = value
+		}
+	}
+
+	set(metadataNickName, u.NickName)
+	set(metadataEmail, u.Email)
+	set(metadataFirstName, u.FirstName)
+	set(metadataLastName, u.LastName)
+	set(metadataCountry, u.Country)
+	if !u.CreatedAt.IsZero() {
+		set(metadataCreatedAt, u.CreatedAt.Format(time.RFC3339Nano))
+	}
+	if !u.UpdatedAt.IsZero() {
+		set(metadataUpdatedAt, u.UpdatedAt.Format(time.RFC3339Nano))
+	}
+}
+
+// UserFromMetadata returns the user with the given id whose fields are in
+// the metadata of a notification, with the keys prefixed, if they are there
+// at all.
+func UserFromMetadata(metadata map[string]string, id, prefix string) (*User, bool) {
+	nickName, ok := metadata[prefix+metadataNickName]
+	if !ok {
+		return nil, false
+	}
+
+	user := &User{
+		Id:        id,
+		NickName:  nickName,
+		Email:     metadata[prefix+metadataEmail],
+		FirstName: metadata[prefix+metadataFirstName],
+		LastName:  metadata[prefix+metadataLastName],
+		Country:   metadata[prefix+metadataCountry],
+	}
+
+	for key, t := range map[string]*time.Time{
+		metadataCreatedAt: &user.CreatedAt,
+		metadataUpdatedAt: &user.UpdatedAt,
+	} {
+		if value, ok := metadata[prefix+key]; ok {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, false
+			}
+			*t = parsed
+		}
+	}
+
+	return user, true
+}